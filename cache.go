@@ -0,0 +1,134 @@
+package wzexplorer
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheBudget byte budget of the cache every new CryptProvider starts with
+var DefaultCacheBudget int64 = 256 << 20
+
+type CacheKind byte
+
+const (
+	CacheImage CacheKind = iota
+	CacheStream
+	CacheStreamRaw
+)
+
+// CacheKey identifies decoded data by the file and offset it was read from
+type CacheKey struct {
+	File   string
+	Offset int64
+	Kind   CacheKind
+}
+
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	// Size bytes held
+	Size   int64
+	Budget int64
+}
+
+// Cache holds decoded images and sound streams, implementations must be safe for concurrent use
+type Cache interface {
+	Get(key CacheKey) (value interface{}, ok bool)
+	// Add stores value costing size bytes
+	Add(key CacheKey, value interface{}, size int64)
+	Purge()
+	Stats() CacheStats
+}
+
+type lruEntry struct {
+	key   CacheKey
+	value interface{}
+	size  int64
+}
+
+// LRUCache evicts least recently used entries once the byte budget is exceeded
+type LRUCache struct {
+	lock    sync.Mutex
+	budget  int64
+	size    int64
+	order   *list.List
+	entries map[CacheKey]*list.Element
+	stats   CacheStats
+}
+
+// NewLRUCache budget <= 0 stores nothing
+func NewLRUCache(budget int64) *LRUCache {
+	return &LRUCache{
+		budget:  budget,
+		order:   list.New(),
+		entries: make(map[CacheKey]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key CacheKey) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		c.stats.Hits++
+		return e.Value.(*lruEntry).value, true
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *LRUCache) Add(key CacheKey, value interface{}, size int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	if size > c.budget {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, size: size})
+	c.size += size
+	c.evict()
+}
+
+func (c *LRUCache) remove(e *list.Element) {
+	entry := c.order.Remove(e).(*lruEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// evict caller must hold the lock
+func (c *LRUCache) evict() {
+	for c.size > c.budget && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// SetBudget changes the byte budget, shrinking it evicts immediately
+func (c *LRUCache) SetBudget(budget int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.budget = budget
+	c.evict()
+}
+
+func (c *LRUCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.order.Init()
+	c.entries = make(map[CacheKey]*list.Element)
+	c.size = 0
+}
+
+func (c *LRUCache) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Size = c.size
+	stats.Budget = c.budget
+	return stats
+}
@@ -0,0 +1,149 @@
+package wzexplorer_test
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"sync"
+	"testing"
+)
+
+func cacheKey(offset int64) wzexplorer.CacheKey {
+	return wzexplorer.CacheKey{File: "Test.wz", Offset: offset}
+}
+
+func cached(c *wzexplorer.LRUCache, offsets ...int64) bool {
+	for _, off := range offsets {
+		if _, ok := c.Get(cacheKey(off)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLRUCacheBudget(t *testing.T) {
+	c := wzexplorer.NewLRUCache(100)
+	c.Add(cacheKey(1), 1, 40)
+	c.Add(cacheKey(2), 2, 40)
+	if s := c.Stats(); s.Entries != 2 || s.Size != 80 || s.Budget != 100 {
+		t.Fatalf("%+v", s)
+	}
+
+	// replacing an entry accounts the new size only
+	c.Add(cacheKey(2), 2, 50)
+	if s := c.Stats(); s.Entries != 2 || s.Size != 90 || s.Evictions != 0 {
+		t.Fatalf("replace: %+v", s)
+	}
+
+	// larger than the whole budget is never stored and evicts nothing
+	c.Add(cacheKey(3), 3, 101)
+	if s := c.Stats(); s.Entries != 2 || s.Size != 90 {
+		t.Fatalf("oversized: %+v", s)
+	}
+	if _, ok := c.Get(cacheKey(3)); ok {
+		t.Fatal("oversized entry stored")
+	}
+
+	if v, ok := c.Get(cacheKey(1)); !ok || v.(int) != 1 {
+		t.Fatalf("get: %v %v", v, ok)
+	}
+
+	c.Purge()
+	if s := c.Stats(); s.Entries != 0 || s.Size != 0 {
+		t.Fatalf("purge: %+v", s)
+	}
+
+	c = wzexplorer.NewLRUCache(0)
+	c.Add(cacheKey(1), 1, 1)
+	if s := c.Stats(); s.Entries != 0 {
+		t.Fatalf("zero budget stored: %+v", s)
+	}
+}
+
+func TestLRUCacheEvictionOrder(t *testing.T) {
+	c := wzexplorer.NewLRUCache(30)
+	c.Add(cacheKey(1), 1, 10)
+	c.Add(cacheKey(2), 2, 10)
+	c.Add(cacheKey(3), 3, 10)
+
+	// touching 1 leaves 2 least recently used
+	cached(c, 1)
+	c.Add(cacheKey(4), 4, 10)
+	if !cached(c, 1, 3, 4) || cached(c, 2) {
+		t.Fatal("evicted the wrong entry")
+	}
+
+	// a large entry evicts as many as needed from the back
+	c.Add(cacheKey(5), 5, 25)
+	if !cached(c, 5) || cached(c, 1) || cached(c, 3) || cached(c, 4) {
+		t.Fatal("large entry evicted the wrong entries")
+	}
+	if s := c.Stats(); s.Evictions != 4 || s.Size != 25 {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestLRUCacheSetBudget(t *testing.T) {
+	c := wzexplorer.NewLRUCache(100)
+	for i := int64(1); i <= 5; i++ {
+		c.Add(cacheKey(i), i, 20)
+	}
+	cached(c, 1)
+	c.SetBudget(50)
+	s := c.Stats()
+	if s.Entries != 2 || s.Size != 40 || s.Budget != 50 || s.Evictions != 3 {
+		t.Fatalf("%+v", s)
+	}
+	if !cached(c, 1, 5) {
+		t.Fatal("shrinking evicted recently used entries")
+	}
+
+	c.SetBudget(0)
+	if s = c.Stats(); s.Entries != 0 || s.Size != 0 {
+		t.Fatalf("zero budget: %+v", s)
+	}
+}
+
+func TestLRUCacheStats(t *testing.T) {
+	c := wzexplorer.NewLRUCache(100)
+	c.Add(cacheKey(1), 1, 10)
+	c.Get(cacheKey(1))
+	c.Get(cacheKey(1))
+	c.Get(cacheKey(2))
+	s := c.Stats()
+	if s.Hits != 2 || s.Misses != 1 || s.Entries != 1 || s.Size != 10 {
+		t.Fatalf("%+v", s)
+	}
+	// counters survive a purge
+	c.Purge()
+	if s = c.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Fatalf("purge reset counters: %+v", s)
+	}
+}
+
+func TestLRUCacheConcurrent(t *testing.T) {
+	c := wzexplorer.NewLRUCache(1000)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := cacheKey(int64((g*7 + i) % 64))
+				if v, ok := c.Get(k); ok && v.(int64) != k.Offset {
+					t.Errorf("key %d holds %v", k.Offset, v)
+					return
+				}
+				c.Add(k, k.Offset, int64(i%50))
+				if i%200 == 0 {
+					c.SetBudget(int64(500 + i))
+				}
+				c.Stats()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	s := c.Stats()
+	if s.Size > s.Budget || s.Hits+s.Misses != 8000 {
+		t.Fatalf("%+v", s)
+	}
+}
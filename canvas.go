@@ -2,26 +2,32 @@ package wzexplorer
 
 import (
 	"bytes"
-	"compress/zlib"
 	"errors"
+	"fmt"
 	"github.com/anonymous5l/wzexplorer/wzimage"
 	"image"
 	"io"
+	"math"
 )
 
+// CanvasFormat the stored format, scaled thumbnails of older data carry their mag level in the code
 type CanvasFormat int
 
 const (
 	CanvasFormatBGRA4444    CanvasFormat = 1
 	CanvasFormatBGRA8888    CanvasFormat = 2
-	CanvasFormatGray        CanvasFormat = 3    // 0x2 + 1
+	CanvasFormatGray        CanvasFormat = 3    // BGRA4444 layout + mag level 2, black and white thumbnails
 	CanvasFormatARGB1555    CanvasFormat = 257  // 0x100 + 1
 	CanvasFormatRGB565      CanvasFormat = 513  // 0x200
-	CanvasFormatRGB565Thumb CanvasFormat = 517  // 0x200 + 5
+	CanvasFormatRGB565Thumb CanvasFormat = 517  // RGB565 + mag level 4
 	CanvasFormatDXT3        CanvasFormat = 1026 // 0x400 + 2
 	CanvasFormatDXT5        CanvasFormat = 2050 // 0x800 + 2
+	CanvasFormatDXT1        CanvasFormat = 4097 // 0x1000 + 1
+	CanvasFormatBC7         CanvasFormat = 4098 // 0x1000 + 2
 )
 
+var ErrUnsupportedCanvasFormat = errors.New("unsupported canvas format")
+
 func (f CanvasFormat) String() string {
 	switch f {
 	case CanvasFormatBGRA4444:
@@ -40,6 +46,10 @@ func (f CanvasFormat) String() string {
 		return "DXT3"
 	case CanvasFormatDXT5:
 		return "DXT5"
+	case CanvasFormatDXT1:
+		return "DXT1"
+	case CanvasFormatBC7:
+		return "BC7"
 	}
 	return "Unknown"
 }
@@ -47,13 +57,25 @@ func (f CanvasFormat) String() string {
 type Canvas interface {
 	GetObject
 	Size() image.Point
+	// Image the result may be shared through the cache, use wzimage.Convert for a copy to modify
 	Image() (image.Image, error)
 	Format() CanvasFormat
+	// Scale returns the mag level, the bitmap is stored 2^Scale times smaller than Size
+	// and Image enlarges it back
+	Scale() int
+	// RawData returns the zlib stream with its encrypted blocks decrypted
+	RawData() ([]byte, error)
+	// Pixels returns the inflated bitmap undecoded and the format it's stored in,
+	// scaled canvases hold Size shrunk by Scale
+	Pixels() ([]byte, CanvasFormat, error)
 }
 
 type canvas struct {
+	// object holds the properties, its offset stays at them so they parse again after Unload
 	*object
-	img           image.Image
+	// offset and size locate the pixel data
+	offset        int64
+	size          int32
 	format        CanvasFormat
 	magLevel      byte
 	width, height int32
@@ -63,105 +85,158 @@ func (c *canvas) Size() image.Point {
 	return image.Pt(int(c.width), int(c.height))
 }
 
+// DataSize the size of the pixel data
+func (c *canvas) DataSize() int32 {
+	return c.size
+}
+
 func (c *canvas) Format() CanvasFormat {
 	return c.format
 }
 
-func (c *canvas) build(deflated []byte) (err error) {
+// base returns the format the bitmap is stored in and the mag level,
+// the legacy thumbnail formats have the scale built in
+func (c *canvas) base() (CanvasFormat, int) {
 	switch c.format {
+	case CanvasFormatGray:
+		return CanvasFormatGray, int(c.magLevel) + 2
+	case CanvasFormatRGB565Thumb:
+		return CanvasFormatRGB565, int(c.magLevel) + 4
+	}
+	return c.format, int(c.magLevel)
+}
+
+func (c *canvas) Scale() int {
+	_, scale := c.base()
+	return scale
+}
+
+// stored returns the size of the bitmap as stored, RGB565 thumbnails drop partial 16x16 blocks
+// and would make inflate wait for bytes that aren't there if rounded up
+func (c *canvas) stored() image.Point {
+	if c.format == CanvasFormatRGB565Thumb {
+		size, scale := c.Size(), c.Scale()
+		return image.Pt(size.X>>scale, size.Y>>scale)
+	}
+	return wzimage.ScaledSize(c.Size(), c.Scale())
+}
+
+// maxInflate zlib inflates a stored byte to at most this many
+const maxInflate = 1032
+
+// pixelSize returns the inflated size the format needs, sizes the stored data
+// can't inflate to are rejected before anything is allocated
+func (c *canvas) pixelSize() (int, error) {
+	if c.width <= 0 || c.height <= 0 {
+		return 0, fmt.Errorf("invalid canvas size %dx%d", c.width, c.height)
+	}
+	format, _ := c.base()
+	size := c.stored()
+	// uint64 holds 4 bytes of int32 by int32 pixels
+	w, h := uint64(size.X), uint64(size.Y)
+	var n uint64
+	switch format {
+	case CanvasFormatBGRA8888:
+		n = w * h * 4
+	case CanvasFormatBGRA4444, CanvasFormatGray, CanvasFormatARGB1555, CanvasFormatRGB565:
+		n = w * h * 2
+	case CanvasFormatDXT1:
+		n = ((w + 3) / 4) * ((h + 3) / 4) * 8
+	case CanvasFormatDXT3, CanvasFormatDXT5, CanvasFormatBC7:
+		n = ((w + 3) / 4) * ((h + 3) / 4) * 16
+	default:
+		return 0, fmt.Errorf("%w %d", ErrUnsupportedCanvasFormat, c.format)
+	}
+	var limit uint64
+	if c.size > 0 {
+		limit = uint64(c.size) * maxInflate
+	}
+	if n > limit || n > math.MaxInt {
+		return 0, fmt.Errorf("canvas %dx%d %s needs %d bytes, %d stored bytes inflate to at most %d",
+			c.width, c.height, c.format, n, c.size, limit)
+	}
+	return int(n), nil
+}
+
+func (c *canvas) build(deflated []byte) (img image.Image, err error) {
+	format, scale := c.base()
+	size := c.stored()
+	switch format {
 	case CanvasFormatBGRA4444:
-		c.img, err = wzimage.NewBGRA4444(c.Size(), deflated)
+		img, err = wzimage.NewBGRA4444(size, deflated)
 	case CanvasFormatBGRA8888:
-		c.img, err = wzimage.NewBGRA8888(c.Size(), deflated)
+		img, err = wzimage.NewBGRA8888(size, deflated)
+	case CanvasFormatGray:
+		img, err = wzimage.NewGray(size, deflated)
 	case CanvasFormatARGB1555:
-		c.img, err = wzimage.NewARGB1555(c.Size(), deflated)
+		img, err = wzimage.NewARGB1555(size, deflated)
 	case CanvasFormatRGB565:
-		c.img, err = wzimage.NewRGB565(c.Size(), deflated)
-	case CanvasFormatRGB565Thumb:
-		c.img, err = wzimage.NewRGB565Thumb(c.Size(), deflated)
-	case CanvasFormatDXT3, CanvasFormatGray:
-		c.img, err = wzimage.NewDXT3(c.Size(), deflated)
+		img, err = wzimage.NewRGB565(size, deflated)
+	case CanvasFormatDXT3:
+		img, err = wzimage.NewDXT3(size, deflated)
 	case CanvasFormatDXT5:
-		c.img, err = wzimage.NewDXT5(c.Size(), deflated)
+		img, err = wzimage.NewDXT5(size, deflated)
+	case CanvasFormatDXT1:
+		img, err = wzimage.NewDXT1(size, deflated)
+	case CanvasFormatBC7:
+		img, err = wzimage.NewBC7(size, deflated)
+	default:
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedCanvasFormat, c.format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if scale > 0 {
+		img = wzimage.Upscale(img, scale, c.Size())
 	}
 	return
 }
 
-func (c *canvas) Image() (bitmap image.Image, err error) {
-	if c.img != nil {
-		return c.img, nil
+func (c *canvas) RawData() ([]byte, error) {
+	var blocks blockReader
+	r, err := c.stream(&blocks)
+	if err != nil {
+		return nil, err
 	}
-
-	b := c.f.b
-	offset := c.offset + 1
-	size := c.size - 1
-	if _, err = b.Seek(offset, io.SeekStart); err != nil {
-		return
+	buf := bytes.NewBuffer(make([]byte, 0, c.size-1))
+	if _, err = buf.ReadFrom(r); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	var n int
-
-	data := make([]byte, size, size)
-	if n, err = b.Read(data); err != nil {
-		return
-	} else if n != int(size) {
-		err = io.EOF
-		return
+func (c *canvas) Pixels() ([]byte, CanvasFormat, error) {
+	format, _ := c.base()
+	data, err := c.inflate()
+	if err != nil {
+		return nil, format, err
 	}
+	return data, format, nil
+}
 
-	var deflated []byte
-
-	header := b.o.Uint16(data)
-
-	if header != 0x9c78 && header != 0xda78 && header != 0x0178 && header != 0x5e78 {
-		var shrinkData []byte
-		for len(data) > 0 {
-			blockSize := int(b.o.Uint32(data))
-			transform := data[4 : 4+blockSize]
-			b.provider.crypt.Transform(transform)
-			shrinkData = append(shrinkData, transform...)
-			data = data[4+blockSize:]
-		}
-		deflated, err = c.deflate(shrinkData)
-		if err != nil {
-			return
-		}
-	} else {
-		deflated, err = c.deflate(data)
-		if err != nil {
-			return
+func (c *canvas) Image() (bitmap image.Image, err error) {
+	cp := c.f.b.provider
+	cache := cp.cache
+	key := CacheKey{File: c.f.filename, Offset: c.offset, Kind: CacheImage}
+	if cache != nil {
+		if v, ok := cache.Get(key); ok {
+			return v.(image.Image), nil
 		}
 	}
 
-	if err = c.build(deflated); err != nil {
+	deflated, err := c.inflate()
+	if err != nil {
 		return
 	}
 
-	bitmap = c.img
-	return
-}
-
-func (c *canvas) deflate(data []byte) (deflated []byte, err error) {
-	var stream io.ReadCloser
-	if stream, err = zlib.NewReader(bytes.NewReader(data)); err != nil {
-		return
+	if bitmap, err = c.build(deflated); err != nil {
+		return nil, err
 	}
-	defer stream.Close()
-
-	buffer := bytes.NewBuffer([]byte{})
-	swap := make([]byte, 1024)
-	var n int
-	for {
-		if n, err = stream.Read(swap); err != nil {
-			if err != io.ErrUnexpectedEOF {
-				return
-			}
-			err = nil
-			break
-		}
-		buffer.Write(swap[:n])
+
+	if cache != nil {
+		size := bitmap.Bounds().Size()
+		cache.Add(key, bitmap, int64(size.X*size.Y*4))
 	}
-	deflated = buffer.Bytes()
 	return
 }
 
@@ -177,12 +252,15 @@ func (c *canvas) parse(f *file, offset int64) error {
 	}
 
 	c.object = newObject(f, offset)
-	c.object.t = ObjectTypeVariantNil
+	c.object.t = ObjectTypeProperties
 	if hasProperty > 0 {
-		c.object.t = ObjectTypeProperties
-		if err = c.object.parse(); err != nil {
+		if err = c.object.load(); err != nil {
 			return err
 		}
+	} else {
+		// canvas without properties still supports Get and Each
+		c.object.o = Properties[KVPair]{}
+		c.object.flag |= flagLoaded
 	}
 
 	if c.width, err = b.ReadCompressInt32(); err != nil {
@@ -202,8 +280,8 @@ func (c *canvas) parse(f *file, offset int64) error {
 	if format2, err = b.ReadByte(); err != nil {
 		return err
 	}
-	format += int32(format2)
 	c.format = CanvasFormat(format)
+	c.magLevel = format2
 	var test int32
 	if test, err = b.ReadInt32(); err != nil {
 		return err
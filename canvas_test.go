@@ -0,0 +1,130 @@
+package wzexplorer_test
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCanvasInflate(t *testing.T) {
+	// larger than the inflate buffer so the last chunk arrives with io.EOF
+	pixels := make([]byte, 32*32*4)
+	for i := 0; i < len(pixels); i += 4 {
+		pixels[i], pixels[i+1], pixels[i+2], pixels[i+3] = byte(i), byte(i>>8), 0x40, 0xff
+	}
+
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := openTest(t, b, wzexplorer.IvEmpty, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "c", Value: b.Canvas(32, 32, int32(wzexplorer.CanvasFormatBGRA8888), pixels)},
+	)})
+
+	img, err := f.MustGet("a/c").Canvas().Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range [][2]int{{0, 0}, {5, 3}, {31, 31}} {
+		i := (p[1]*32 + p[0]) * 4
+		want := color.NRGBA{R: pixels[i+2], G: pixels[i+1], B: pixels[i], A: pixels[i+3]}
+		if got := color.NRGBAModel.Convert(img.At(p[0], p[1])); got != want {
+			t.Errorf("At(%d, %d) = %v, want %v", p[0], p[1], got, want)
+		}
+	}
+}
+
+func TestCanvasWithoutProperties(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := openTest(t, b, wzexplorer.IvEmpty, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "bare", Value: b.Canvas(1, 1, int32(wzexplorer.CanvasFormatBGRA8888), make([]byte, 4))},
+		wztest.Prop{Name: "props", Value: b.Canvas(1, 1, int32(wzexplorer.CanvasFormatBGRA8888), make([]byte, 4),
+			wztest.Prop{Name: "z", Value: int32(3)},
+		)},
+	)})
+
+	bare := f.MustGet("a/bare")
+	if o, err := bare.Get("z"); err != nil || o != nil {
+		t.Errorf("bare Get(z) = %v, %v, want nil, nil", o, err)
+	}
+	if err := bare.Each(func(string, wzexplorer.Object) error {
+		t.Error("bare Each visited a child")
+		return nil
+	}); err != nil {
+		t.Errorf("bare Each: %v", err)
+	}
+
+	if got := f.MustGet("a/props/z").Int32(); got != 3 {
+		t.Errorf("props/z = %d, want 3", got)
+	}
+}
+
+func testCanvas(t *testing.T, width, height, format int32, pixels []byte) wzexplorer.Canvas {
+	t.Helper()
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := openTest(t, b, wzexplorer.IvEmpty, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "c", Value: b.Canvas(width, height, format, pixels)},
+	)})
+	o := f.MustGet("a/c")
+	if o == nil || o.Type() != wzexplorer.ObjectTypeCanvas {
+		t.Fatal("a/c isn't a canvas")
+	}
+	return o.Canvas()
+}
+
+func checkColor(t *testing.T, img image.Image, x, y int, want color.NRGBA) {
+	t.Helper()
+	if got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA); got != want {
+		t.Errorf("(%d,%d) %v, want %v", x, y, got, want)
+	}
+}
+
+func TestCanvasGray(t *testing.T) {
+	// 6x5 at mag level 2 stores 2x2 pixels: gray, red, half transparent gray, white
+	c := testCanvas(t, 6, 5, int32(wzexplorer.CanvasFormatGray), []byte{
+		0x88, 0xf8, 0x00, 0xff,
+		0x44, 0x84, 0xff, 0xff,
+	})
+	if c.Scale() != 2 || c.Format().String() != "Gray" {
+		t.Fatalf("scale %d format %s", c.Scale(), c.Format())
+	}
+	img, err := c.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 6, 5) {
+		t.Fatalf("bounds %v", img.Bounds())
+	}
+	checkColor(t, img, 3, 3, color.NRGBA{R: 0x88, G: 0x88, B: 0x88, A: 0xff})
+	checkColor(t, img, 4, 0, color.NRGBA{R: 76, G: 76, B: 76, A: 0xff})
+	checkColor(t, img, 0, 4, color.NRGBA{R: 0x44, G: 0x44, B: 0x44, A: 0x88})
+	checkColor(t, img, 5, 4, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+
+	data, format, err := c.Pixels()
+	if err != nil || len(data) != 8 || format != wzexplorer.CanvasFormatGray {
+		t.Fatalf("pixels %d %s %v", len(data), format, err)
+	}
+}
+
+func TestCanvasRGB565Thumb(t *testing.T) {
+	// 20x36 keeps only the whole 16x16 blocks, 1x2 pixels red over blue
+	c := testCanvas(t, 20, 36, int32(wzexplorer.CanvasFormatRGB565Thumb), []byte{0x00, 0xf8, 0x1f, 0x00})
+	if c.Scale() != 4 {
+		t.Fatalf("scale %d", c.Scale())
+	}
+	img, err := c.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 20, 36) {
+		t.Fatalf("bounds %v", img.Bounds())
+	}
+	checkColor(t, img, 15, 15, color.NRGBA{R: 248, A: 0xff})
+	checkColor(t, img, 0, 16, color.NRGBA{B: 248, A: 0xff})
+	checkColor(t, img, 16, 0, color.NRGBA{})
+	checkColor(t, img, 0, 32, color.NRGBA{})
+
+	data, format, err := c.Pixels()
+	if err != nil || len(data) != 4 || format != wzexplorer.CanvasFormatRGB565 {
+		t.Fatalf("pixels %d %s %v", len(data), format, err)
+	}
+}
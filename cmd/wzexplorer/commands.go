@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	register("ls", "<archive> [path]  list children", cmdLs)
+	register("tree", "<archive> [path] [--depth n]  print subtree", cmdTree)
+	register("cat", "<archive> <path>  print scalar or json subtree", cmdCat)
+	register("img", "<archive> <path> [-o out.png] [--raw|--pixels]  export canvas", cmdImg)
+	register("snd", "<archive> <path> [-o out.wav] [--wav]  export sound", cmdSnd)
+	register("extract", "<archive> <path> <dir>  export subtree as files", cmdExtract)
+}
+
+// parseArgs parses flags placed anywhere between positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, exit(ExitUsage, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || len(positional) > max {
+		return nil, exit(ExitUsage, fmt.Errorf("%s: invalid arguments", fs.Name()))
+	}
+	return positional, nil
+}
+
+func openPath(opts *options, args []string) (wzexplorer.File, wzexplorer.Object, error) {
+	f, err := open(opts, args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	path := "/"
+	if len(args) > 1 {
+		path = args[1]
+	}
+	o, err := get(f, path)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return f, o, nil
+}
+
+func describe(o wzexplorer.Object) string {
+	switch o.Type() {
+	case wzexplorer.ObjectTypeCanvas:
+		c := o.Canvas()
+		size := c.Size()
+		return fmt.Sprintf("%dx%d %s", size.X, size.Y, c.Format())
+	case wzexplorer.ObjectTypeSound:
+		s := o.Sound()
+		return fmt.Sprintf("%s %s", s.Media().Kind(), s.Duration())
+	case wzexplorer.ObjectTypeDirectory, wzexplorer.ObjectTypeProperties, wzexplorer.ObjectTypeConvex:
+		return ""
+	}
+	return o.String()
+}
+
+func cmdLs(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("ls", opts)
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return printList(os.Stdout, o)
+}
+
+func printList(w io.Writer, o wzexplorer.Object) error {
+	list, err := children(o)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		fmt.Fprintf(w, "%-12s %s\t%s\n", c.obj.Type(), c.name, describe(c.obj))
+	}
+	return nil
+}
+
+func printTree(w io.Writer, o wzexplorer.Object, indent string, depth int) error {
+	list, err := children(o)
+	if err != nil {
+		return err
+	}
+	for i, c := range list {
+		branch, next := "├── ", "│   "
+		if i == len(list)-1 {
+			branch, next = "└── ", "    "
+		}
+		desc := describe(c.obj)
+		if desc != "" {
+			desc = " = " + desc
+		}
+		fmt.Fprintf(w, "%s%s%s [%s]%s\n", indent, branch, c.name, c.obj.Type(), desc)
+		if depth != 1 {
+			if err = printTree(w, c.obj, indent+next, depth-1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func cmdTree(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("tree", opts)
+	depth := fs.Int("depth", 2, "max depth, 0 means unlimited")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	path := "/"
+	if len(args) > 1 {
+		path = args[1]
+	}
+	fmt.Printf("%s [%s]\n", path, o.Type())
+	return printTree(os.Stdout, o, "", *depth)
+}
+
+func cmdCat(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("cat", opts)
+	depth := fs.Int("depth", 0, "max depth, 0 means unlimited")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return printObject(os.Stdout, o, *depth)
+}
+
+// printObject prints scalars as text and everything else as json
+func printObject(w io.Writer, o wzexplorer.Object, depth int) error {
+	if !container(o) && o.Type() != wzexplorer.ObjectTypeVector && o.Type() != wzexplorer.ObjectTypeSound {
+		_, err := fmt.Fprintln(w, o.String())
+		return err
+	}
+
+	v, err := toJSON(o, depth)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// create opens output file, "-" means stdout
+// nopCloser keeps callers from closing stdout
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func create(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(name)
+}
+
+func writeCanvas(o wzexplorer.Object, name string) error {
+	img, err := o.Canvas().Image()
+	if err != nil {
+		return err
+	}
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(w, img); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// soundExt returns the file extension Open or OpenWAV produces
+func soundExt(s wzexplorer.Sound, wav bool) string {
+	if !wav && s.Media().Kind() == wzexplorer.MediaKindMP3 {
+		return ".mp3"
+	}
+	return ".wav"
+}
+
+// openSound opens s in the encoding soundExt reports
+func openSound(s wzexplorer.Sound, wav bool) (io.ReadSeekCloser, error) {
+	if soundExt(s, wav) == ".mp3" || s.Media().Kind() == wzexplorer.MediaKindPCM {
+		return s.Open()
+	}
+	return s.OpenWAV()
+}
+
+func writeSound(o wzexplorer.Object, name string, wav bool) error {
+	r, err := openSound(o.Sound(), wav)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func cmdImg(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("img", opts)
+	out := fs.String("o", "", "output file, - for stdout")
+	raw := fs.Bool("raw", false, "write the decrypted zlib stream")
+	pixels := fs.Bool("pixels", false, "write the inflated pixels in their stored format")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if *raw && *pixels {
+		return exit(ExitUsage, errors.New("--raw and --pixels are exclusive"))
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if o.Type() != wzexplorer.ObjectTypeCanvas {
+		return exit(ExitNotFound, fmt.Errorf("%s: not a canvas", args[1]))
+	}
+	c := o.Canvas()
+	var data []byte
+	ext := ".png"
+	switch {
+	case *raw:
+		data, err = c.RawData()
+		ext = ".zlib"
+	case *pixels:
+		var format wzexplorer.CanvasFormat
+		data, format, err = c.Pixels()
+		ext = "." + strings.ToLower(format.String())
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = filepath.Base(args[1]) + ext
+	}
+	if data == nil {
+		return writeCanvas(o, *out)
+	}
+	w, err := create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func cmdSnd(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("snd", opts)
+	out := fs.String("o", "", "output file, - for stdout")
+	wav := fs.Bool("wav", false, "wrap every format in a wav container")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if o.Type() != wzexplorer.ObjectTypeSound {
+		return exit(ExitNotFound, fmt.Errorf("%s: not a sound", args[1]))
+	}
+	if *out == "" {
+		*out = filepath.Base(args[1]) + soundExt(o.Sound(), *wav)
+	}
+	return writeSound(o, *out, *wav)
+}
+
+// extract writes canvases and sounds as files and every image as json
+func extract(o wzexplorer.Object, dir string, parent wzexplorer.ObjectType) error {
+	switch o.Type() {
+	case wzexplorer.ObjectTypeCanvas:
+		if err := writeCanvas(o, dir+".png"); err != nil {
+			return err
+		}
+	case wzexplorer.ObjectTypeSound:
+		return writeSound(o, dir+soundExt(o.Sound(), false), false)
+	case wzexplorer.ObjectTypeProperties:
+		if parent == wzexplorer.ObjectTypeDirectory {
+			v, err := toJSON(o, 0)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err = os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+				return err
+			}
+			if err = os.WriteFile(dir+".img.json", data, 0644); err != nil {
+				return err
+			}
+			dir += ".img"
+		}
+	}
+
+	list, err := children(o)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		// names come from the archive and must not escape dir
+		if !filepath.IsLocal(c.name) || strings.ContainsAny(c.name, `/\`) {
+			return exit(ExitCorrupt, fmt.Errorf("%s: unsafe name %q", dir, c.name))
+		}
+		if err = extract(c.obj, filepath.Join(dir, c.name), o.Type()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdExtract(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("extract", opts)
+	args, err := parseArgs(fs, args, 3, 3)
+	if err != nil {
+		return err
+	}
+	f, o, err := openPath(opts, args[:2])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir := args[2]
+	if name := filepath.Base(args[1]); name != "/" && name != "." {
+		dir = filepath.Join(dir, name)
+	}
+	return extract(o, dir, wzexplorer.ObjectTypeDirectory)
+}
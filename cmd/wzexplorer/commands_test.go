@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractRejectsUnsafeNames(t *testing.T) {
+	for _, name := range []string{"..", "../evil", "a/../../evil", "/abs", `a\b`, ""} {
+		b := wztest.New(wzexplorer.IvEmpty)
+		archive := b.Write(t, wztest.Entry{Name: "a.img", Image: b.Properties(
+			wztest.Prop{Name: name, Value: "x"},
+		)})
+		dir := t.TempDir()
+		err := cmdExtract([]string{"--iv", "empty", archive, "a", filepath.Join(dir, "out")})
+		var e *exitError
+		if !errors.As(err, &e) || e.code != ExitCorrupt {
+			t.Errorf("%q: error %v, want corrupt", name, err)
+		}
+		if _, err = os.Stat(filepath.Join(dir, "evil")); err == nil {
+			t.Errorf("%q: escaped the output directory", name)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	archive := b.Write(t, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "icon", Value: b.Canvas(1, 1, 2, []byte{1, 2, 3, 4})},
+	)})
+	dir := t.TempDir()
+	if err := cmdExtract([]string{"--iv", "empty", archive, "a", dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.img", "icon.png")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateStdout(t *testing.T) {
+	w, err := create("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stdout.Stat(); err != nil {
+		t.Fatalf("stdout closed: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer/wzdiff"
+	gopath "path"
+)
+
+func init() {
+	register("diff", "<old> <new> [path] [--format text|json|html] [-o out] [--old-version n] [--old-iv iv] [--new-version n] [--new-iv iv]  compare two archives", cmdDiff)
+}
+
+func cmdDiff(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("diff", opts)
+	format := fs.String("format", "text", "output format: text, json or html")
+	out := fs.String("o", "-", "output file, - for stdout")
+	oldVersion := fs.Int("old-version", 0, "client version of <old>, defaults to --version")
+	oldIv := fs.String("old-iv", "", "iv of <old>, defaults to --iv")
+	newVersion := fs.Int("new-version", 0, "client version of <new>, defaults to --version")
+	newIv := fs.String("new-iv", "", "iv of <new>, defaults to --iv")
+	args, err := parseArgs(fs, args, 2, 3)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "text", "json", "html":
+	default:
+		return exit(ExitUsage, fmt.Errorf("unknown format %q", *format))
+	}
+
+	// archives of different regions or patches usually need different keys
+	side := func(prefix string, version *int, iv *string) *options {
+		o := *opts
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case prefix + "-version":
+				o.version = *version
+			case prefix + "-iv":
+				o.iv = *iv
+			}
+		})
+		return &o
+	}
+
+	path := "/"
+	if len(args) > 2 {
+		path = args[2]
+	}
+	oldFile, oldObj, err := openPath(side("old", oldVersion, oldIv), []string{args[0], path})
+	if err != nil {
+		return err
+	}
+	defer oldFile.Close()
+	newFile, newObj, err := openPath(side("new", newVersion, newIv), []string{args[1], path})
+	if err != nil {
+		return err
+	}
+	defer newFile.Close()
+
+	// the archive roots aren't objects, compare from the files themselves
+	var result *wzdiff.Result
+	if path == "/" {
+		result, err = wzdiff.Diff(oldFile, newFile)
+	} else {
+		result, err = wzdiff.Diff(oldObj, newObj)
+	}
+	if err != nil {
+		return err
+	}
+	for _, c := range result.Changes {
+		c.Path = gopath.Join(path, c.Path)
+	}
+
+	w, err := create(*out)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "text":
+		err = result.WriteText(w)
+	case "json":
+		err = result.WriteJSON(w)
+	case "html":
+		err = result.WriteHTML(w)
+	}
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
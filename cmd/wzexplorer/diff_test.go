@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffSeparateKeys(t *testing.T) {
+	ob := wztest.New(wzexplorer.IvGMS)
+	oldArchive := ob.Write(t, wztest.Entry{Name: "a.img", Image: ob.Properties(
+		wztest.Prop{Name: "name", Value: "old"},
+	)})
+	nb := wztest.New(wzexplorer.IvEmpty)
+	newArchive := nb.Write(t, wztest.Entry{Name: "a.img", Image: nb.Properties(
+		wztest.Prop{Name: "name", Value: "new"},
+	)})
+
+	out := filepath.Join(t.TempDir(), "diff.txt")
+	if err := cmdDiff([]string{"--iv", "empty", "--old-iv", "gms", "-o", out, oldArchive, newArchive}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "a/name") {
+		t.Fatalf("diff misses a/name:\n%s", data)
+	}
+}
+
+func TestDiffFormatCheckedFirst(t *testing.T) {
+	err := cmdDiff([]string{"--format", "xml", "missing-old.wz", "missing-new.wz"})
+	var e *exitError
+	if !errors.As(err, &e) || e.code != ExitUsage {
+		t.Fatalf("error %v, want usage", err)
+	}
+}
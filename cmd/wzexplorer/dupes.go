@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/wzhash"
+	"os"
+	gopath "path"
+)
+
+func init() {
+	register("dupes", "<archive> [path] [--similar n] [--min-size n] [--format text|json] [-o out] [-v]  find duplicate canvases and sounds", cmdDupes)
+}
+
+func cmdDupes(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("dupes", opts)
+	similar := fs.Int("similar", 0, "also group canvases whose perceptual hashes differ in at most n of 64 bits")
+	minSize := fs.Int("min-size", 0, "skip assets storing fewer bytes")
+	format := fs.String("format", "text", "output format: text or json")
+	out := fs.String("o", "-", "output file, - for stdout")
+	verbose := fs.Bool("v", false, "print every image while hashing")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if *similar < 0 || *similar > 64 {
+		return exit(ExitUsage, fmt.Errorf("--similar %d out of range 0-64", *similar))
+	}
+	if *format != "text" && *format != "json" {
+		return exit(ExitUsage, fmt.Errorf("unknown format %q", *format))
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var root wzexplorer.GetObject = f
+	prefix := "/"
+	if len(args) > 1 {
+		root, prefix = o, args[1]
+	}
+
+	do := &wzhash.DupesOptions{Similar: *similar, MinSize: int32(*minSize)}
+	if *verbose {
+		do.Progress = func(p string) {
+			fmt.Fprintln(os.Stderr, gopath.Join(prefix, p))
+		}
+	}
+	report, err := wzhash.Dupes(root, do)
+	if err != nil {
+		return err
+	}
+	for _, groups := range [][]*wzhash.Group{report.Exact, report.Similar} {
+		for _, g := range groups {
+			for _, a := range g.Assets {
+				a.Path = gopath.Join(prefix, a.Path)
+			}
+		}
+	}
+	for i, p := range report.Failed {
+		report.Failed[i] = gopath.Join(prefix, p)
+	}
+
+	w, err := create(*out)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		err = report.WriteJSON(w)
+	} else {
+		err = report.WriteText(w)
+	}
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
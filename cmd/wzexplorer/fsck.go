@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"os"
+	"path"
+)
+
+func init() {
+	register("fsck", "<archive> [path] [--no-checksum] [--no-canvas] [-v]  verify image checksums, sizes and canvases", cmdFsck)
+}
+
+func cmdFsck(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("fsck", opts)
+	noChecksum := fs.Bool("no-checksum", false, "skip image checksums")
+	noCanvas := fs.Bool("no-canvas", false, "skip inflating canvases")
+	verbose := fs.Bool("v", false, "print every image while verifying")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var root wzexplorer.GetObject = f
+	prefix := "/"
+	if len(args) > 1 {
+		if o.Type() != wzexplorer.ObjectTypeDirectory {
+			return exit(ExitUsage, fmt.Errorf("%s: not a directory", args[1]))
+		}
+		root, prefix = o, args[1]
+	}
+
+	vo := &wzexplorer.VerifyOptions{NoChecksum: *noChecksum, NoCanvas: *noCanvas}
+	if *verbose {
+		vo.Progress = func(p string) {
+			fmt.Fprintln(os.Stderr, path.Join(prefix, p))
+		}
+	}
+	report, err := wzexplorer.Verify(root, vo)
+	if err != nil {
+		return err
+	}
+	for _, issue := range report.Issues {
+		issue.Path = path.Join(prefix, issue.Path)
+		fmt.Println(issue)
+	}
+	fmt.Printf("%d images, %d canvases, %d issues\n", report.Images, report.Canvases, len(report.Issues))
+	if !report.OK() {
+		return exit(ExitCorrupt, fmt.Errorf("%d issues found", len(report.Issues)))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/anonymous5l/wzexplorer"
+	"sort"
+)
+
+// jsonObject keeps wz property order when marshaled
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func (j jsonObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('{')
+	for i, f := range j {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type child struct {
+	name string
+	obj  wzexplorer.Object
+}
+
+func container(o wzexplorer.Object) bool {
+	switch o.Type() {
+	case wzexplorer.ObjectTypeDirectory, wzexplorer.ObjectTypeProperties,
+		wzexplorer.ObjectTypeConvex, wzexplorer.ObjectTypeCanvas:
+		return true
+	}
+	return false
+}
+
+// children returns children of o, directories are sorted by name
+func children(o wzexplorer.Object) ([]child, error) {
+	if !container(o) {
+		return nil, nil
+	}
+	var list []child
+	if err := o.Each(func(name string, obj wzexplorer.Object) error {
+		list = append(list, child{name: name, obj: obj})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if o.Type() == wzexplorer.ObjectTypeDirectory {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].name < list[j].name
+		})
+	}
+	return list, nil
+}
+
+// scalar returns the json value of non container objects
+func scalar(o wzexplorer.Object) interface{} {
+	switch o.Type() {
+	case wzexplorer.ObjectTypeVariantNil:
+		return nil
+	case wzexplorer.ObjectTypeVariantInt16:
+		return o.Int16()
+	case wzexplorer.ObjectTypeVariantInt32:
+		return o.Int32()
+	case wzexplorer.ObjectTypeVariantInt64:
+		return o.Int64()
+	case wzexplorer.ObjectTypeVariantFloat32:
+		return o.Float32()
+	case wzexplorer.ObjectTypeVariantFloat64:
+		return o.Float64()
+	case wzexplorer.ObjectTypeVariantString:
+		return o.String()
+	case wzexplorer.ObjectTypeUOL:
+		return jsonObject{{"$uol", o.String()}}
+	case wzexplorer.ObjectTypeVector:
+		p := o.Vector()
+		return jsonObject{{"x", p.X}, {"y", p.Y}}
+	case wzexplorer.ObjectTypeSound:
+		s := o.Sound()
+		m := s.Media()
+		return jsonObject{{"$sound", jsonObject{
+			{"kind", m.Kind().String()},
+			{"formatTag", m.Format.FormatTag},
+			{"channels", m.Format.Channels},
+			{"sampleRate", m.Format.SamplesPerSec},
+			{"durationMs", s.Duration().Milliseconds()},
+		}}}
+	}
+	return nil
+}
+
+// toJSON converts o and its subtree up to depth levels, depth 0 means unlimited
+func toJSON(o wzexplorer.Object, depth int) (interface{}, error) {
+	if !container(o) {
+		return scalar(o), nil
+	}
+
+	var obj jsonObject
+	if o.Type() == wzexplorer.ObjectTypeCanvas {
+		c := o.Canvas()
+		size := c.Size()
+		obj = append(obj, jsonField{"$canvas", jsonObject{
+			{"width", size.X},
+			{"height", size.Y},
+			{"format", c.Format().String()},
+		}})
+	}
+	if depth == 1 {
+		return obj, nil
+	}
+
+	list, err := children(o)
+	if err != nil {
+		return nil, err
+	}
+	next := depth - 1
+	if depth == 0 {
+		next = 0
+	}
+	for _, c := range list {
+		v, err := toJSON(c.obj, next)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, jsonField{c.name, v})
+	}
+	if obj == nil {
+		obj = jsonObject{}
+	}
+	return obj, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"os"
+	"strings"
+	"time"
+)
+
+// exit codes are stable for scripting
+const (
+	ExitOK = iota
+	ExitError
+	ExitUsage
+	ExitOpen
+	ExitNotFound
+	ExitCorrupt
+)
+
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func exit(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+var errNotFound = errors.New("path not found")
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []*command
+
+func register(name, usage string, run func(args []string) error) {
+	commands = append(commands, &command{name: name, usage: usage, run: run})
+}
+
+type options struct {
+	version int
+	iv      string
+	// cache decoded cache budget in MiB, 0 keeps the library default
+	cache int64
+	// unload images idle this long, 0 keeps them loaded
+	unload time.Duration
+}
+
+func newFlagSet(name string, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.IntVar(&opts.version, "version", 79, "client version")
+	fs.StringVar(&opts.iv, "iv", "ems", "iv: gms, ems, empty or 8 hex digits")
+	return fs
+}
+
+func parseIv(iv string) ([]byte, error) {
+	switch strings.ToLower(iv) {
+	case "gms":
+		return wzexplorer.IvGMS, nil
+	case "ems":
+		return wzexplorer.IvEMS, nil
+	case "empty", "none", "":
+		return wzexplorer.IvEmpty, nil
+	}
+	return hex.DecodeString(iv)
+}
+
+// open opens a single wz file or a base directory
+func open(opts *options, filename string) (wzexplorer.File, error) {
+	iv, err := parseIv(opts.iv)
+	if err != nil {
+		return nil, exit(ExitUsage, err)
+	}
+	cp, err := wzexplorer.NewCryptProvider(opts.version, iv)
+	if err != nil {
+		return nil, exit(ExitUsage, err)
+	}
+	if opts.cache > 0 {
+		cp.SetCache(wzexplorer.NewLRUCache(opts.cache << 20))
+	}
+
+	s, err := os.Stat(filename)
+	if err != nil {
+		return nil, exit(ExitOpen, err)
+	}
+
+	var f wzexplorer.File
+	if s.IsDir() {
+		f, err = wzexplorer.NewBase(cp, filename)
+	} else {
+		f, err = wzexplorer.NewFile(cp, filename)
+	}
+	if err != nil {
+		return nil, exit(ExitOpen, err)
+	}
+	return f, nil
+}
+
+// autoUnload unloads images of f idle this long until stop, stop waits for a running sweep
+func autoUnload(f wzexplorer.File, idle time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := wzexplorer.AutoUnload(ctx, f, idle)
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func get(root wzexplorer.GetObject, path string) (wzexplorer.Object, error) {
+	o, err := root.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, exit(ExitNotFound, fmt.Errorf("%s: %w", path, errNotFound))
+	}
+	return o, nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wzexplorer <command> [flags] <archive> [args]")
+	fmt.Fprintln(os.Stderr, "\narchive is a .wz file or a directory holding Base.wz or Base/\n\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nexit codes: %d ok, %d error, %d usage, %d open failed, %d path not found, %d corrupt\n",
+		ExitOK, ExitError, ExitUsage, ExitOpen, ExitNotFound, ExitCorrupt)
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return exit(ExitUsage, errors.New("missing command"))
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	usage()
+	return exit(ExitUsage, fmt.Errorf("unknown command %q", args[0]))
+}
+
+func main() {
+	err := run(os.Args[1:])
+	if err == nil {
+		return
+	}
+	code := ExitError
+	var e *exitError
+	if errors.As(err, &e) {
+		code = e.code
+	}
+	if !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "wzexplorer:", err)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/wzindex"
+	"os"
+	gopath "path"
+	"time"
+)
+
+func init() {
+	register("index", "<archive> [path] -o <file> [-v]  build a search index", cmdIndex)
+	register("search", "<index> <pattern> [--prefix|--exact|--regex] [--name] [--value] [--path] [-i] [--under path] [--limit n] [--format text|json]  query a search index", cmdSearch)
+}
+
+func cmdIndex(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("index", opts)
+	out := fs.String("o", "", "index file, - for stdout")
+	verbose := fs.Bool("v", false, "print every image while indexing")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return exit(ExitUsage, errors.New("index: -o is required"))
+	}
+	f, o, err := openPath(opts, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var root wzexplorer.GetObject = f
+	prefix := "/"
+	if len(args) > 1 {
+		root, prefix = o, gopath.Join("/", args[1])
+	}
+
+	bo := &wzindex.BuildOptions{Root: prefix}
+	if *verbose {
+		bo.Progress = func(p string) {
+			fmt.Fprintln(os.Stderr, gopath.Join(prefix, p))
+		}
+	}
+	w, err := create(*out)
+	if err != nil {
+		return err
+	}
+	if err = wzindex.Build(root, w, bo); err != nil {
+		_ = w.Close()
+		if *out != "-" {
+			_ = os.Remove(*out)
+		}
+		return err
+	}
+	return w.Close()
+}
+
+func cmdSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	prefix := fs.Bool("prefix", false, "match the start of names and values")
+	exact := fs.Bool("exact", false, "match whole names and values")
+	regex := fs.Bool("regex", false, "pattern is a regular expression")
+	name := fs.Bool("name", false, "match names")
+	value := fs.Bool("value", false, "match scalar values")
+	path := fs.Bool("path", false, "match paths below the index root, starting with /")
+	ignoreCase := fs.Bool("i", false, "ignore case")
+	under := fs.String("under", "", "only report hits below this path")
+	limit := fs.Int("limit", 0, "report at most n hits, 0 for all")
+	format := fs.String("format", "text", "output format: text or json")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	q := wzindex.Query{Pattern: args[1], IgnoreCase: *ignoreCase, Limit: *limit}
+	n := 0
+	for _, m := range []struct {
+		set   bool
+		match wzindex.Match
+	}{{*prefix, wzindex.MatchPrefix}, {*exact, wzindex.MatchExact}, {*regex, wzindex.MatchRegex}} {
+		if m.set {
+			q.Match = m.match
+			n++
+		}
+	}
+	if n > 1 {
+		return exit(ExitUsage, errors.New("search: --prefix, --exact and --regex are exclusive"))
+	}
+	if *name {
+		q.Fields |= wzindex.FieldName
+	}
+	if *value {
+		q.Fields |= wzindex.FieldValue
+	}
+	if *path {
+		q.Fields |= wzindex.FieldPath
+	}
+	if *format != "text" && *format != "json" {
+		return exit(ExitUsage, fmt.Errorf("unknown format %q", *format))
+	}
+
+	ix, err := wzindex.Open(args[0])
+	if err != nil {
+		return exit(ExitOpen, err)
+	}
+	if *under != "" {
+		// hits and --under are relative to the archive, the index may start deeper
+		rel, ok := relative(ix.Root(), *under)
+		if !ok {
+			return exit(ExitNotFound, fmt.Errorf("%s: %w", *under, errNotFound))
+		}
+		q.Under = rel
+	}
+
+	start := time.Now()
+	hits, err := ix.Search(q)
+	if errors.Is(err, wzindex.ErrNotIndexed) {
+		return exit(ExitNotFound, fmt.Errorf("%s: %w", *under, errNotFound))
+	} else if err != nil {
+		return exit(ExitUsage, err)
+	}
+	elapsed := time.Since(start)
+
+	if *format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if hits == nil {
+			hits = []*wzindex.Hit{}
+		}
+		return e.Encode(hits)
+	}
+	for _, h := range hits {
+		fmt.Printf("%-12s %s\t%s\n", h.Type, h.Path, h.Value)
+	}
+	fmt.Fprintf(os.Stderr, "%d hits in %s\n", len(hits), elapsed.Round(time.Microsecond))
+	return nil
+}
+
+// relative returns p below root, false when p lies outside it
+func relative(root, p string) (string, bool) {
+	root, p = gopath.Join("/", root), gopath.Join("/", p)
+	switch {
+	case root == "/":
+		return p, true
+	case p == root:
+		return "/", true
+	case len(p) > len(root) && p[:len(root)] == root && p[len(root)] == '/':
+		return p[len(root):], true
+	}
+	return "", false
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"github.com/anonymous5l/wzexplorer"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+func init() {
+	register("serve", "[--addr :8080] <archive>  browse the archive over http", cmdServe)
+}
+
+// server every handler reads through the shared root, the library serializes blob access
+type server struct {
+	root    wzexplorer.File
+	modTime time.Time
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", s.api)
+	mux.HandleFunc("/img/", s.img)
+	mux.HandleFunc("/snd/", s.snd)
+	mux.HandleFunc("/", s.index)
+	return mux
+}
+
+// lookup resolves the request path below prefix, writes the error response on failure
+func (s *server) lookup(w http.ResponseWriter, r *http.Request, prefix string) (wzexplorer.Object, string, bool) {
+	p := path.Clean("/" + strings.TrimPrefix(r.URL.Path, prefix))
+	o, err := get(s.root, p)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, p, false
+	}
+	return o, p, true
+}
+
+type apiChild struct {
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Container bool        `json:"container"`
+	Value     interface{} `json:"value,omitempty"`
+}
+
+type apiObject struct {
+	Path     string      `json:"path"`
+	Type     string      `json:"type"`
+	Value    interface{} `json:"value,omitempty"`
+	Children []apiChild  `json:"children"`
+}
+
+// value returns the scalar value of o or a short canvas description
+func value(o wzexplorer.Object) interface{} {
+	if o.Type() == wzexplorer.ObjectTypeCanvas {
+		c := o.Canvas()
+		size := c.Size()
+		return jsonObject{
+			{"width", size.X},
+			{"height", size.Y},
+			{"format", c.Format().String()},
+		}
+	}
+	if container(o) {
+		return nil
+	}
+	return scalar(o)
+}
+
+func (s *server) api(w http.ResponseWriter, r *http.Request) {
+	o, p, ok := s.lookup(w, r, "/api")
+	if !ok {
+		return
+	}
+	list, err := children(o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := &apiObject{
+		Path:     p,
+		Type:     o.Type().String(),
+		Value:    value(o),
+		Children: make([]apiChild, 0, len(list)),
+	}
+	for _, c := range list {
+		res.Children = append(res.Children, apiChild{
+			Name:      c.name,
+			Type:      c.obj.Type().String(),
+			Container: container(c.obj),
+			Value:     value(c.obj),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		log.Println("api:", err)
+	}
+}
+
+func (s *server) img(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, ".png") {
+		http.NotFound(w, r)
+		return
+	}
+	r.URL.Path = strings.TrimSuffix(r.URL.Path, ".png")
+	o, p, ok := s.lookup(w, r, "/img")
+	if !ok {
+		return
+	}
+	if o.Type() != wzexplorer.ObjectTypeCanvas {
+		http.Error(w, p+": not a canvas", http.StatusBadRequest)
+		return
+	}
+	img, err := o.Canvas().Image()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = png.Encode(buf, img); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, path.Base(p)+".png", s.modTime, bytes.NewReader(buf.Bytes()))
+}
+
+// snd serves the sound as stored, ?wav=1 forces a decoded wav
+func (s *server) snd(w http.ResponseWriter, r *http.Request) {
+	o, p, ok := s.lookup(w, r, "/snd")
+	if !ok {
+		return
+	}
+	if o.Type() != wzexplorer.ObjectTypeSound {
+		http.Error(w, p+": not a sound", http.StatusBadRequest)
+		return
+	}
+	sound := o.Sound()
+	wav := r.URL.Query().Get("wav") != ""
+	rs, err := openSound(sound, wav)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rs.Close()
+
+	ext := soundExt(sound, wav)
+	if ext == ".mp3" {
+		w.Header().Set("Content-Type", "audio/mpeg")
+	} else {
+		w.Header().Set("Content-Type", "audio/wav")
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, path.Base(p)+ext, s.modTime, rs)
+}
+
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "index.html", time.Time{}, bytes.NewReader(indexHTML))
+}
+
+func cmdServe(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("serve", opts)
+	fs.Int64Var(&opts.cache, "cache", 0, "decoded image and sound cache in MiB, 0 keeps the default")
+	fs.DurationVar(&opts.unload, "unload", 0, "unload images idle this long, 0 never")
+	addr := fs.String("addr", ":8080", "listen address")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := open(opts, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if opts.unload > 0 {
+		defer autoUnload(f, opts.unload)()
+	}
+
+	s := &server{root: f, modTime: time.Now()}
+	if st, err := os.Stat(args[0]); err == nil {
+		s.modTime = st.ModTime()
+	}
+
+	log.Printf("serving %s on %s", args[0], *addr)
+	return http.ListenAndServe(*addr, s.handler())
+}
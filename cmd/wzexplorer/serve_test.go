@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testServer(t *testing.T, bgm []byte) *httptest.Server {
+	t.Helper()
+	b := wztest.New(wzexplorer.IvEmpty)
+	archive := b.Write(t, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "name", Value: "snail"},
+		wztest.Prop{Name: "icon", Value: b.Canvas(2, 1, int32(wzexplorer.CanvasFormatBGRA8888), []byte{0xff, 0, 0, 0xff, 0, 0xff, 0, 0x80})},
+		wztest.Prop{Name: "bgm", Value: b.Sound(bgm)},
+	)})
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	ts := httptest.NewServer((&server{root: f, modTime: time.Unix(0, 0)}).handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func fetch(t *testing.T, ts *httptest.Server, path string, header ...string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, body
+}
+
+func TestServeAPI(t *testing.T) {
+	ts := testServer(t, make([]byte, 4))
+	res, body := fetch(t, ts, "/api/a")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("status %d content type %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var obj struct {
+		Path     string
+		Type     string
+		Children []struct {
+			Name      string
+			Type      string
+			Container bool
+			Value     interface{}
+		}
+	}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Path != "/a" || obj.Type != "Properties" || len(obj.Children) != 3 {
+		t.Fatalf("object %+v", obj)
+	}
+	name, icon, bgm := obj.Children[0], obj.Children[1], obj.Children[2]
+	if name.Name != "name" || name.Type != "String" || name.Container || name.Value != "snail" {
+		t.Errorf("name %+v", name)
+	}
+	want := map[string]interface{}{"width": 2.0, "height": 1.0, "format": "BGRA8888"}
+	if v, ok := icon.Value.(map[string]interface{}); icon.Type != "Canvas" || !icon.Container || !ok ||
+		v["width"] != want["width"] || v["height"] != want["height"] || v["format"] != want["format"] {
+		t.Errorf("icon %+v", icon)
+	}
+	if bgm.Type != "Sound" || bgm.Container {
+		t.Errorf("bgm %+v", bgm)
+	}
+
+	for path, status := range map[string]int{
+		"/api/missing": http.StatusNotFound,
+		"/api/a/name":  http.StatusOK,
+		"/api/a/":      http.StatusOK,
+	} {
+		if res, _ := fetch(t, ts, path); res.StatusCode != status {
+			t.Errorf("%s: status %d, want %d", path, res.StatusCode, status)
+		}
+	}
+}
+
+func TestServePNG(t *testing.T) {
+	ts := testServer(t, make([]byte, 4))
+	res, body := fetch(t, ts, "/img/a/icon.png")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("status %d content type %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != (color.NRGBA{B: 0xff, A: 0xff}) {
+		t.Errorf("(0, 0) = %v", got)
+	}
+	if got := color.NRGBAModel.Convert(img.At(1, 0)); got != (color.NRGBA{G: 0xff, A: 0x80}) {
+		t.Errorf("(1, 0) = %v", got)
+	}
+
+	for path, status := range map[string]int{
+		"/img/a/icon":        http.StatusNotFound,
+		"/img/a/missing.png": http.StatusNotFound,
+		"/img/a/name.png":    http.StatusBadRequest,
+	} {
+		if res, _ := fetch(t, ts, path); res.StatusCode != status {
+			t.Errorf("%s: status %d, want %d", path, res.StatusCode, status)
+		}
+	}
+}
+
+func TestServeSound(t *testing.T) {
+	bgm := []byte{1, 2, 3, 4, 5}
+	ts := testServer(t, bgm)
+	res, body := fetch(t, ts, "/snd/a/bgm")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "audio/wav" {
+		t.Fatalf("status %d content type %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	// pcm gets a wav header and a pad byte after odd sized data
+	if len(body) != 44+len(bgm)+1 || string(body[:4]) != "RIFF" || !bytes.Equal(body[44:49], bgm) {
+		t.Errorf("body %x", body)
+	}
+
+	res, body = fetch(t, ts, "/snd/a/bgm", "Range", "bytes=45-47")
+	if res.StatusCode != http.StatusPartialContent || !bytes.Equal(body, bgm[1:4]) {
+		t.Errorf("range status %d body %x, want %x", res.StatusCode, body, bgm[1:4])
+	}
+
+	for path, status := range map[string]int{
+		"/snd/a/missing": http.StatusNotFound,
+		"/snd/a/name":    http.StatusBadRequest,
+	} {
+		if res, _ := fetch(t, ts, path); res.StatusCode != status {
+			t.Errorf("%s: status %d, want %d", path, res.StatusCode, status)
+		}
+	}
+}
+
+func TestServeIndex(t *testing.T) {
+	ts := testServer(t, make([]byte, 4))
+	if res, body := fetch(t, ts, "/"); res.StatusCode != http.StatusOK || !bytes.Equal(body, indexHTML) {
+		t.Errorf("index status %d", res.StatusCode)
+	}
+	if res, _ := fetch(t, ts, "/other"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("/other status %d, want 404", res.StatusCode)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	register("shell", "<archive>  interactive shell", cmdShell)
+}
+
+type shell struct {
+	root    wzexplorer.File
+	cwd     string
+	out     io.Writer
+	history []string
+}
+
+type shellCommand struct {
+	usage string
+	run   func(s *shell, args []string) error
+}
+
+var shellCommands map[string]*shellCommand
+
+func init() {
+	shellCommands = map[string]*shellCommand{
+		"cd":      {"cd [path]", (*shell).cd},
+		"ls":      {"ls [path]", (*shell).ls},
+		"pwd":     {"pwd", (*shell).pwd},
+		"cat":     {"cat <path>", (*shell).cat},
+		"tree":    {"tree [path] [depth]", (*shell).tree},
+		"find":    {"find <pattern> [path]", (*shell).find},
+		"export":  {"export <path> [dir]", (*shell).export},
+		"history": {"history", (*shell).printHistory},
+		"help":    {"help", (*shell).help},
+	}
+}
+
+func (s *shell) resolve(p string) string {
+	if p == "" {
+		return s.cwd
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(s.cwd, p)
+	}
+	return path.Clean(p)
+}
+
+func (s *shell) get(p string) (wzexplorer.Object, error) {
+	return get(s.root, s.resolve(p))
+}
+
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+func (s *shell) cd(args []string) error {
+	p := s.resolve(arg(args, 0))
+	if arg(args, 0) == "" {
+		p = "/"
+	}
+	o, err := get(s.root, p)
+	if err != nil {
+		return err
+	}
+	if !container(o) {
+		return fmt.Errorf("%s: not a container", p)
+	}
+	s.cwd = p
+	return nil
+}
+
+func (s *shell) ls(args []string) error {
+	o, err := s.get(arg(args, 0))
+	if err != nil {
+		return err
+	}
+	return printList(s.out, o)
+}
+
+func (s *shell) pwd([]string) error {
+	_, err := fmt.Fprintln(s.out, s.cwd)
+	return err
+}
+
+func (s *shell) cat(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: " + shellCommands["cat"].usage)
+	}
+	o, err := s.get(args[0])
+	if err != nil {
+		return err
+	}
+	return printObject(s.out, o, 0)
+}
+
+func (s *shell) tree(args []string) error {
+	o, err := s.get(arg(args, 0))
+	if err != nil {
+		return err
+	}
+	depth := 2
+	if d := arg(args, 1); d != "" {
+		if _, err = fmt.Sscan(d, &depth); err != nil {
+			return err
+		}
+	}
+	return printTree(s.out, o, "", depth)
+}
+
+func walk(o wzexplorer.Object, p string, cb func(string, wzexplorer.Object) error) error {
+	list, err := children(o)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		cp := path.Join(p, c.name)
+		if err = cb(cp, c.obj); err != nil {
+			return err
+		}
+		if err = walk(c.obj, cp, cb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shell) find(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: " + shellCommands["find"].usage)
+	}
+	pattern := strings.ToLower(args[0])
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	start := s.resolve(arg(args, 1))
+	o, err := get(s.root, start)
+	if err != nil {
+		return err
+	}
+	return walk(o, start, func(p string, obj wzexplorer.Object) error {
+		if ok, _ := path.Match(pattern, strings.ToLower(path.Base(p))); ok {
+			fmt.Fprintf(s.out, "%s\t%s\n", p, obj.Type())
+		}
+		return nil
+	})
+}
+
+func (s *shell) export(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: " + shellCommands["export"].usage)
+	}
+	p := s.resolve(args[0])
+	o, err := get(s.root, p)
+	if err != nil {
+		return err
+	}
+	dir := arg(args, 1)
+	if dir == "" {
+		dir = "."
+	}
+	name := path.Base(p)
+	if name == "/" {
+		name = "root"
+	}
+	dst := filepath.Join(dir, name)
+	if err = extract(o, dst, wzexplorer.ObjectTypeDirectory); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(s.out, "exported", p, "to", dst)
+	return err
+}
+
+func (s *shell) printHistory([]string) error {
+	for i, h := range s.history {
+		fmt.Fprintf(s.out, "%4d  %s\n", i+1, h)
+	}
+	return nil
+}
+
+func (s *shell) help([]string) error {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "  %s\n", shellCommands[name].usage)
+	}
+	_, err := fmt.Fprintln(s.out, "  exit")
+	return err
+}
+
+// exec runs a single line, returns io.EOF on exit
+func (s *shell) exec(line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	s.history = append(s.history, line)
+	if args[0] == "exit" || args[0] == "quit" {
+		return io.EOF
+	}
+	c, ok := shellCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("%s: unknown command, try help", args[0])
+	}
+	return c.run(s, args[1:])
+}
+
+// complete completes the last word of line with child names
+func (s *shell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	head, tail := line[:pos], line[pos:]
+	start := strings.LastIndex(head, " ") + 1
+	word := head[start:]
+
+	var candidates []string
+	if start == 0 {
+		for name := range shellCommands {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name+" ")
+			}
+		}
+	} else {
+		dir, prefix := path.Split(word)
+		o, err := get(s.root, s.resolve(dir))
+		if err != nil {
+			return "", 0, false
+		}
+		list, err := children(o)
+		if err != nil {
+			return "", 0, false
+		}
+		for _, c := range list {
+			if strings.HasPrefix(c.name, prefix) {
+				name := dir + c.name
+				if container(c.obj) {
+					name += "/"
+				}
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			// trim whole runes so names aren't cut inside a utf-8 sequence
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if len(common) <= len(word) {
+		return "", 0, false
+	}
+	head = head[:start] + common
+	return head + tail, len(head), true
+}
+
+func (s *shell) prompt() string {
+	return "wz:" + s.cwd + "> "
+}
+
+func (s *shell) runTerminal() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, s.prompt())
+	t.AutoCompleteCallback = s.complete
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		_ = t.SetSize(w, h)
+	}
+	s.out = t
+
+	for {
+		line, err := t.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err = s.exec(line); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			fmt.Fprintln(t, "error:", err)
+		}
+		t.SetPrompt(s.prompt())
+	}
+}
+
+// runScript reads commands from non terminal input, the first error stops it
+func (s *shell) runScript(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := s.exec(scanner.Text()); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func cmdShell(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("shell", opts)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := open(opts, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := &shell{root: f, cwd: "/", out: os.Stdout}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return s.runTerminal()
+	}
+	return s.runScript(os.Stdin)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testShell(t *testing.T) (*shell, *bytes.Buffer) {
+	t.Helper()
+	b := wztest.New(wzexplorer.IvEmpty)
+	archive := b.Write(t,
+		wztest.Entry{Name: "Mob", Dir: []wztest.Entry{
+			{Name: "0100100.img", Image: b.Properties(
+				wztest.Prop{Name: "info", Value: b.Properties(wztest.Prop{Name: "level", Value: int32(1)})},
+				wztest.Prop{Name: "stand", Value: b.Properties()},
+				wztest.Prop{Name: "k", Value: b.Properties(
+					wztest.Prop{Name: "가", Value: "ga"},
+					wztest.Prop{Name: "각", Value: "gak"},
+				)},
+				wztest.Prop{Name: "h", Value: b.Properties(
+					wztest.Prop{Name: "한a", Value: "a"},
+					wztest.Prop{Name: "한b", Value: "b"},
+				)},
+			)},
+			{Name: "0100101.img", Image: b.Properties()},
+		}},
+		wztest.Entry{Name: "String.img", Image: b.Properties(wztest.Prop{Name: "name", Value: "snail"})},
+	)
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	out := &bytes.Buffer{}
+	return &shell{root: f, cwd: "/", out: out}, out
+}
+
+func TestShellExec(t *testing.T) {
+	s, out := testShell(t)
+	for _, c := range []struct {
+		line, cwd, output string
+	}{
+		{"cd Mob/0100100", "/Mob/0100100", ""},
+		{"pwd", "/Mob/0100100", "/Mob/0100100\n"},
+		{"cat info/level", "/Mob/0100100", "1"},
+		{"ls info", "/Mob/0100100", "level"},
+		{"cd ..", "/Mob", ""},
+		{"find *100 /", "/Mob", "/Mob/0100100\t"},
+		{"tree 0100100 2", "/Mob", "    └── 한b [String] = b\n"},
+		{"cd", "/", ""},
+		{"   ", "/", ""},
+	} {
+		out.Reset()
+		if err := s.exec(c.line); err != nil {
+			t.Fatalf("%q: %v", c.line, err)
+		}
+		if s.cwd != c.cwd {
+			t.Errorf("%q: cwd %s, want %s", c.line, s.cwd, c.cwd)
+		}
+		if !strings.Contains(out.String(), c.output) {
+			t.Errorf("%q: output %q doesn't contain %q", c.line, out.String(), c.output)
+		}
+	}
+
+	for _, line := range []string{"cd String/name", "cd missing", "cat", "bogus", "find [", "tree / x"} {
+		if err := s.exec(line); err == nil {
+			t.Errorf("%q succeeded", line)
+		}
+	}
+	if s.cwd != "/" {
+		t.Errorf("failed commands moved cwd to %s", s.cwd)
+	}
+	var e *exitError
+	if err := s.exec("cd missing"); !errors.As(err, &e) || e.code != ExitNotFound {
+		t.Errorf("missing path error %v, want not found", err)
+	}
+
+	out.Reset()
+	if err := s.exec("history"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "   1  cd Mob/0100100\n") || strings.Contains(out.String(), "   \n") {
+		t.Errorf("history %q", out.String())
+	}
+	for _, line := range []string{"exit", "quit"} {
+		if err := s.exec(line); err != io.EOF {
+			t.Errorf("%q = %v, want io.EOF", line, err)
+		}
+	}
+}
+
+func TestShellRunScript(t *testing.T) {
+	s, out := testShell(t)
+	if err := s.runScript(strings.NewReader("cd String\ncat name\nexit\ncat missing\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "snail") {
+		t.Errorf("output %q", out.String())
+	}
+
+	// the first error stops the script
+	s, out = testShell(t)
+	if err := s.runScript(strings.NewReader("cd missing\npwd\n")); err == nil {
+		t.Error("failing script succeeded")
+	}
+	if out.Len() != 0 {
+		t.Errorf("script went on after an error: %q", out.String())
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	s, _ := testShell(t)
+	s.cwd = "/Mob/0100100"
+	for _, c := range []struct {
+		line string
+		pos  int
+		want string
+		ok   bool
+	}{
+		// commands
+		{"hi", 2, "history ", true},
+		{"c", 1, "", false},
+		// children, containers get a slash
+		{"ls i", 4, "ls info/", true},
+		{"cat info/l", 10, "cat info/level", true},
+		{"ls /M", 5, "ls /Mob/", true},
+		{"ls /Mob/0", 9, "ls /Mob/010010", true},
+		// the completion is inserted at the cursor
+		{"ls s tail", 4, "ls stand/ tail", true},
+		// 가 and 각 share their first two utf-8 bytes but no rune
+		{"cat k/", 6, "", false},
+		{"cat h/", 6, "cat h/한", true},
+		{"ls missing/", 11, "", false},
+	} {
+		line, pos, ok := s.complete(c.line, c.pos, '\t')
+		if ok != c.ok || line != c.want {
+			t.Errorf("complete(%q, %d) = %q, %v, want %q, %v", c.line, c.pos, line, ok, c.want, c.ok)
+		}
+		if want := len(c.want) - len(c.line[c.pos:]); ok && pos != want {
+			t.Errorf("complete(%q, %d) cursor %d, want %d", c.line, c.pos, pos, want)
+		}
+	}
+	if _, _, ok := s.complete("hi", 2, 'x'); ok {
+		t.Error("completed on a key other than tab")
+	}
+}
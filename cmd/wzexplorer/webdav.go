@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"github.com/anonymous5l/wzexplorer"
+	"golang.org/x/net/webdav"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+func init() {
+	register("webdav", "[--addr :8081] <archive>  mount the archive read only over webdav", cmdWebDAV)
+}
+
+// davFS read only webdav.FileSystem over the archive fs view
+type davFS struct {
+	wz      *wzexplorer.FS
+	fs      http.FileSystem
+	modTime time.Time
+}
+
+func newDavFS(wz *wzexplorer.FS, modTime time.Time) *davFS {
+	return &davFS{wz: wz, fs: http.FS(wz), modTime: modTime}
+}
+
+// davInfo reports the archive modification time, objects have none of their own
+type davInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (i davInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+// davFile http.File never accepts writes
+type davFile struct {
+	http.File
+	modTime time.Time
+}
+
+func (f davFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return davInfo{info, f.modTime}, nil
+}
+
+func (f davFile) Readdir(count int) ([]os.FileInfo, error) {
+	list, err := f.File.Readdir(count)
+	for i := range list {
+		list[i] = davInfo{list[i], f.modTime}
+	}
+	return list, err
+}
+
+func (davFile) Write([]byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// open clients may send directories with a trailing slash, io/fs paths never have one
+func (d *davFS) open(name string) (http.File, error) {
+	return d.fs.Open(path.Clean("/" + name))
+}
+
+func (d *davFS) Mkdir(context.Context, string, os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	info, err := d.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		// PROPFIND opens every entry only to stat it, content waits for the first read
+		return &lazyFile{d: d, name: name, info: info}, nil
+	}
+	f, err := d.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return davFile{f, d.modTime}, nil
+}
+
+// lazyFile opens the file content on the first read or seek, a png is encoded only when fetched
+type lazyFile struct {
+	d    *davFS
+	name string
+	info os.FileInfo
+	f    http.File
+}
+
+func (f *lazyFile) content() (http.File, error) {
+	if f.f == nil {
+		r, err := f.d.open(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.f = r
+	}
+	return f.f, nil
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	r, err := f.content()
+	if err != nil {
+		return 0, err
+	}
+	return r.Read(p)
+}
+
+func (f *lazyFile) Seek(offset int64, whence int) (int64, error) {
+	r, err := f.content()
+	if err != nil {
+		return 0, err
+	}
+	return r.Seek(offset, whence)
+}
+
+func (f *lazyFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *lazyFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (*lazyFile) Write([]byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f *lazyFile) Close() error {
+	if f.f == nil {
+		return nil
+	}
+	return f.f.Close()
+}
+
+func (d *davFS) RemoveAll(context.Context, string) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) Rename(context.Context, string, string) error {
+	return os.ErrPermission
+}
+
+// Stat skips opening the file, PROPFIND stats every entry of a directory
+func (d *davFS) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := d.wz.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return davInfo{info, d.modTime}, nil
+}
+
+func cmdWebDAV(args []string) error {
+	opts := &options{}
+	fs := newFlagSet("webdav", opts)
+	fs.Int64Var(&opts.cache, "cache", 0, "decoded image and sound cache in MiB, 0 keeps the default")
+	fs.DurationVar(&opts.unload, "unload", 0, "unload images idle this long, 0 never")
+	addr := fs.String("addr", ":8081", "listen address")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := open(opts, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if opts.unload > 0 {
+		defer autoUnload(f, opts.unload)()
+	}
+
+	dav := newDavFS(wzexplorer.NewFS(f), time.Now())
+	if st, err := os.Stat(args[0]); err == nil {
+		dav.modTime = st.ModTime()
+	}
+
+	log.Printf("webdav %s on %s", args[0], *addr)
+	return http.ListenAndServe(*addr, dav.handler())
+}
+
+// handler serves dav read only
+func (d *davFS) handler() http.Handler {
+	h := &webdav.Handler{
+		FileSystem: d,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !os.IsNotExist(err) {
+				log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// reject writes before the handler takes locks for them
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "PROPFIND", "LOCK", "UNLOCK":
+		default:
+			http.Error(w, "read only", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDavFSStat(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	archive := b.Write(t, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "name", Value: "town"},
+	)})
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	dav := newDavFS(wzexplorer.NewFS(f), modTime)
+	for name, dir := range map[string]bool{"": true, "/": true, "/a/": true, "a/name": false} {
+		info, err := dav.Stat(context.Background(), name)
+		if err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		if info.IsDir() != dir || !info.ModTime().Equal(modTime) {
+			t.Errorf("%q: dir %v mod %s", name, info.IsDir(), info.ModTime())
+		}
+	}
+	if info, _ := dav.Stat(context.Background(), "a/name"); info.Size() != 4 {
+		t.Errorf("size %d", info.Size())
+	}
+	if _, err = dav.Stat(context.Background(), "a/missing"); !os.IsNotExist(err) {
+		t.Errorf("missing: %v", err)
+	}
+}
+
+func TestDavPropfindSkipsDecoding(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	archive := b.Write(t, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "name", Value: "town"},
+		// Image fails on this canvas, listing it must not call Image
+		wztest.Prop{Name: "broken", Value: b.CanvasData(2, 1, 2, 0, []byte("not zlib"))},
+	)})
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ts := httptest.NewServer(newDavFS(wzexplorer.NewFS(f), time.Now()).handler())
+	defer ts.Close()
+	req, err := http.NewRequest("PROPFIND", ts.URL+"/a/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Depth", "1")
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("status %d: %s", res.StatusCode, body)
+	}
+	for _, want := range []string{"/a/broken.png", "<D:getcontentlength>0</D:getcontentlength>", "/a/name", "<D:getcontentlength>4</D:getcontentlength>"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("response doesn't contain %s:\n%s", want, body)
+		}
+	}
+
+	// content is still read on GET
+	if res, err = ts.Client().Get(ts.URL + "/a/name"); err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "town" {
+		t.Errorf("GET status %d body %q", res.StatusCode, body)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/a/new", strings.NewReader("x"))
+	if res, err = ts.Client().Do(req); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("PUT status %d, want 405", res.StatusCode)
+	}
+}
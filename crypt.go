@@ -6,6 +6,7 @@ import (
 	"crypto/cipher"
 	"errors"
 	"strconv"
+	"sync"
 )
 
 var (
@@ -89,10 +90,24 @@ func (c *Crypt) Transform(data []byte) {
 	}
 }
 
+// transformAt xors data as if it started offset bytes into a transformed buffer
+func (c *Crypt) transformAt(data []byte, offset int) {
+	if c.block != nil {
+		c.ExpandXorTable(offset + len(data))
+		xor := c.xor[offset:]
+		for i := range data {
+			data[i] ^= xor[i]
+		}
+	}
+}
+
 type CryptProvider struct {
 	version int
 	hash    int
 	crypt   *Crypt
+	// lock serializes blob reads and xor table expansion of every file sharing the provider
+	lock  sync.Mutex
+	cache Cache
 }
 
 func NewCryptProvider(version int, iv []byte) (*CryptProvider, error) {
@@ -104,6 +119,7 @@ func NewCryptProvider(version int, iv []byte) (*CryptProvider, error) {
 	}
 
 	cp.crypt = crypt
+	cp.cache = NewLRUCache(DefaultCacheBudget)
 
 	asciiVersion := strconv.FormatInt(int64(version), 10)
 	for i := 0; i < len(asciiVersion); i++ {
@@ -113,6 +129,16 @@ func NewCryptProvider(version int, iv []byte) (*CryptProvider, error) {
 	return cp, nil
 }
 
+// SetCache replaces the cache of decoded images and sounds, nil disables caching,
+// call it before reading any file opened with the provider
+func (cp *CryptProvider) SetCache(c Cache) {
+	cp.cache = c
+}
+
+func (cp *CryptProvider) Cache() Cache {
+	return cp.cache
+}
+
 func (cp *CryptProvider) Verify(target uint16) error {
 	v := uint16(0xff)
 	for i := 0; i < 4; i++ {
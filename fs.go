@@ -0,0 +1,390 @@
+package wzexplorer
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS exposes an object tree as a read only fs.FS
+//
+// directories, images, properties and convexes are fs directories,
+// canvases are .png files, a canvas holding properties is also a directory of the same name without extension,
+// sounds are .mp3 or .wav files and every other property is a text file holding its value,
+// uol files hold the link instead of following it so walking never loops.
+// A png reports size 0 until it has been opened once, stat never decodes a canvas
+type FS struct {
+	root GetObject
+
+	lock sync.Mutex
+	// sizes png sizes known from earlier opens, keyed by position so sizes survive Unload
+	sizes map[CacheKey]int64
+}
+
+var (
+	_ fs.FS        = (*FS)(nil)
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// NewFS root is usually a File returned by NewFile or NewBase
+func NewFS(root GetObject) *FS {
+	return &FS{root: root, sizes: make(map[CacheKey]int64)}
+}
+
+type fsKind byte
+
+const (
+	fsDir fsKind = iota
+	fsPNG
+	fsSound
+	fsText
+)
+
+type fsNode struct {
+	f    *FS
+	name string
+	kind fsKind
+	dir  GetObject
+	obj  Object
+}
+
+// soundFile returns the extension and reader of the file a sound is exposed as
+func soundFile(s Sound) (string, func() (io.ReadSeekCloser, error)) {
+	m := s.Media()
+	switch {
+	case m.Kind() == MediaKindMP3:
+		return ".mp3", s.Open
+	case m.Format.FormatTag != 0:
+		return ".wav", s.OpenWAV
+	}
+	return ".raw", s.Open
+}
+
+func hasChildren(o Object) (bool, error) {
+	found := false
+	err := o.Each(func(string, Object) error {
+		found = true
+		return EachInterrupt
+	})
+	return found, ErrInterrupt(err)
+}
+
+func (f *FS) entries(dir GetObject) ([]*fsNode, error) {
+	var nodes []*fsNode
+	err := dir.Each(func(name string, o Object) error {
+		switch o.Type() {
+		case ObjectTypeDirectory, ObjectTypeProperties, ObjectTypeConvex:
+			nodes = append(nodes, &fsNode{name: name, kind: fsDir, dir: o, obj: o})
+		case ObjectTypeCanvas:
+			nodes = append(nodes, &fsNode{name: name + ".png", kind: fsPNG, obj: o})
+			ok, err := hasChildren(o)
+			if err != nil {
+				return err
+			}
+			if ok {
+				nodes = append(nodes, &fsNode{name: name, kind: fsDir, dir: o, obj: o})
+			}
+		case ObjectTypeSound:
+			ext, _ := soundFile(o.Sound())
+			nodes = append(nodes, &fsNode{name: name + ext, kind: fsSound, obj: o})
+		default:
+			nodes = append(nodes, &fsNode{name: name, kind: fsText, obj: o})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		n.f = f
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].name < nodes[j].name
+	})
+	return nodes, nil
+}
+
+func (f *FS) lookup(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n := &fsNode{f: f, name: ".", kind: fsDir, dir: f.root}
+	if name == "." {
+		return n, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if n.kind != fsDir {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		entries, err := f.entries(n.dir)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		i := sort.Search(len(entries), func(i int) bool {
+			return entries[i].name >= elem
+		})
+		if i == len(entries) || entries[i].name != elem {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		n = entries[i]
+	}
+	return n, nil
+}
+
+func textValue(o Object) string {
+	switch o.Type() {
+	case ObjectTypeVariantNil:
+		return ""
+	case ObjectTypeVector:
+		p := o.Vector()
+		return strconv.Itoa(p.X) + "," + strconv.Itoa(p.Y)
+	}
+	return o.String()
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// open returns the content of a file node
+func (n *fsNode) open() (io.ReadSeekCloser, error) {
+	switch n.kind {
+	case fsText:
+		return nopCloser{strings.NewReader(textValue(n.obj))}, nil
+	case fsPNG:
+		img, err := n.obj.Canvas().Image()
+		if err != nil {
+			return nil, err
+		}
+		buf := bytes.NewBuffer(nil)
+		if err = png.Encode(buf, img); err != nil {
+			return nil, err
+		}
+		return nopCloser{bytes.NewReader(buf.Bytes())}, nil
+	case fsSound:
+		_, open := soundFile(n.obj.Sound())
+		return open()
+	}
+	return nil, errors.New("not a file")
+}
+
+func readerSize(r io.Seeker) (int64, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (n *fsNode) stat() (*fsInfo, error) {
+	if n.kind == fsDir {
+		return &fsInfo{n: n}, nil
+	}
+	if n.kind == fsText {
+		return &fsInfo{n: n, size: int64(len(textValue(n.obj)))}, nil
+	}
+	if n.kind == fsPNG {
+		// encoding every canvas of a listing is too slow, the size is known once it was opened
+		var size int64
+		if key, ok := n.key(); ok {
+			n.f.lock.Lock()
+			size = n.f.sizes[key]
+			n.f.lock.Unlock()
+		}
+		return &fsInfo{n: n, size: size}, nil
+	}
+
+	// sounds are read from the blob directly, measuring them reads nothing
+	r, err := n.open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	size, err := n.size(r)
+	if err != nil {
+		return nil, err
+	}
+	return &fsInfo{n: n, size: size}, nil
+}
+
+func (n *fsNode) key() (CacheKey, bool) {
+	o, ok := n.obj.(*object)
+	if !ok || o.f == nil {
+		return CacheKey{}, false
+	}
+	return CacheKey{File: o.f.filename, Offset: o.offset}, true
+}
+
+// size measures r and remembers the size of the node
+func (n *fsNode) size(r io.Seeker) (int64, error) {
+	size, err := readerSize(r)
+	if err != nil {
+		return 0, err
+	}
+	if key, ok := n.key(); ok && n.kind == fsPNG {
+		n.f.lock.Lock()
+		n.f.sizes[key] = size
+		n.f.lock.Unlock()
+	}
+	return size, nil
+}
+
+// fsInfo is both fs.FileInfo and fs.DirEntry, sizes of entries are computed on Info
+type fsInfo struct {
+	n    *fsNode
+	size int64
+}
+
+func (i *fsInfo) Name() string {
+	return i.n.name
+}
+
+func (i *fsInfo) Size() int64 {
+	return i.size
+}
+
+func (i *fsInfo) Mode() fs.FileMode {
+	if i.n.kind == fsDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (i *fsInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (i *fsInfo) IsDir() bool {
+	return i.n.kind == fsDir
+}
+
+func (i *fsInfo) Sys() interface{} {
+	return i.n.obj
+}
+
+func (i *fsInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i *fsInfo) Info() (fs.FileInfo, error) {
+	return i.n.stat()
+}
+
+func dirEntries(nodes []*fsNode) []fs.DirEntry {
+	list := make([]fs.DirEntry, len(nodes))
+	for i, n := range nodes {
+		list[i] = &fsInfo{n: n}
+	}
+	return list
+}
+
+type fsDirFile struct {
+	info    *fsInfo
+	entries []*fsNode
+	read    bool
+	offset  int
+}
+
+func (d *fsDirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *fsDirFile) Close() error {
+	return nil
+}
+
+func (d *fsDirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.info.n.f.entries(d.info.n.dir)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	rest := d.entries[d.offset:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if count < len(rest) {
+			rest = rest[:count]
+		}
+	}
+	d.offset += len(rest)
+	return dirEntries(rest), nil
+}
+
+type fsFile struct {
+	io.ReadSeekCloser
+	info *fsInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	n, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind == fsDir {
+		return &fsDirFile{info: &fsInfo{n: n}}, nil
+	}
+	r, err := n.open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	size, err := n.size(r)
+	if err != nil {
+		_ = r.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{ReadSeekCloser: r, info: &fsInfo{n: n, size: size}}, nil
+}
+
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind != fsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := f.entries(n.dir)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return dirEntries(entries), nil
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := n.stat()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
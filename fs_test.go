@@ -0,0 +1,86 @@
+package wzexplorer_test
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	b := wztest.New(wzexplorer.IvGMS)
+	f := openTest(t, b, wzexplorer.IvGMS,
+		wztest.Entry{Name: "Map", Dir: []wztest.Entry{
+			{Name: "100.img", Image: b.Properties(
+				wztest.Prop{Name: "name", Value: "town"},
+				wztest.Prop{Name: "id", Value: int32(100)},
+				wztest.Prop{Name: "rate", Value: 0.5},
+				wztest.Prop{Name: "none", Value: nil},
+				wztest.Prop{Name: "pos", Value: b.Vector(3, -4)},
+				wztest.Prop{Name: "link", Value: b.UOL("name")},
+			)},
+		}},
+		wztest.Entry{Name: "a.img", Image: b.Properties(
+			wztest.Prop{Name: "icon", Value: b.Canvas(2, 1, 2, []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				wztest.Prop{Name: "z", Value: int16(1)},
+			)},
+			wztest.Prop{Name: "plain", Value: b.Canvas(1, 1, 2, []byte{1, 2, 3, 4})},
+			wztest.Prop{Name: "bgm", Value: b.Sound(make([]byte, 64))},
+		)},
+	)
+
+	fsys := wzexplorer.NewFS(f)
+	if err := fstest.TestFS(fsys,
+		"Map/100/name", "Map/100/id", "Map/100/rate", "Map/100/none", "Map/100/pos", "Map/100/link",
+		"a/icon.png", "a/icon/z", "a/plain.png", "a/bgm.wav",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"Map/100/name": "town",
+		"Map/100/pos":  "3,-4",
+		"Map/100/link": "name",
+		"Map/100/none": "",
+	} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil || string(data) != want {
+			t.Errorf("%s: %q %v, want %q", name, data, err, want)
+		}
+	}
+	if _, err := fs.Stat(fsys, "a/plain"); err == nil {
+		t.Error("canvas without children is a directory")
+	}
+}
+
+func TestFSStatSkipsDecoding(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := openTest(t, b, wzexplorer.IvEmpty, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "icon", Value: b.Canvas(2, 1, 2, []byte{1, 2, 3, 4, 5, 6, 7, 8})},
+		// decoding fails, so stat must not decode
+		wztest.Prop{Name: "broken", Value: b.CanvasData(2, 1, 2, 0, []byte("not zlib"))},
+	)})
+	fsys := wzexplorer.NewFS(f)
+
+	for _, name := range []string{"a/icon.png", "a/broken.png"} {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if info.Size() != 0 {
+			t.Errorf("%s: size %d before opening, want 0", name, info.Size())
+		}
+	}
+	if _, err := fs.ReadFile(fsys, "a/broken.png"); err == nil {
+		t.Error("broken canvas opened")
+	}
+
+	data, err := fs.ReadFile(fsys, "a/icon.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fs.Stat(fsys, "a/icon.png"); err != nil || info.Size() != int64(len(data)) {
+		t.Errorf("size after opening %v, %v, want %d", info, err, len(data))
+	}
+}
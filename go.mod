@@ -2,4 +2,11 @@ module github.com/anonymous5l/wzexplorer
 
 go 1.20
 
-require golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
+require (
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	golang.org/x/exp v0.0.0-20230321023759-10a507213a29
+	golang.org/x/net v0.19.0
+	golang.org/x/term v0.15.0
+)
+
+require golang.org/x/sys v0.15.0 // indirect
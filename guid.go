@@ -0,0 +1,66 @@
+package wzexplorer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// GUID windows guid in memory layout
+type GUID [16]byte
+
+var (
+	GUIDNull = GUID{}
+	// MediaTypeStream MEDIATYPE_Stream
+	MediaTypeStream = mustParseGUID("e436eb83-524f-11ce-9f53-0020af0ba770")
+	// MediaTypeAudio MEDIATYPE_Audio
+	MediaTypeAudio = mustParseGUID("73647561-0000-0010-8000-00aa00389b71")
+	// MediaSubTypeMPEG1Audio MEDIASUBTYPE_MPEG1Audio
+	MediaSubTypeMPEG1Audio = mustParseGUID("e436eb87-524f-11ce-9f53-0020af0ba770")
+	// MediaSubTypeWAVE MEDIASUBTYPE_WAVE
+	MediaSubTypeWAVE = mustParseGUID("e436eb8b-524f-11ce-9f53-0020af0ba770")
+	// MediaSubTypePCM MEDIASUBTYPE_PCM
+	MediaSubTypePCM = mustParseGUID("00000001-0000-0010-8000-00aa00389b71")
+	// MediaSubTypeMP3 MEDIASUBTYPE_MP3
+	MediaSubTypeMP3 = mustParseGUID("00000055-0000-0010-8000-00aa00389b71")
+	// FormatTypeWaveFormatEx FORMAT_WaveFormatEx
+	FormatTypeWaveFormatEx = mustParseGUID("05589f81-c356-11ce-bf01-00aa0055595a")
+	// FormatTypeNone FORMAT_None
+	FormatTypeNone = mustParseGUID("0f6417d6-c318-11d0-a43f-00a0c9223196")
+)
+
+// ParseGUID parses the canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form
+func ParseGUID(s string) (g GUID, err error) {
+	raw, err := hex.DecodeString(strings.ReplaceAll(strings.Trim(s, "{}"), "-", ""))
+	if err != nil {
+		return
+	}
+	if len(raw) != 16 {
+		err = errors.New("invalid guid size")
+		return
+	}
+	binary.LittleEndian.PutUint32(g[0:], binary.BigEndian.Uint32(raw[0:]))
+	binary.LittleEndian.PutUint16(g[4:], binary.BigEndian.Uint16(raw[4:]))
+	binary.LittleEndian.PutUint16(g[6:], binary.BigEndian.Uint16(raw[6:]))
+	copy(g[8:], raw[8:])
+	return
+}
+
+func mustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+func (g GUID) String() string {
+	raw := make([]byte, 16)
+	binary.BigEndian.PutUint32(raw[0:], binary.LittleEndian.Uint32(g[0:]))
+	binary.BigEndian.PutUint16(raw[4:], binary.LittleEndian.Uint16(g[4:]))
+	binary.BigEndian.PutUint16(raw[6:], binary.LittleEndian.Uint16(g[6:]))
+	copy(raw[8:], g[8:])
+	h := hex.EncodeToString(raw)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,49 @@
+package wzexplorer_test
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"testing"
+)
+
+func TestParseGUID(t *testing.T) {
+	// windows keeps the first three groups little endian
+	want := wzexplorer.GUID{0x83, 0xeb, 0x36, 0xe4, 0x4f, 0x52, 0xce, 0x11, 0x9f, 0x53, 0x00, 0x20, 0xaf, 0x0b, 0xa7, 0x70}
+	for _, s := range []string{
+		"e436eb83-524f-11ce-9f53-0020af0ba770",
+		"{E436EB83-524F-11CE-9F53-0020AF0BA770}",
+	} {
+		g, err := wzexplorer.ParseGUID(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if g != want {
+			t.Errorf("%s = %x, want %x", s, g, want)
+		}
+	}
+	if wzexplorer.MediaTypeStream != want {
+		t.Errorf("MediaTypeStream = %x, want %x", wzexplorer.MediaTypeStream, want)
+	}
+	if s := want.String(); s != "e436eb83-524f-11ce-9f53-0020af0ba770" {
+		t.Errorf("String() = %s", s)
+	}
+	if s := wzexplorer.GUIDNull.String(); s != "00000000-0000-0000-0000-000000000000" {
+		t.Errorf("null String() = %s", s)
+	}
+
+	for _, s := range []string{"", "e436eb83-524f-11ce-9f53", "e436eb83-524f-11ce-9f53-0020af0ba770ff", "x436eb83-524f-11ce-9f53-0020af0ba770"} {
+		if _, err := wzexplorer.ParseGUID(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestGUIDRoundTrip(t *testing.T) {
+	for _, g := range []wzexplorer.GUID{
+		wzexplorer.MediaTypeAudio, wzexplorer.MediaSubTypeMPEG1Audio, wzexplorer.MediaSubTypeWAVE,
+		wzexplorer.MediaSubTypePCM, wzexplorer.MediaSubTypeMP3, wzexplorer.FormatTypeWaveFormatEx, wzexplorer.FormatTypeNone,
+	} {
+		if back, err := wzexplorer.ParseGUID(g.String()); err != nil || back != g {
+			t.Errorf("%s round trips to %s, %v", g, back, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package wzexplorer
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// zlibHeader reports whether a payload starts as a plain zlib stream,
+// otherwise it's split in length prefixed blocks encrypted with the xor table
+func zlibHeader(header uint16) bool {
+	return header == 0x9c78 || header == 0xda78 || header == 0x0178 || header == 0x5e78
+}
+
+// blockReader decrypts a payload of length prefixed blocks as it's read
+type blockReader struct {
+	r  io.Reader
+	cp *CryptProvider
+	o  binary.ByteOrder
+	// pos read and remain unread bytes of the current block
+	pos, remain int
+	head        [4]byte
+}
+
+func (r *blockReader) Read(p []byte) (n int, err error) {
+	for r.remain == 0 {
+		if _, err = io.ReadFull(r.r, r.head[:]); err != nil {
+			return
+		}
+		r.pos, r.remain = 0, int(r.o.Uint32(r.head[:]))
+	}
+	if len(p) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err = r.r.Read(p)
+	if n > 0 {
+		r.cp.lock.Lock()
+		r.cp.crypt.transformAt(p[:n], r.pos)
+		r.cp.lock.Unlock()
+		r.pos += n
+		r.remain -= n
+	}
+	if err == io.EOF && r.remain > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// inflater a pooled reader chain: blob section, block decryptor, buffer, zlib
+type inflater struct {
+	blocks blockReader
+	br     *bufio.Reader
+	zr     io.ReadCloser
+}
+
+var inflaters = sync.Pool{
+	New: func() interface{} {
+		return &inflater{br: bufio.NewReaderSize(nil, 16<<10)}
+	},
+}
+
+func (in *inflater) Read(p []byte) (int, error) {
+	return in.zr.Read(p)
+}
+
+// Close returns the inflater to the pool
+func (in *inflater) Close() error {
+	in.blocks = blockReader{}
+	in.br.Reset(nil)
+	inflaters.Put(in)
+	return nil
+}
+
+// stream returns the decrypted zlib stream read straight from the blob
+func (c *canvas) stream(blocks *blockReader) (io.Reader, error) {
+	b := c.f.b
+	if b.len == -1 {
+		return nil, io.ErrClosedPipe
+	}
+	section := io.NewSectionReader(b.fd, c.offset+1, int64(c.size)-1)
+	var header [2]byte
+	if _, err := section.ReadAt(header[:], 0); err != nil {
+		return nil, err
+	}
+	if zlibHeader(b.o.Uint16(header[:])) {
+		return section, nil
+	}
+	*blocks = blockReader{r: section, cp: b.provider, o: b.o}
+	return blocks, nil
+}
+
+// inflater returns a pooled reader of the inflated pixels, close it when done
+func (c *canvas) inflater() (*inflater, error) {
+	in := inflaters.Get().(*inflater)
+	src, err := c.stream(&in.blocks)
+	if err != nil {
+		inflaters.Put(in)
+		return nil, err
+	}
+	in.br.Reset(src)
+	if in.zr == nil {
+		in.zr, err = zlib.NewReader(in.br)
+	} else {
+		err = in.zr.(zlib.Resetter).Reset(in.br, nil)
+	}
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return in, nil
+}
+
+// inflate reads exactly the pixel bytes the format needs, a stream missing
+// its checksum still inflates as long as the pixels are complete
+func (c *canvas) inflate() ([]byte, error) {
+	size, err := c.pixelSize()
+	if err != nil {
+		return nil, err
+	}
+	in, err := c.inflater()
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	data := make([]byte, size)
+	if n, err := io.ReadFull(in, data); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("inflated %d bytes %dx%d %s needs %d", n, c.width, c.height, c.format, size)
+	} else if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
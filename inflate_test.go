@@ -0,0 +1,206 @@
+package wzexplorer_test
+
+import (
+	"bytes"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"image"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// inflateCanvases returns BGRA8888 pixels of 40x30 and an archive holding them
+// deflated in each layout under a/name
+func inflateCanvases(t *testing.T, layouts map[string]func(b *wztest.Builder, deflated []byte) []byte) ([]byte, wzexplorer.File) {
+	pixels := make([]byte, 40*30*4)
+	rand.New(rand.NewSource(1)).Read(pixels[:len(pixels)/2])
+	deflated := wztest.Deflate(pixels)
+
+	b := wztest.New(wzexplorer.IvGMS)
+	var ps []wztest.Prop
+	for name, layout := range layouts {
+		ps = append(ps, wztest.Prop{Name: name, Value: b.CanvasData(40, 30, 2, 0, layout(b, deflated))})
+	}
+	return pixels, openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "a.img", Image: b.Properties(ps...)})
+}
+
+func blocks(size int) func(b *wztest.Builder, deflated []byte) []byte {
+	return func(b *wztest.Builder, deflated []byte) []byte {
+		return b.Blocks(deflated, size)
+	}
+}
+
+func canvas(t *testing.T, f wzexplorer.File, name string) wzexplorer.Canvas {
+	t.Helper()
+	o := f.MustGet("a/" + name)
+	if o == nil {
+		t.Fatalf("missing a/%s", name)
+	}
+	return o.Canvas()
+}
+
+func TestInflateAcrossBlocks(t *testing.T) {
+	layouts := map[string]func(b *wztest.Builder, deflated []byte) []byte{
+		"plain": func(_ *wztest.Builder, deflated []byte) []byte { return deflated },
+	}
+	// single bytes, sizes that split the zlib header and the bufio buffer and one whole block
+	for _, size := range []int{1, 3, 7, 1000, 16<<10 + 1, 1 << 20} {
+		layouts["blocks"+strconv.Itoa(size)] = blocks(size)
+	}
+	pixels, f := inflateCanvases(t, layouts)
+
+	for name := range layouts {
+		c := canvas(t, f, name)
+		data, _, err := c.Pixels()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(data, pixels) {
+			t.Errorf("%s: pixels differ", name)
+		}
+		raw, err := c.RawData()
+		if err != nil || !bytes.Equal(raw, wztest.Deflate(pixels)) {
+			t.Errorf("%s: raw data differs: %v", name, err)
+		}
+		img, err := c.Image()
+		if err != nil || img.Bounds() != image.Rect(0, 0, 40, 30) {
+			t.Errorf("%s: image %v", name, err)
+		}
+	}
+}
+
+func TestInflateTruncated(t *testing.T) {
+	layouts := map[string]func(b *wztest.Builder, deflated []byte) []byte{
+		"plain": func(_ *wztest.Builder, deflated []byte) []byte { return deflated[:len(deflated)/2] },
+		// whole blocks of a cut stream
+		"stream": func(b *wztest.Builder, deflated []byte) []byte { return b.Blocks(deflated[:len(deflated)/2], 100) },
+		// the last block is shorter than its length
+		"block": func(b *wztest.Builder, deflated []byte) []byte {
+			data := b.Blocks(deflated, 100)
+			return data[:len(data)-10]
+		},
+		// the stream ends inside a block length
+		"length": func(b *wztest.Builder, deflated []byte) []byte {
+			data := b.Blocks(deflated[:len(deflated)/2], 100)
+			return append(data, 0x64, 0x00)
+		},
+	}
+	_, f := inflateCanvases(t, layouts)
+	for name := range layouts {
+		c := canvas(t, f, name)
+		if data, _, err := c.Pixels(); err == nil {
+			t.Errorf("%s: inflated %d bytes without error", name, len(data))
+		}
+		if img, err := c.Image(); err == nil || img != nil {
+			t.Errorf("%s: partial image %v", name, err)
+		}
+	}
+}
+
+func TestInflateReuseAfterError(t *testing.T) {
+	pixels, f := inflateCanvases(t, map[string]func(b *wztest.Builder, deflated []byte) []byte{
+		"good": blocks(100),
+		"plain": func(_ *wztest.Builder, deflated []byte) []byte {
+			return deflated
+		},
+		"bad": func(b *wztest.Builder, deflated []byte) []byte {
+			data := b.Blocks(deflated, 100)
+			return data[:len(data)-10]
+		},
+		"corrupt": func(_ *wztest.Builder, deflated []byte) []byte {
+			data := append([]byte{}, deflated...)
+			for i := 10; i < 40; i++ {
+				data[i] ^= 0x5a
+			}
+			return data
+		},
+	})
+	good, plain, bad, corrupt := canvas(t, f, "good"), canvas(t, f, "plain"), canvas(t, f, "bad"), canvas(t, f, "corrupt")
+
+	check := func() {
+		for _, c := range []wzexplorer.Canvas{good, plain} {
+			data, _, err := c.Pixels()
+			if err != nil || !bytes.Equal(data, pixels) {
+				t.Errorf("reused reader: %v", err)
+			}
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if _, _, err := bad.Pixels(); err == nil {
+			t.Fatal("truncated canvas inflated")
+		}
+		check()
+		if _, _, err := corrupt.Pixels(); err == nil {
+			t.Fatal("corrupt canvas inflated")
+		}
+		check()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				_, _, _ = bad.Pixels()
+				check()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInflateInvalidSize(t *testing.T) {
+	deflated := wztest.Deflate(make([]byte, 16))
+	b := wztest.New(wzexplorer.IvGMS)
+	f := openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "zero", Value: b.CanvasData(0, 2, 2, 0, deflated)},
+		wztest.Prop{Name: "negative", Value: b.CanvasData(2, -2, 2, 0, deflated)},
+	)})
+	for _, name := range []string{"zero", "negative"} {
+		c := canvas(t, f, name)
+		if _, _, err := c.Pixels(); err == nil || !strings.Contains(err.Error(), "invalid canvas size") {
+			t.Errorf("%s: pixels error %v", name, err)
+		}
+		if _, err := c.Image(); err == nil {
+			t.Errorf("%s: image decoded", name)
+		}
+	}
+}
+
+func TestInflateOversized(t *testing.T) {
+	deflated := wztest.Deflate(make([]byte, 16))
+	b := wztest.New(wzexplorer.IvGMS)
+	f := openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "large", Value: b.CanvasData(1<<15, 1<<15, 2, 0, deflated)},
+		// 4 bytes of the largest size overflow int64
+		wztest.Prop{Name: "max", Value: b.CanvasData(math.MaxInt32, math.MaxInt32, 2, 0, deflated)},
+		wztest.Prop{Name: "dxt", Value: b.CanvasData(math.MaxInt32, math.MaxInt32, int32(wzexplorer.CanvasFormatDXT5), 0, deflated)},
+	)})
+	for _, name := range []string{"large", "max", "dxt"} {
+		c := canvas(t, f, name)
+		if _, _, err := c.Pixels(); err == nil || !strings.Contains(err.Error(), "inflate to at most") {
+			t.Errorf("%s: pixels error %v", name, err)
+		}
+		if _, err := c.Image(); err == nil {
+			t.Errorf("%s: image decoded", name)
+		}
+	}
+
+	r, err := wzexplorer.Verify(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Issues) != 3 {
+		t.Errorf("verify issues %v, want 3", r.Issues)
+	}
+	for _, i := range r.Issues {
+		if i.Kind != wzexplorer.VerifyCanvas {
+			t.Errorf("verify issue %v", i)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Package wztest builds small archives in memory for tests
+package wztest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/aes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Version client version every archive is written for
+const Version = 79
+
+// Object an encoded object, the value of an object property
+type Object []byte
+
+// Prop a named property, Value is nil, int16, int32, float64, string or Object
+type Prop struct {
+	Name  string
+	Value interface{}
+}
+
+// Entry a directory entry, Image for an image and Dir for a sub directory
+type Entry struct {
+	Name  string
+	Dir   []Entry
+	Image Object
+}
+
+// Builder encodes objects and archives with the xor table of an iv
+type Builder struct {
+	xor  []byte
+	hash uint32
+}
+
+var key = []byte{
+	0x13, 0x00, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0xb4, 0x00, 0x00, 0x00,
+	0x1b, 0x00, 0x00, 0x00, 0x0f, 0x00, 0x00, 0x00, 0x33, 0x00, 0x00, 0x00, 0x52, 0x00, 0x00, 0x00,
+}
+
+// New returns a builder for iv, 64 KiB of xor table are enough for any test data
+func New(iv []byte) *Builder {
+	b := &Builder{xor: make([]byte, 64<<10)}
+	if !bytes.Equal(iv, make([]byte, len(iv))) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			panic(err)
+		}
+		chain := bytes.Repeat(iv, 4)
+		for i := 0; i < len(b.xor); i += 16 {
+			block.Encrypt(b.xor[i:], chain)
+			copy(chain, b.xor[i:i+16])
+		}
+	}
+	h := 0
+	for _, c := range strconv.Itoa(Version) {
+		h = h<<5 + int(c) + 1
+	}
+	b.hash = uint32(h)
+	return b
+}
+
+// Xor applies the xor table to data as if it started at its beginning
+func (b *Builder) Xor(data []byte) {
+	for i := range data {
+		data[i] ^= b.xor[i]
+	}
+}
+
+type writer struct {
+	bytes.Buffer
+	b *Builder
+}
+
+func (w *writer) u8(v byte) {
+	w.WriteByte(v)
+}
+
+func (w *writer) le(v interface{}) {
+	_ = binary.Write(w, binary.LittleEndian, v)
+}
+
+func (w *writer) ci(v int32) {
+	if v > 127 || v <= -128 {
+		w.u8(0x80)
+		w.le(v)
+	} else {
+		w.u8(byte(int8(v)))
+	}
+}
+
+func (w *writer) str(s string) {
+	n := len(s)
+	if n >= 128 {
+		w.u8(0x80)
+		w.le(int32(n))
+	} else {
+		w.u8(byte(int8(-n)))
+	}
+	data := []byte(s)
+	mask := byte(0xaa)
+	for i := range data {
+		data[i] ^= mask ^ w.b.xor[i]
+		mask++
+	}
+	w.Write(data)
+}
+
+// tag writes an inline string the way type tags and names are stored
+func (w *writer) tag(s string) {
+	w.u8(0x00)
+	w.str(s)
+}
+
+func (b *Builder) writer() *writer {
+	return &writer{b: b}
+}
+
+func (w *writer) props(ps []Prop) {
+	w.le(uint16(0))
+	w.ci(int32(len(ps)))
+	for _, p := range ps {
+		w.tag(p.Name)
+		switch v := p.Value.(type) {
+		case nil:
+			w.u8(0x00)
+		case int16:
+			w.u8(0x02)
+			w.le(v)
+		case int32:
+			w.u8(0x03)
+			w.ci(v)
+		case float64:
+			w.u8(0x05)
+			w.le(v)
+		case string:
+			w.u8(0x08)
+			w.tag(v)
+		case Object:
+			w.u8(0x09)
+			w.le(int32(len(v)))
+			w.Write(v)
+		default:
+			panic("wztest: unsupported property value")
+		}
+	}
+}
+
+func (b *Builder) Properties(ps ...Prop) Object {
+	w := b.writer()
+	w.u8(0x73)
+	w.str("Property")
+	w.props(ps)
+	return w.Bytes()
+}
+
+func (b *Builder) Vector(x, y int32) Object {
+	w := b.writer()
+	w.u8(0x73)
+	w.str("Shape2D#Vector2D")
+	w.ci(x)
+	w.ci(y)
+	return w.Bytes()
+}
+
+func (b *Builder) UOL(path string) Object {
+	w := b.writer()
+	w.u8(0x73)
+	w.str("UOL")
+	w.u8(0)
+	w.tag(path)
+	return w.Bytes()
+}
+
+// Canvas encodes pixels of format deflated as a plain zlib stream
+func (b *Builder) Canvas(width, height int32, format int32, pixels []byte, ps ...Prop) Object {
+	return b.CanvasData(width, height, format, 0, Deflate(pixels), ps...)
+}
+
+// CanvasData encodes a canvas storing data as is, format and mag the two stored format fields
+func (b *Builder) CanvasData(width, height, format int32, mag byte, data []byte, ps ...Prop) Object {
+	w := b.writer()
+	w.u8(0x73)
+	w.str("Canvas")
+	w.u8(0)
+	if len(ps) > 0 {
+		w.u8(1)
+		w.props(ps)
+	} else {
+		w.u8(0)
+	}
+	w.ci(width)
+	w.ci(height)
+	w.ci(format)
+	w.u8(mag)
+	w.le(int32(0))
+	w.le(int32(len(data) + 1))
+	w.u8(0)
+	w.Write(data)
+	return w.Bytes()
+}
+
+// Blocks splits data in length prefixed blocks of at most size bytes, each encrypted from
+// the start of the xor table, the layout of canvases that don't start with a zlib header
+func (b *Builder) Blocks(data []byte, size int) []byte {
+	w := b.writer()
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		block := append([]byte{}, data[:n]...)
+		b.Xor(block)
+		w.le(int32(n))
+		w.Write(block)
+		data = data[n:]
+	}
+	return w.Bytes()
+}
+
+// Sound encodes payload as 16 bit stereo 22050 Hz PCM
+func (b *Builder) Sound(payload []byte) Object {
+	return b.SoundMedia(payload, Media{
+		SubType:    [16]byte{0x8b, 0xeb, 0x36, 0xe4, 0x4f, 0x52, 0xce, 0x11, 0x9f, 0x53, 0x00, 0x20, 0xaf, 0x0b, 0xa7, 0x70},
+		FormatType: FormatTypeWaveFormatEx,
+		Format:     WaveFormat(1, 2, 22050, 88200, 4, 16),
+	})
+}
+
+// FormatTypeWaveFormatEx FORMAT_WaveFormatEx, a WAVEFORMATEX block follows the media type
+var FormatTypeWaveFormatEx = [16]byte{0x81, 0x9f, 0x58, 0x05, 0x56, 0xc3, 0xce, 0x11, 0xbf, 0x01, 0x00, 0xaa, 0x00, 0x55, 0x59, 0x5a}
+
+// Media the media type of a sound
+type Media struct {
+	SubType    [16]byte
+	FormatType [16]byte
+	// Format WAVEFORMATEX block, nil for header-less sounds
+	Format []byte
+	// Encrypted stores Format through the xor table
+	Encrypted bool
+}
+
+// WaveFormat encodes a WAVEFORMATEX block without extra bytes
+func WaveFormat(tag, channels uint16, rate, avg uint32, align, bits uint16) []byte {
+	w := &writer{}
+	w.le([]uint16{tag, channels})
+	w.le([]uint32{rate, avg})
+	w.le([]uint16{align, bits, 0})
+	return w.Bytes()
+}
+
+// SoundMedia encodes a sound of media type m, duration assumes 88200 bytes per second
+func (b *Builder) SoundMedia(payload []byte, m Media) Object {
+	w := b.writer()
+	w.u8(0x73)
+	w.str("Sound_DX8")
+	w.u8(0)
+	w.ci(int32(len(payload)))
+	w.ci(int32(len(payload) * 1000 / 88200))
+	w.u8(2)
+	// MEDIATYPE_Stream
+	w.Write([]byte{0x83, 0xeb, 0x36, 0xe4, 0x4f, 0x52, 0xce, 0x11, 0x9f, 0x53, 0x00, 0x20, 0xaf, 0x0b, 0xa7, 0x70})
+	w.Write(m.SubType[:])
+	w.u8(0)
+	w.u8(1)
+	w.Write(m.FormatType[:])
+	if m.Format != nil {
+		format := append([]byte{}, m.Format...)
+		if m.Encrypted {
+			b.Xor(format)
+		}
+		w.u8(byte(len(format)))
+		w.Write(format)
+	}
+	w.Write(payload)
+	return w.Bytes()
+}
+
+// Deflate compresses data into a zlib stream
+func Deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+const headerSize = 60
+
+// offset encrypts the directory offset stored at pos
+func (b *Builder) offset(pos, value uint32) uint32 {
+	off := ((pos-headerSize)^0xffffffff)*b.hash - 0x581c3f6d
+	factor := off & 0x1f
+	rot := off<<factor | off>>(32-factor)
+	return rot ^ (value - headerSize*2)
+}
+
+// File encodes a whole archive file holding entries
+func (b *Builder) File(entries ...Entry) []byte {
+	w := b.writer()
+	w.WriteString("PKG1")
+	w.le(uint64(0))
+	w.le(uint32(headerSize))
+	w.WriteString("Package file v1.0 Copyright 2002 Wizet, ZMS")
+	for w.Len() < headerSize {
+		w.u8(0)
+	}
+	v := uint16(0xff)
+	for i := 0; i < 4; i++ {
+		v ^= uint16(b.hash >> (i * 8) & 0xff)
+	}
+	w.le(v)
+
+	type pending struct {
+		pos int
+		e   Entry
+	}
+	dir := func(es []Entry) []pending {
+		var ps []pending
+		w.ci(int32(len(es)))
+		for _, e := range es {
+			if e.Image != nil {
+				w.u8(4)
+			} else {
+				w.u8(3)
+			}
+			w.str(e.Name)
+			w.ci(int32(len(e.Image)))
+			sum := int32(0)
+			for _, c := range e.Image {
+				sum += int32(c)
+			}
+			w.ci(sum)
+			ps = append(ps, pending{pos: w.Len(), e: e})
+			w.le(uint32(0))
+		}
+		return ps
+	}
+	patch := func(p pending) {
+		binary.LittleEndian.PutUint32(w.Bytes()[p.pos:], b.offset(uint32(p.pos), uint32(w.Len())))
+	}
+
+	var images []pending
+	queue := dir(entries)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if p.e.Image != nil {
+			images = append(images, p)
+			continue
+		}
+		patch(p)
+		queue = append(queue, dir(p.e.Dir)...)
+	}
+	for _, p := range images {
+		patch(p)
+		w.Write(p.e.Image)
+	}
+	data := w.Bytes()
+	binary.LittleEndian.PutUint64(data[4:], uint64(len(data)-headerSize))
+	return data
+}
+
+// Write writes an archive of entries into a temporary directory and returns its path
+func (b *Builder) Write(tb testing.TB, entries ...Entry) string {
+	tb.Helper()
+	name := filepath.Join(tb.TempDir(), "Test.wz")
+	if err := os.WriteFile(name, b.File(entries...), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return name
+}
@@ -0,0 +1,58 @@
+// Package wzvalue reads loosely typed property values the way the client does
+package wzvalue
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"image"
+	"strconv"
+)
+
+// Int returns a numeric or numeric string value as int, zero for nil and anything else
+func Int(o wzexplorer.Object) int {
+	if o == nil {
+		return 0
+	}
+	switch o.Type() {
+	case wzexplorer.ObjectTypeVariantInt16:
+		return int(o.Int16())
+	case wzexplorer.ObjectTypeVariantInt32:
+		return int(o.Int32())
+	case wzexplorer.ObjectTypeVariantInt64:
+		return int(o.Int64())
+	case wzexplorer.ObjectTypeVariantFloat32:
+		return int(o.Float32())
+	case wzexplorer.ObjectTypeVariantFloat64:
+		return int(o.Float64())
+	case wzexplorer.ObjectTypeVariantString:
+		v, _ := strconv.Atoi(o.String())
+		return v
+	}
+	return 0
+}
+
+// ChildInt returns the Int of child name, def when it doesn't exist
+func ChildInt(o wzexplorer.GetObject, name string, def int) int {
+	c, err := o.Get(name)
+	if err != nil || c == nil {
+		return def
+	}
+	return Int(c)
+}
+
+// ChildString returns child name as string, empty when it doesn't exist
+func ChildString(o wzexplorer.GetObject, name string) string {
+	c, err := o.Get(name)
+	if err != nil || c == nil {
+		return ""
+	}
+	return c.String()
+}
+
+// ChildVector returns the vector child name, zero when it doesn't exist
+func ChildVector(o wzexplorer.GetObject, name string) image.Point {
+	c, err := o.Get(name)
+	if err != nil || c == nil {
+		return image.Point{}
+	}
+	return c.Vector()
+}
@@ -9,6 +9,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var EachInterrupt = errors.New("interrupt")
@@ -29,6 +31,8 @@ type GetObject interface {
 	GetPaths([]string) (Object, error)
 	MustGetPaths([]string) Object
 	Each(EachObjectFunc) error
+	// Unload drops parsed children so they parse again on next access
+	Unload()
 }
 
 type Object interface {
@@ -46,6 +50,10 @@ type Object interface {
 	Float64() float64
 	Array() ([]Object, error)
 	String() string
+	// Checksum checksum the directory entry records for an image, zero for any other object
+	Checksum() int32
+	// DataSize stored bytes of an image or nested block, zero for inline values
+	DataSize() int32
 }
 
 type ObjectType byte
@@ -67,6 +75,40 @@ const (
 	ObjectTypeVariantString
 )
 
+func (t ObjectType) String() string {
+	switch t {
+	case ObjectTypeDirectory:
+		return "Directory"
+	case ObjectTypeProperties:
+		return "Properties"
+	case ObjectTypeCanvas:
+		return "Canvas"
+	case ObjectTypeConvex:
+		return "Convex"
+	case ObjectTypeVector:
+		return "Vector"
+	case ObjectTypeUOL:
+		return "UOL"
+	case ObjectTypeSound:
+		return "Sound"
+	case ObjectTypeVariantNil:
+		return "Nil"
+	case ObjectTypeVariantInt16:
+		return "Int16"
+	case ObjectTypeVariantInt32:
+		return "Int32"
+	case ObjectTypeVariantInt64:
+		return "Int64"
+	case ObjectTypeVariantFloat32:
+		return "Float32"
+	case ObjectTypeVariantFloat64:
+		return "Float64"
+	case ObjectTypeVariantString:
+		return "String"
+	}
+	return "Unknown"
+}
+
 const (
 	flagDirectory = 1 << iota
 	flagLoaded    = 1 << iota
@@ -82,6 +124,8 @@ type object struct {
 	f                  *file
 	o                  interface{}
 	flag               byte
+	// atime unix nano of the last parse access
+	atime int64
 }
 
 func newObject(f *file, baseOffset int64) *object {
@@ -252,7 +296,16 @@ func (o *object) parseSound() (err error) {
 	return
 }
 
+// parseImage reads the type tag and parses the body
 func (o *object) parseImage() error {
+	if err := o.parseTag(); err != nil {
+		return err
+	}
+	return o.load()
+}
+
+// parseTag reads the type tag, the body stays lazy
+func (o *object) parseTag() error {
 	b := o.f.b
 	if _, err := b.Seek(o.offset, io.SeekStart); err != nil {
 		return err
@@ -280,8 +333,7 @@ func (o *object) parseImage() error {
 	default:
 		return errors.New("invalid tag")
 	}
-
-	return o.parse()
+	return nil
 }
 
 func (o *object) parseDirectory() error {
@@ -404,7 +456,7 @@ func (o *object) parseDirectory() error {
 					e.flag = flagLoaded | flagFile
 				}
 			} else {
-				if err = e.parseImage(); err != nil {
+				if err = e.parseTag(); err != nil {
 					return err
 				}
 				name = strings.TrimSuffix(name, ".img")
@@ -422,13 +474,33 @@ func (o *object) parseDirectory() error {
 	return nil
 }
 
-func (o *object) parse() (err error) {
+// parse lazy load object, safe for concurrent use
+func (o *object) parse() error {
+	_, err := o.loaded()
+	return err
+}
+
+// loaded parses o and returns its value, the value stays valid when o is unloaded meanwhile
+func (o *object) loaded() (v interface{}, err error) {
+	atomic.StoreInt64(&o.atime, time.Now().UnixNano())
+	if o.f == nil {
+		err = o.load()
+		return o.o, err
+	}
+	o.f.b.provider.lock.Lock()
+	defer o.f.b.provider.lock.Unlock()
+	err = o.load()
+	return o.o, err
+}
+
+// load lazy load object, caller must hold the provider lock
+func (o *object) load() (err error) {
 	if o.flag&flagLoaded == flagLoaded {
 		return
 	}
 
 	if o.flag&flagBase == 0 && o.flag&flagFile == flagFile {
-		err = o.o.(*file).parse()
+		err = o.o.(*file).load()
 		return
 	}
 
@@ -465,6 +537,14 @@ func (o *object) Type() ObjectType {
 	return o.t
 }
 
+func (o *object) Checksum() int32 {
+	return o.checksum
+}
+
+func (o *object) DataSize() int32 {
+	return o.size
+}
+
 func (o *object) Value() interface{} {
 	return o.o
 }
@@ -591,13 +671,14 @@ func (o *object) String() string {
 }
 
 func (o *object) get(name string) (Object, error) {
-	if err := o.parse(); err != nil {
+	v, err := o.loaded()
+	if err != nil {
 		return nil, err
 	}
 
 	switch o.t {
 	case ObjectTypeDirectory:
-		switch m := o.o.(type) {
+		switch m := v.(type) {
 		case map[string]Object:
 			if obj, ok := m[name]; ok {
 				return obj, nil
@@ -616,7 +697,7 @@ func (o *object) get(name string) (Object, error) {
 			return nil, errors.New("invalid object")
 		}
 	case ObjectTypeConvex, ObjectTypeProperties:
-		properties := o.o.(Properties[KVPair])
+		properties := v.(Properties[KVPair])
 		for i := 0; i < len(properties); i++ {
 			p := properties[i]
 			if p.Key == name {
@@ -624,7 +705,7 @@ func (o *object) get(name string) (Object, error) {
 			}
 		}
 	case ObjectTypeCanvas:
-		return o.o.(*canvas).get(name)
+		return v.(*canvas).get(name)
 	}
 	return nil, nil
 }
@@ -665,8 +746,13 @@ func (o *object) GetPaths(paths []string) (Object, error) {
 
 	if cur != nil && cur.Type() == ObjectTypeUOL {
 		// try get uol object
-		// FIXME if path out of current object can't get right result
-		return o.Get(filepath.Join(append(paths, strings.Split(cur.String(), "/")...)...))
+		// uol is relative to its parent
+		parent := len(paths) - 1
+		for parent > 0 && paths[parent] == "" {
+			parent--
+		}
+		link := append(append([]string{}, paths[:parent]...), strings.Split(cur.String(), "/")...)
+		return o.Get(filepath.Join(link...))
 	}
 
 	return cur, nil
@@ -681,11 +767,12 @@ func (o *object) MustGetPaths(paths []string) Object {
 }
 
 func (o *object) Each(cb EachObjectFunc) error {
-	if err := o.parse(); err != nil {
+	v, err := o.loaded()
+	if err != nil {
 		return err
 	}
 
-	switch m := o.o.(type) {
+	switch m := v.(type) {
 	case Properties[KVPair]:
 		for i := 0; i < len(m); i++ {
 			p := m[i]
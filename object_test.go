@@ -0,0 +1,105 @@
+package wzexplorer_test
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func openTest(t *testing.T, b *wztest.Builder, iv []byte, entries ...wztest.Entry) wzexplorer.File {
+	t.Helper()
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, b.Write(t, entries...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestGetUOLRelativeToParent(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := openTest(t, b, wzexplorer.IvEmpty, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "icon", Value: "icon value"},
+		wztest.Prop{Name: "link", Value: b.UOL("icon")},
+		wztest.Prop{Name: "sub", Value: b.Properties(
+			wztest.Prop{Name: "x", Value: int32(7)},
+			wztest.Prop{Name: "side", Value: b.UOL("x")},
+			wztest.Prop{Name: "up", Value: b.UOL("../icon")},
+		)},
+	)})
+
+	for path, want := range map[string]string{
+		"a/link":     "icon value",
+		"a/sub/side": "7",
+		"a/sub/up":   "icon value",
+		"a//sub/up/": "icon value",
+		"a/sub/x":    "7",
+		"a/icon":     "icon value",
+	} {
+		o, err := f.Get(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if o == nil {
+			t.Fatalf("%s: not found", path)
+		}
+		if got := o.String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestObjectTypeString(t *testing.T) {
+	for typ, want := range map[wzexplorer.ObjectType]string{
+		wzexplorer.ObjectTypeDirectory:     "Directory",
+		wzexplorer.ObjectTypeCanvas:        "Canvas",
+		wzexplorer.ObjectTypeUOL:           "UOL",
+		wzexplorer.ObjectTypeVariantNil:    "Nil",
+		wzexplorer.ObjectTypeVariantString: "String",
+		wzexplorer.ObjectType(255):         "Unknown",
+	} {
+		if got := typ.String(); got != want {
+			t.Errorf("ObjectType(%d).String() = %q, want %q", typ, got, want)
+		}
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	b := wztest.New(wzexplorer.IvGMS)
+	var ps []wztest.Prop
+	for i := 0; i < 8; i++ {
+		ps = append(ps, wztest.Prop{Name: strconv.Itoa(i), Value: b.Properties(
+			wztest.Prop{Name: "c", Value: b.Canvas(16, 16, int32(wzexplorer.CanvasFormatBGRA8888), make([]byte, 16*16*4))},
+			wztest.Prop{Name: "s", Value: b.Sound(make([]byte, 64))},
+		)})
+	}
+	f := openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "a.img", Image: b.Properties(ps...)})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 8; i++ {
+				o, err := f.Get("a/" + strconv.Itoa(i))
+				if err != nil || o == nil {
+					t.Errorf("Get(a/%d) = %v, %v", i, o, err)
+					return
+				}
+				if _, err = o.MustGet("c").Canvas().Image(); err != nil {
+					t.Error(err)
+				}
+				if s, err := o.MustGet("s").Sound().Stream(true); err != nil || len(s) != 64 {
+					t.Errorf("Stream = %d bytes, %v", len(s), err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
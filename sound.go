@@ -1,18 +1,24 @@
 package wzexplorer
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
+	"github.com/anonymous5l/wzexplorer/wzsound"
 	"io"
 	"time"
 )
 
+var ErrUnknownSoundFormat = errors.New("unknown sound format")
+
 type FormatTag uint16
 
 const (
-	FormatTagPCM FormatTag = 1
-	FormatTagMP3 FormatTag = 85
+	FormatTagPCM        FormatTag = 1
+	FormatTagADPCM      FormatTag = 2
+	FormatTagIEEEFloat  FormatTag = 3
+	FormatTagIMAADPCM   FormatTag = 17
+	FormatTagMP3        FormatTag = 85
+	FormatTagExtensible FormatTag = 0xfffe
 )
 
 type WaveFormat struct {
@@ -26,26 +32,80 @@ type WaveFormat struct {
 	Extra          []byte
 }
 
+type MediaKind byte
+
+const (
+	MediaKindUnknown MediaKind = iota
+	MediaKindPCM
+	MediaKindMP3
+	// MediaKindADPCM IMA ADPCM, microsoft ADPCM is not supported and reports MediaKindUnknown
+	MediaKindADPCM
+)
+
+func (k MediaKind) String() string {
+	switch k {
+	case MediaKindPCM:
+		return "PCM"
+	case MediaKindMP3:
+		return "MP3"
+	case MediaKindADPCM:
+		return "IMA ADPCM"
+	}
+	return "Unknown"
+}
+
 type MediaType struct {
 	SoundType  byte
-	MajorType  []byte
-	SubType    []byte
+	MajorType  GUID
+	SubType    GUID
 	Reserved1  byte
 	Reserved2  byte
-	FormatType []byte
+	FormatType GUID
 	Format     WaveFormat
+	// HasFormat a WAVEFORMATEX block follows the media type
+	HasFormat bool
+	// EncryptedFormat the WAVEFORMATEX block was stored encrypted
+	EncryptedFormat bool
+}
+
+// Kind payload encoding from format tag, falls back to the subtype guid for header-less sounds
+func (m MediaType) Kind() MediaKind {
+	if m.HasFormat {
+		switch m.Format.FormatTag {
+		case FormatTagPCM:
+			return MediaKindPCM
+		case FormatTagMP3:
+			return MediaKindMP3
+		case FormatTagIMAADPCM:
+			return MediaKindADPCM
+		}
+		return MediaKindUnknown
+	}
+	switch m.SubType {
+	case MediaSubTypePCM:
+		return MediaKindPCM
+	case MediaSubTypeMPEG1Audio, MediaSubTypeMP3:
+		return MediaKindMP3
+	}
+	return MediaKindUnknown
 }
 
 type Sound interface {
 	Duration() time.Duration
 	Media() MediaType
 	Stream(raw bool) ([]byte, error)
+	// Open reads the payload without buffering, PCM gets a synthesized wav header.
+	// The reader also implements io.ReaderAt for range reads
+	Open() (io.ReadSeekCloser, error)
+	// OpenWAV wraps any format in a wav container
+	OpenWAV() (io.ReadSeekCloser, error)
+	// Decode decodes PCM, MP3 and IMA ADPCM payloads into PCM samples
+	Decode() (*wzsound.PCM, error)
 }
 
 // sound Sound_DX8
 type sound struct {
 	f        *file
-	stream   []byte
 	size     int32
 	duration int32
 	offset   int64
@@ -91,12 +151,10 @@ func (s *sound) parse(f *file) (err error) {
 	if s.media.SoundType, err = b.ReadByte(); err != nil {
 		return
 	}
-	s.media.MajorType = make([]byte, 16, 16)
-	if _, err = b.Read(s.media.MajorType); err != nil {
+	if _, err = b.Read(s.media.MajorType[:]); err != nil {
 		return
 	}
-	s.media.SubType = make([]byte, 16, 16)
-	if _, err = b.Read(s.media.SubType); err != nil {
+	if _, err = b.Read(s.media.SubType[:]); err != nil {
 		return
 	}
 	if s.media.Reserved1, err = b.ReadByte(); err != nil {
@@ -105,127 +163,298 @@ func (s *sound) parse(f *file) (err error) {
 	if s.media.Reserved2, err = b.ReadByte(); err != nil {
 		return
 	}
-	s.media.FormatType = make([]byte, 16, 16)
-	if _, err = b.Read(s.media.FormatType); err != nil {
+	if _, err = b.Read(s.media.FormatType[:]); err != nil {
 		return
 	}
 
-	if s.media.Reserved1 == 0 {
-		var waveFormatSize byte
-		if waveFormatSize, err = b.ReadByte(); err != nil {
-			return
-		}
+	switch s.media.FormatType {
+	case FormatTypeWaveFormatEx:
+		s.media.HasFormat = true
+	case FormatTypeNone, GUIDNull:
+	default:
+		s.media.HasFormat = s.media.Reserved1 == 0
+	}
 
-		if waveFormatSize < 18 {
-			err = errors.New("unknown sound type")
+	if s.media.HasFormat {
+		if err = s.parseFormat(b); err != nil {
 			return
 		}
+	} else if s.media.Kind() == MediaKindMP3 {
+		// header-less sound keep the format tag so payload decoding still works
+		s.media.Format.FormatTag = FormatTagMP3
+	}
 
-		var ft uint16
-		if ft, err = b.ReadUInt16(); err != nil {
-			return
-		}
-		s.media.Format.FormatTag = FormatTag(ft)
-		if s.media.Format.Channels, err = b.ReadUInt16(); err != nil {
-			return
-		}
-		if s.media.Format.SamplesPerSec, err = b.ReadUInt32(); err != nil {
-			return
-		}
-		if s.media.Format.AvgBytesPerSec, err = b.ReadUInt32(); err != nil {
-			return
-		}
-		if s.media.Format.BlockAlign, err = b.ReadUInt16(); err != nil {
-			return
-		}
-		if s.media.Format.BitsPerSample, err = b.ReadUInt16(); err != nil {
+	s.offset = b.off
+
+	if _, err = b.Seek(int64(s.size), io.SeekCurrent); err != nil {
+		return
+	}
+
+	return
+}
+
+func parseWaveFormat(data []byte) (f WaveFormat, ok bool) {
+	if len(data) < 16 {
+		return
+	}
+	o := binary.LittleEndian
+	f.FormatTag = FormatTag(o.Uint16(data))
+	f.Channels = o.Uint16(data[2:])
+	f.SamplesPerSec = o.Uint32(data[4:])
+	f.AvgBytesPerSec = o.Uint32(data[8:])
+	f.BlockAlign = o.Uint16(data[12:])
+	f.BitsPerSample = o.Uint16(data[14:])
+	if len(data) >= 18 {
+		f.ExtraSize = o.Uint16(data[16:])
+		if int(f.ExtraSize)+18 != len(data) {
 			return
 		}
-		if s.media.Format.ExtraSize, err = b.ReadUInt16(); err != nil {
-			return
+		if f.ExtraSize > 0 {
+			f.Extra = append([]byte{}, data[18:]...)
 		}
-		if s.media.Format.ExtraSize > 0 {
-			s.media.Format.Extra = make([]byte, s.media.Format.ExtraSize, s.media.Format.ExtraSize)
-			if _, err = b.Read(s.media.Format.Extra); err != nil {
-				return
-			}
+	} else if len(data) != 16 {
+		return
+	}
+	ok = f.Channels > 0 && f.Channels <= 8 && f.SamplesPerSec > 0
+	return
+}
+
+func (s *sound) parseFormat(b *Blob) (err error) {
+	var waveFormatSize byte
+	if waveFormatSize, err = b.ReadByte(); err != nil {
+		return
+	}
+
+	data := make([]byte, waveFormatSize)
+	var n int
+	if n, err = b.Read(data); err != nil {
+		return
+	} else if n != len(data) {
+		return io.EOF
+	}
+
+	var ok bool
+	if s.media.Format, ok = parseWaveFormat(data); ok {
+		return
+	}
+
+	// newer clients encrypt the format block
+	b.provider.crypt.Transform(data)
+	if s.media.Format, ok = parseWaveFormat(data); ok {
+		s.media.EncryptedFormat = true
+		return
+	}
+	return errors.New("unknown sound type")
+}
+
+func (s *sound) samples() uint32 {
+	return uint32(int64(s.duration) * int64(s.media.Format.SamplesPerSec) / 1000)
+}
+
+func (s *sound) header() []byte {
+	if s.media.Format.FormatTag != FormatTagPCM {
+		return nil
+	}
+	// fix wav header
+	return s.media.Format.WAVHeader(uint32(s.size), s.samples())
+}
+
+func (s *sound) Stream(raw bool) (stream []byte, err error) {
+	cp := s.f.b.provider
+	cache := cp.cache
+	key := CacheKey{File: s.f.filename, Offset: s.offset, Kind: CacheStream}
+	if raw {
+		key.Kind = CacheStreamRaw
+	}
+	if cache != nil {
+		if v, ok := cache.Get(key); ok {
+			return v.([]byte), nil
 		}
 	}
 
-	s.offset = b.off
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
 
-	if _, err = b.Seek(int64(s.size), io.SeekCurrent); err != nil {
+	if _, err = s.f.b.Seek(s.offset, io.SeekStart); err != nil {
+		return
+	}
+	stream = make([]byte, s.size, s.size)
+
+	var n int
+	if n, err = s.f.b.Read(stream); err != nil {
+		return
+	} else if n != int(s.size) {
+		err = io.EOF
 		return
 	}
 
+	if !raw {
+		if header := s.header(); header != nil {
+			stream = append(header, stream...)
+			if s.size&1 == 1 {
+				stream = append(stream, 0)
+			}
+		}
+	}
+	if cache != nil {
+		cache.Add(key, stream, int64(len(stream)))
+	}
 	return
 }
 
-func (s *sound) Stream(raw bool) (stream []byte, err error) {
-	if s.stream == nil {
-		if _, err = s.f.b.Seek(s.offset, io.SeekStart); err != nil {
-			return
+func (s *sound) Open() (io.ReadSeekCloser, error) {
+	return s.open(s.header())
+}
+
+func (s *sound) OpenWAV() (io.ReadSeekCloser, error) {
+	if s.media.Format.FormatTag == 0 {
+		return nil, ErrUnknownSoundFormat
+	}
+	return s.open(s.media.Format.WAVHeader(uint32(s.size), s.samples()))
+}
+
+func (s *sound) Decode() (*wzsound.PCM, error) {
+	r, err := s.open(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	format := s.media.Format
+	switch format.FormatTag {
+	case FormatTagPCM:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return &wzsound.PCM{
+			SampleRate:    int(format.SamplesPerSec),
+			Channels:      int(format.Channels),
+			BitsPerSample: int(format.BitsPerSample),
+			Data:          data,
+		}, nil
+	case FormatTagMP3:
+		return wzsound.DecodeMP3(r)
+	case FormatTagIMAADPCM:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
 		}
-		s.stream = make([]byte, s.size, s.size)
+		return wzsound.DecodeIMAADPCM(data, int(format.SamplesPerSec), int(format.Channels), int(format.BlockAlign))
+	}
+	return nil, ErrUnknownSoundFormat
+}
 
-		var n int
-		if n, err = s.f.b.Read(s.stream); err != nil {
-			return
-		} else if n != int(s.size) {
-			err = io.EOF
+func (s *sound) open(header []byte) (io.ReadSeekCloser, error) {
+	if s.f.b.len == -1 {
+		return nil, io.ErrClosedPipe
+	}
+	r := &soundReader{
+		header: header,
+		fd:     s.f.b.fd,
+		offset: s.offset,
+		size:   int64(s.size),
+	}
+	if header != nil {
+		r.pad = r.size & 1
+	}
+	return r, nil
+}
+
+// soundReader reads payload straight from the blob, header is prepended virtually
+type soundReader struct {
+	header []byte
+	fd     io.ReaderAt
+	offset int64
+	size   int64
+	// pad 1 when the wav wrapped payload has an odd size
+	pad    int64
+	off    int64
+	closed bool
+}
+
+func (r *soundReader) Len() int64 {
+	return int64(len(r.header)) + r.size + r.pad
+}
+
+func (r *soundReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+// ReadAt reads without moving the offset, the blob is read directly so it is safe for concurrent use
+func (r *soundReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.Len() {
+		return 0, io.EOF
+	}
+	if off < int64(len(r.header)) {
+		if n = copy(p, r.header[off:]); n == len(p) {
 			return
 		}
-
-		if s.media.Format.FormatTag == FormatTagPCM && !raw {
-			// fix wav header
-			buf := bytes.NewBuffer([]byte{})
-			if _, err = buf.WriteString("RIFF"); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, uint32(s.size+36)); err != nil {
-				return
-			}
-			if _, err = buf.WriteString("WAVE"); err != nil {
-				return
-			}
-			if _, err = buf.WriteString("fmt "); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, uint32(16)); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, s.media.Format.FormatTag); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, s.media.Format.Channels); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, s.media.Format.SamplesPerSec); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian,
-				s.media.Format.SamplesPerSec*uint32(s.media.Format.Channels*s.media.Format.BitsPerSample)/8); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, s.media.Format.BlockAlign); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, s.media.Format.BitsPerSample); err != nil {
-				return
-			}
-			if _, err = buf.WriteString("data"); err != nil {
-				return
-			}
-			if err = binary.Write(buf, binary.LittleEndian, s.size); err != nil {
-				return
-			}
-			s.stream = append(buf.Bytes(), s.stream...)
+	}
+	pos := off + int64(n) - int64(len(r.header))
+	rest := p[n:]
+	if remain := r.size - pos; remain > 0 {
+		chunk := rest
+		if int64(len(chunk)) > remain {
+			chunk = chunk[:remain]
+		}
+		var m int
+		m, err = r.fd.ReadAt(chunk, r.offset+pos)
+		n += m
+		if err != nil && (err != io.EOF || m != len(chunk)) {
+			return
 		}
+		err = nil
+		pos += int64(m)
+		rest = rest[m:]
+	}
+	// riff chunks are word aligned, odd sized data is followed by a zero byte
+	for ; len(rest) > 0 && pos < r.size+r.pad; pos++ {
+		rest[0] = 0
+		rest = rest[1:]
+		n++
+	}
+	if n < len(p) {
+		err = io.EOF
 	}
-	stream = s.stream
 	return
 }
 
+func (r *soundReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.off + offset
+	case io.SeekEnd:
+		abs = r.Len() + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.off = abs
+	return abs, nil
+}
+
+func (r *soundReader) Close() error {
+	r.closed = true
+	return nil
+}
+
 func (s *sound) Media() MediaType {
 	return s.media
 }
@@ -0,0 +1,293 @@
+package wzexplorer_test
+
+import (
+	"bytes"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestMediaTypeKind(t *testing.T) {
+	for tag, want := range map[wzexplorer.FormatTag]wzexplorer.MediaKind{
+		wzexplorer.FormatTagPCM:       wzexplorer.MediaKindPCM,
+		wzexplorer.FormatTagMP3:       wzexplorer.MediaKindMP3,
+		wzexplorer.FormatTagIMAADPCM:  wzexplorer.MediaKindADPCM,
+		wzexplorer.FormatTagADPCM:     wzexplorer.MediaKindUnknown,
+		wzexplorer.FormatTagIEEEFloat: wzexplorer.MediaKindUnknown,
+	} {
+		m := wzexplorer.MediaType{HasFormat: true, Format: wzexplorer.WaveFormat{FormatTag: tag}}
+		if got := m.Kind(); got != want {
+			t.Errorf("tag %d: %s, want %s", tag, got, want)
+		}
+	}
+}
+
+func payload(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+// testSound opens a file holding a PCM sound "a/pcm", the same sound with an encrypted
+// format "a/enc" and a header-less mp3 "a/mp3", each with payload
+func testSound(t *testing.T, data []byte) wzexplorer.File {
+	t.Helper()
+	b := wztest.New(wzexplorer.IvGMS)
+	pcm := wztest.WaveFormat(1, 2, 22050, 88200, 4, 16)
+	return openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "pcm", Value: b.Sound(data)},
+		wztest.Prop{Name: "enc", Value: b.SoundMedia(data, wztest.Media{
+			SubType:    wzexplorer.MediaSubTypeWAVE,
+			FormatType: wzexplorer.FormatTypeWaveFormatEx,
+			Format:     pcm,
+			Encrypted:  true,
+		})},
+		wztest.Prop{Name: "mp3", Value: b.SoundMedia(data, wztest.Media{
+			SubType:    wzexplorer.MediaSubTypeMPEG1Audio,
+			FormatType: wzexplorer.FormatTypeNone,
+		})},
+	)})
+}
+
+func readAll(t *testing.T, s wzexplorer.Sound) []byte {
+	t.Helper()
+	r, err := s.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSoundOpen(t *testing.T) {
+	data := payload(301)
+	f := testSound(t, data)
+
+	pcm := readAll(t, f.MustGet("a/pcm").Sound())
+	// odd sized payload gets a pad byte
+	if len(pcm) != 44+len(data)+1 || string(pcm[:4]) != "RIFF" || !bytes.Equal(pcm[44:44+len(data)], data) || pcm[len(pcm)-1] != 0 {
+		t.Fatalf("pcm stream %d bytes, want a wav header, the payload and a pad byte", len(pcm))
+	}
+	if enc := readAll(t, f.MustGet("a/enc").Sound()); !bytes.Equal(enc, pcm) {
+		t.Error("encrypted format stream differs from the plain one")
+	}
+	if mp3 := readAll(t, f.MustGet("a/mp3").Sound()); !bytes.Equal(mp3, data) {
+		t.Error("header-less mp3 stream isn't the raw payload")
+	}
+}
+
+func TestSoundReaderSeek(t *testing.T) {
+	data := payload(301)
+	s := testSound(t, data).MustGet("a/pcm").Sound()
+	whole := readAll(t, s)
+	r, err := s.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, c := range []struct {
+		offset int64
+		whence int
+		pos    int64
+	}{
+		{40, io.SeekStart, 40},
+		{10, io.SeekCurrent, 58},
+		{-10, io.SeekEnd, int64(len(whole) - 10)},
+		{2, io.SeekCurrent, int64(len(whole))},
+	} {
+		pos, err := r.Seek(c.offset, c.whence)
+		if err != nil || pos != c.pos {
+			t.Fatalf("Seek(%d, %d) = %d, %v, want %d", c.offset, c.whence, pos, err, c.pos)
+		}
+		// reads straddle the header and the payload
+		end := pos + 8
+		if end > int64(len(whole)) {
+			end = int64(len(whole))
+		}
+		buf := make([]byte, 8)
+		n, _ := io.ReadFull(r, buf)
+		if want := whole[pos:end]; !bytes.Equal(buf[:n], want) {
+			t.Errorf("read at %d = %x, want %x", pos, buf[:n], want)
+		}
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read at end = %d, %v, want io.EOF", n, err)
+	}
+	if _, err = r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeking before the start succeeded")
+	}
+}
+
+func TestSoundReaderReadAt(t *testing.T) {
+	data := payload(301)
+	for _, name := range []string{"a/pcm", "a/mp3"} {
+		s := testSound(t, data).MustGet(name).Sound()
+		whole := readAll(t, s)
+		r, err := s.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ra, ok := r.(io.ReaderAt)
+		if !ok {
+			t.Fatal("sound reader doesn't implement io.ReaderAt")
+		}
+
+		for _, off := range []int{0, 40, 43, 44, 100, len(whole) - 16} {
+			buf := make([]byte, 16)
+			if n, err := ra.ReadAt(buf, int64(off)); n != 16 || err != nil {
+				t.Errorf("%s ReadAt(%d) = %d, %v", name, off, n, err)
+			} else if !bytes.Equal(buf, whole[off:off+16]) {
+				t.Errorf("%s ReadAt(%d) = %x, want %x", name, off, buf, whole[off:off+16])
+			}
+		}
+		buf := make([]byte, 16)
+		if n, err := ra.ReadAt(buf, int64(len(whole)-4)); n != 4 || err != io.EOF {
+			t.Errorf("%s ReadAt past the end = %d, %v, want 4, io.EOF", name, n, err)
+		}
+		if _, err := ra.ReadAt(buf, int64(len(whole))); err != io.EOF {
+			t.Errorf("%s ReadAt at the end = %v, want io.EOF", name, err)
+		}
+		// range reads don't move the read offset
+		if n, _ := io.ReadFull(r, buf); n != 16 || !bytes.Equal(buf, whole[:16]) {
+			t.Errorf("%s Read after ReadAt = %x, want %x", name, buf[:n], whole[:16])
+		}
+
+		_ = r.Close()
+		if _, err := ra.ReadAt(buf, 0); err == nil {
+			t.Errorf("%s ReadAt after Close succeeded", name)
+		}
+	}
+}
+
+func TestSoundOpenWAVPadded(t *testing.T) {
+	data := payload(301)
+	s := testSound(t, data).MustGet("a/pcm").Sound()
+	r, err := s.OpenWAV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	wav, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := parseRIFF(t, wav)
+	if last := chunks[len(chunks)-1]; last.id != "data" || !bytes.Equal(last.data, data) {
+		t.Errorf("last chunk %q of %d bytes, want the payload", last.id, len(last.data))
+	}
+
+	stream, err := s.Stream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stream, wav) {
+		t.Error("Stream and OpenWAV differ")
+	}
+}
+
+func TestSoundDecode(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	// one mono block, see wzsound ima adpcm tests
+	block := []byte{100, 0, 0, 0, 0x77, 0x77, 0xf0, 0x08}
+	f := openTest(t, b, wzexplorer.IvEmpty, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "pcm", Value: b.Sound(payload(8))},
+		wztest.Prop{Name: "ima", Value: b.SoundMedia(block, wztest.Media{
+			SubType:    wzexplorer.MediaSubTypeWAVE,
+			FormatType: wzexplorer.FormatTypeWaveFormatEx,
+			Format:     wztest.WaveFormat(uint16(wzexplorer.FormatTagIMAADPCM), 1, 22050, 11100, 8, 4),
+		})},
+		wztest.Prop{Name: "unknown", Value: b.SoundMedia(payload(8), wztest.Media{
+			SubType:    wzexplorer.MediaSubTypeWAVE,
+			FormatType: wzexplorer.FormatTypeWaveFormatEx,
+			Format:     wztest.WaveFormat(uint16(wzexplorer.FormatTagIEEEFloat), 1, 22050, 88200, 4, 32),
+		})},
+	)})
+
+	pcm, err := f.MustGet("a/pcm").Sound().Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcm.SampleRate != 22050 || pcm.Channels != 2 || pcm.BitsPerSample != 16 || !bytes.Equal(pcm.Data, payload(8)) {
+		t.Errorf("pcm decoded to %d Hz %d channels %d bits %x", pcm.SampleRate, pcm.Channels, pcm.BitsPerSample, pcm.Data)
+	}
+
+	ima, err := f.MustGet("a/ima").Sound().Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples, _ := ima.Int16(); len(samples) != 9 || samples[0] != 100 || samples[8] != 89 {
+		t.Errorf("ima adpcm decoded to %v", samples)
+	}
+
+	if _, err = f.MustGet("a/unknown").Sound().Decode(); err != wzexplorer.ErrUnknownSoundFormat {
+		t.Errorf("float decode error %v, want ErrUnknownSoundFormat", err)
+	}
+}
+
+func TestSoundParseVariants(t *testing.T) {
+	f := testSound(t, payload(8))
+	b := wztest.New(wzexplorer.IvEmpty)
+	other := openTest(t, b, wzexplorer.IvEmpty, wztest.Entry{Name: "a.img", Image: b.Properties(
+		// a null format type is header-less as well
+		wztest.Prop{Name: "null", Value: b.SoundMedia(payload(8), wztest.Media{SubType: wzexplorer.MediaSubTypePCM})},
+		// unknown format types carry a format block unless reserved1 is set
+		wztest.Prop{Name: "custom", Value: b.SoundMedia(payload(8), wztest.Media{
+			SubType:    wzexplorer.MediaSubTypeWAVE,
+			FormatType: wzexplorer.MediaTypeAudio,
+			Format:     wztest.WaveFormat(uint16(wzexplorer.FormatTagMP3), 2, 44100, 16000, 1, 0),
+		})},
+	)})
+
+	pcmFormat := wzexplorer.NewPCMWaveFormat(22050, 2, 16)
+	for _, c := range []struct {
+		s         wzexplorer.Sound
+		hasFormat bool
+		encrypted bool
+		tag       wzexplorer.FormatTag
+		kind      wzexplorer.MediaKind
+	}{
+		{f.MustGet("a/pcm").Sound(), true, false, wzexplorer.FormatTagPCM, wzexplorer.MediaKindPCM},
+		{f.MustGet("a/enc").Sound(), true, true, wzexplorer.FormatTagPCM, wzexplorer.MediaKindPCM},
+		{f.MustGet("a/mp3").Sound(), false, false, wzexplorer.FormatTagMP3, wzexplorer.MediaKindMP3},
+		{other.MustGet("a/null").Sound(), false, false, 0, wzexplorer.MediaKindPCM},
+		{other.MustGet("a/custom").Sound(), true, false, wzexplorer.FormatTagMP3, wzexplorer.MediaKindMP3},
+	} {
+		m := c.s.Media()
+		if m.HasFormat != c.hasFormat || m.EncryptedFormat != c.encrypted || m.Format.FormatTag != c.tag || m.Kind() != c.kind {
+			t.Errorf("%s/%s: format %v encrypted %v tag %d kind %s, want %v %v %d %s", m.SubType, m.FormatType,
+				m.HasFormat, m.EncryptedFormat, m.Format.FormatTag, m.Kind(), c.hasFormat, c.encrypted, c.tag, c.kind)
+		}
+		if m.MajorType != wzexplorer.MediaTypeStream {
+			t.Errorf("major type %s", m.MajorType)
+		}
+		if c.tag == wzexplorer.FormatTagPCM && !reflect.DeepEqual(m.Format, pcmFormat) {
+			t.Errorf("%s format %+v, want %+v", m.SubType, m.Format, pcmFormat)
+		}
+	}
+	if d := f.MustGet("a/pcm").Sound().Duration(); d != 0 {
+		t.Errorf("8 byte duration %s, want 0", d)
+	}
+}
+
+func TestSoundParseInvalidFormat(t *testing.T) {
+	b := wztest.New(wzexplorer.IvGMS)
+	f := openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "bad", Value: b.SoundMedia(payload(8), wztest.Media{
+			SubType:    wzexplorer.MediaSubTypeWAVE,
+			FormatType: wzexplorer.FormatTypeWaveFormatEx,
+			Format:     make([]byte, 18),
+		})},
+	)})
+	if o, err := f.Get("a/bad"); err == nil {
+		t.Errorf("zero channel format parsed as %v", o)
+	}
+}
@@ -0,0 +1,168 @@
+package wzexplorer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// provider returns the provider o reads through, file groups borrow the one of their first file
+func (o *object) provider() *CryptProvider {
+	if o.f != nil {
+		return o.f.b.provider
+	}
+	if group, ok := o.o.([]File); ok && len(group) > 0 {
+		if f, ok := group[0].(*file); ok {
+			return f.b.provider
+		}
+	}
+	return nil
+}
+
+// locked runs fn holding the provider lock
+func (o *object) locked(fn func()) {
+	if cp := o.provider(); cp != nil {
+		cp.lock.Lock()
+		defer cp.lock.Unlock()
+	}
+	fn()
+}
+
+// Unload drops parsed children so they parse again on next access,
+// objects already handed out keep working, directories owning opened files keep their entries
+func (o *object) Unload() {
+	o.locked(o.unload)
+}
+
+func unloadFiles(group []File) {
+	for _, f := range group {
+		if cf, ok := f.(*file); ok {
+			cf.unload()
+		}
+	}
+}
+
+// unload caller must hold the provider lock
+func (o *object) unload() {
+	if o.flag&flagLoaded == 0 {
+		return
+	}
+	switch m := o.o.(type) {
+	case map[string]Object:
+		owner := false
+		for _, v := range m {
+			if c, ok := v.(*object); ok {
+				c.unload()
+				owner = owner || c.flag&(flagFile|flagDirectory) != 0
+			}
+		}
+		if owner {
+			// sub files are closed by Close through these entries
+			return
+		}
+	case *file:
+		m.unload()
+		return
+	case *files:
+		unloadFiles(m.o.([]File))
+		return
+	case []File:
+		unloadFiles(m)
+		return
+	case Properties[KVPair]:
+	default:
+		// leaves hand out their value without parsing again
+		return
+	}
+	o.o = nil
+	o.flag &^= flagLoaded
+}
+
+// sweep unloads images not parsed since deadline, caller must hold the provider lock
+func (o *object) sweep(deadline int64) (n int) {
+	if o.flag&flagLoaded == 0 {
+		return
+	}
+	switch m := o.o.(type) {
+	case map[string]Object:
+		for _, v := range m {
+			c, ok := v.(*object)
+			if !ok || c.flag&flagLoaded == 0 {
+				continue
+			}
+			if c.t == ObjectTypeDirectory {
+				n += c.sweep(deadline)
+			} else if atomic.LoadInt64(&c.atime) < deadline {
+				c.unload()
+				n++
+			}
+		}
+	case *file:
+		n += m.sweep(deadline)
+	case *files:
+		n += sweepFiles(m.o.([]File), deadline)
+	case []File:
+		n += sweepFiles(m, deadline)
+	}
+	return
+}
+
+func sweepFiles(group []File, deadline int64) (n int) {
+	for _, f := range group {
+		if cf, ok := f.(*file); ok {
+			n += cf.sweep(deadline)
+		}
+	}
+	return
+}
+
+func rootObject(root GetObject) *object {
+	switch r := root.(type) {
+	case *base:
+		return rootObject(r.File)
+	case *file:
+		return r.object
+	case *files:
+		return r.object
+	case *object:
+		return r
+	}
+	return nil
+}
+
+// UnloadIdle unloads every loaded image below root not accessed within idle, returns images unloaded
+func UnloadIdle(root GetObject, idle time.Duration) (n int) {
+	o := rootObject(root)
+	if o == nil {
+		return
+	}
+	deadline := time.Now().Add(-idle).UnixNano()
+	o.locked(func() {
+		n = o.sweep(deadline)
+	})
+	return
+}
+
+// AutoUnload runs UnloadIdle every idle/2 until ctx is done,
+// the returned channel is closed once the last sweep returned so root can be closed safely
+func AutoUnload(ctx context.Context, root GetObject, idle time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	interval := idle / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				UnloadIdle(root, idle)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,129 @@
+package wzexplorer_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func unloadArchive(t *testing.T) wzexplorer.File {
+	b := wztest.New(wzexplorer.IvGMS)
+	var entries []wztest.Entry
+	for i := 0; i < 4; i++ {
+		entries = append(entries, wztest.Entry{Name: fmt.Sprintf("%d.img", i), Image: b.Properties(
+			wztest.Prop{Name: "name", Value: fmt.Sprintf("image %d", i)},
+			wztest.Prop{Name: "sub", Value: b.Properties(
+				wztest.Prop{Name: "id", Value: int32(i)},
+			)},
+		)})
+	}
+	return openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "Dir", Dir: entries})
+}
+
+func TestUnloadReparses(t *testing.T) {
+	f := unloadArchive(t)
+	img := f.MustGet("Dir/1")
+	if img.MustGet("sub/id").Int32() != 1 {
+		t.Fatal("before unload")
+	}
+	img.Unload()
+	if v := img.MustGet("sub/id"); v == nil || v.Int32() != 1 {
+		t.Fatal("after unload")
+	}
+	if n := wzexplorer.UnloadIdle(f, 0); n != 1 {
+		t.Fatalf("unloaded %d images, want 1", n)
+	}
+	if v := f.MustGet("Dir/1/name"); v == nil || v.String() != "image 1" {
+		t.Fatal("after UnloadIdle")
+	}
+}
+
+func TestUnloadCanvas(t *testing.T) {
+	b := wztest.New(wzexplorer.IvGMS)
+	pixels := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	f := openTest(t, b, wzexplorer.IvGMS, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "c", Value: b.Canvas(2, 2, int32(wzexplorer.CanvasFormatBGRA8888), pixels,
+			wztest.Prop{Name: "z", Value: int32(7)},
+		)},
+	)})
+	c := f.MustGet("a/c")
+	size := c.DataSize()
+	c.Canvas().Unload()
+	if v := c.MustGet("z"); v == nil || v.Int32() != 7 {
+		t.Fatal("canvas property after unload")
+	}
+	if c.DataSize() != size {
+		t.Errorf("data size %d after unload, want %d", c.DataSize(), size)
+	}
+	data, _, err := c.Canvas().Pixels()
+	if err != nil || string(data) != string(pixels) {
+		t.Errorf("pixels after unload %v %v", data, err)
+	}
+}
+
+func TestUnloadDuringLoad(t *testing.T) {
+	f := unloadArchive(t)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				n := (g + i) % 4
+				name := f.MustGet(fmt.Sprintf("Dir/%d/name", n))
+				id := f.MustGet(fmt.Sprintf("Dir/%d/sub/id", n))
+				if name == nil || name.String() != fmt.Sprintf("image %d", n) || id == nil || id.Int32() != int32(n) {
+					t.Errorf("image %d read wrong after unload", n)
+					return
+				}
+			}
+		}(g)
+	}
+	unloaded := make(chan struct{})
+	go func() {
+		defer close(unloaded)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			wzexplorer.UnloadIdle(f, 0)
+			if img := f.MustGet("Dir/2"); img != nil {
+				img.Unload()
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	<-unloaded
+}
+
+func TestAutoUnloadStops(t *testing.T) {
+	f := unloadArchive(t)
+	if f.MustGet("Dir/0/name") == nil {
+		t.Fatal("missing Dir/0/name")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := wzexplorer.AutoUnload(ctx, f, time.Millisecond)
+	if !testing.Short() {
+		// the shortest interval is a second
+		time.Sleep(1500 * time.Millisecond)
+		if n := wzexplorer.UnloadIdle(f, 0); n != 0 {
+			t.Errorf("%d images left loaded", n)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("AutoUnload did not stop after cancel")
+	}
+}
@@ -0,0 +1,225 @@
+package wzexplorer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+)
+
+type VerifyIssueKind byte
+
+const (
+	// VerifyParse entry fails to parse
+	VerifyParse VerifyIssueKind = iota
+	// VerifyTruncated entry extends past the end of its file
+	VerifyTruncated
+	// VerifySize parsed extent differs from the size the directory declares
+	VerifySize
+	// VerifyChecksum byte sum differs from the checksum the directory declares
+	VerifyChecksum
+	// VerifyCanvas canvas fails to inflate or inflates to the wrong pixel count
+	VerifyCanvas
+)
+
+func (k VerifyIssueKind) String() string {
+	switch k {
+	case VerifyParse:
+		return "parse"
+	case VerifyTruncated:
+		return "truncated"
+	case VerifySize:
+		return "size"
+	case VerifyChecksum:
+		return "checksum"
+	case VerifyCanvas:
+		return "canvas"
+	}
+	return "unknown"
+}
+
+type VerifyIssue struct {
+	Path string
+	Kind VerifyIssueKind
+	Err  error
+}
+
+func (i *VerifyIssue) String() string {
+	return i.Path + ": " + i.Kind.String() + ": " + i.Err.Error()
+}
+
+type VerifyOptions struct {
+	// NoChecksum skips summing the raw bytes of every image
+	NoChecksum bool
+	// NoCanvas skips inflating canvases
+	NoCanvas bool
+	// Progress called before each image is verified
+	Progress func(path string)
+}
+
+type VerifyReport struct {
+	Images   int
+	Canvases int
+	Issues   []*VerifyIssue
+}
+
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+type verifier struct {
+	opts   *VerifyOptions
+	report *VerifyReport
+}
+
+func (v *verifier) issue(p string, kind VerifyIssueKind, err error) {
+	v.report.Issues = append(v.report.Issues, &VerifyIssue{Path: p, Kind: kind, Err: err})
+}
+
+func (v *verifier) directory(p string, dir GetObject) {
+	m := make(map[string]Object)
+	if err := dir.Each(func(name string, o Object) error {
+		m[name] = o
+		return nil
+	}); err != nil {
+		v.issue(p, VerifyParse, err)
+		return
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		o := m[name]
+		cp := path.Join(p, name)
+		if o.Type() == ObjectTypeDirectory {
+			v.directory(cp, o)
+			continue
+		}
+		if e, ok := o.(*object); ok {
+			v.image(cp, e)
+		}
+	}
+}
+
+func checksum(r io.ReaderAt, offset, size int64) (sum int32, err error) {
+	buf := make([]byte, 64*1024)
+	for size > 0 {
+		n := int64(len(buf))
+		if n > size {
+			n = size
+		}
+		if _, err = r.ReadAt(buf[:n], offset); err != nil {
+			return
+		}
+		for _, c := range buf[:n] {
+			sum += int32(c)
+		}
+		offset += n
+		size -= n
+	}
+	return
+}
+
+// image verifies a directory entry, it's parsed again so cached state never hides corruption
+func (v *verifier) image(p string, o *object) {
+	if v.opts.Progress != nil {
+		v.opts.Progress(p)
+	}
+	v.report.Images++
+
+	b := o.f.b
+	start, size := o.baseOffset, int64(o.size)
+	if start+size > b.Len() {
+		v.issue(p, VerifyTruncated, fmt.Errorf("entry ends at %d past file end %d", start+size, b.Len()))
+		return
+	}
+
+	if !v.opts.NoChecksum {
+		sum, err := checksum(b.fd, start, size)
+		if err != nil {
+			v.issue(p, VerifyParse, err)
+			return
+		}
+		if sum != o.checksum {
+			v.issue(p, VerifyChecksum, fmt.Errorf("checksum %d declared %d", sum, o.checksum))
+		}
+	}
+
+	e := &object{f: o.f, baseOffset: start, offset: start, size: o.size}
+	lock := &b.provider.lock
+	lock.Lock()
+	err := e.parseImage()
+	end := b.off
+	lock.Unlock()
+	if err != nil {
+		v.issue(p, VerifyParse, err)
+		return
+	}
+	if end-start != size {
+		v.issue(p, VerifySize, fmt.Errorf("parsed %d bytes declared %d", end-start, size))
+	}
+
+	if !v.opts.NoCanvas {
+		v.canvases(p, e)
+	}
+}
+
+// canvases inflates every canvas below o
+func (v *verifier) canvases(p string, o Object) {
+	if o.Type() == ObjectTypeCanvas {
+		v.report.Canvases++
+		if err := o.Value().(*canvas).verify(); err != nil {
+			v.issue(p, VerifyCanvas, err)
+		}
+	}
+	switch o.Type() {
+	case ObjectTypeProperties, ObjectTypeConvex, ObjectTypeCanvas:
+	default:
+		return
+	}
+	if err := o.Each(func(name string, c Object) error {
+		v.canvases(path.Join(p, name), c)
+		return nil
+	}); err != nil {
+		v.issue(p, VerifyParse, err)
+	}
+}
+
+func (c *canvas) verify() error {
+	expected, err := c.pixelSize()
+	if err != nil {
+		return err
+	}
+
+	in, err := c.inflater()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	n, err := io.Copy(io.Discard, in)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if n != int64(expected) {
+		return fmt.Errorf("inflated %d bytes %dx%d %s needs %d", n, c.width, c.height, c.format, expected)
+	}
+	return nil
+}
+
+// Verify checks every image below root against its directory entry and inflates every canvas,
+// root must be a File or a directory object, corruption is reported instead of returned
+func Verify(root GetObject, opts *VerifyOptions) (*VerifyReport, error) {
+	if o, ok := root.(Object); ok && o.Type() != ObjectTypeDirectory {
+		return nil, errors.New("not a directory")
+	}
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	v := &verifier{opts: opts, report: &VerifyReport{}}
+	v.directory("/", root)
+	return v.report, nil
+}
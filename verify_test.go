@@ -0,0 +1,132 @@
+package wzexplorer_test
+
+import (
+	"bytes"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openBytes opens archive data written by wztest.Builder.File
+func openBytes(t *testing.T, data []byte) wzexplorer.File {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "Test.wz")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func verify(t *testing.T, root wzexplorer.GetObject, opts *wzexplorer.VerifyOptions) *wzexplorer.VerifyReport {
+	t.Helper()
+	r, err := wzexplorer.Verify(root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func checkIssues(t *testing.T, r *wzexplorer.VerifyReport, want map[string]wzexplorer.VerifyIssueKind) {
+	t.Helper()
+	got := make(map[string]wzexplorer.VerifyIssueKind)
+	for _, i := range r.Issues {
+		got[i.Path] = i.Kind
+	}
+	if len(got) != len(want) || len(r.Issues) != len(want) {
+		t.Errorf("issues %v, want %v", r.Issues, want)
+	}
+	for p, kind := range want {
+		if k, ok := got[p]; !ok || k != kind {
+			t.Errorf("%s: issue %s, want %s", p, k, kind)
+		}
+	}
+}
+
+func TestVerifyClean(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := openBytes(t, b.File(
+		wztest.Entry{Name: "Map", Dir: []wztest.Entry{
+			{Name: "a.img", Image: b.Properties(
+				wztest.Prop{Name: "icon", Value: b.Canvas(2, 2, int32(wzexplorer.CanvasFormatBGRA8888), make([]byte, 16),
+					wztest.Prop{Name: "inner", Value: b.Canvas(1, 1, int32(wzexplorer.CanvasFormatBGRA8888), make([]byte, 4))},
+				)},
+			)},
+		}},
+		wztest.Entry{Name: "b.img", Image: b.Properties(wztest.Prop{Name: "v", Value: int32(1)})},
+	))
+
+	var progress []string
+	r := verify(t, f, &wzexplorer.VerifyOptions{Progress: func(p string) { progress = append(progress, p) }})
+	if !r.OK() || r.Images != 2 || r.Canvases != 2 {
+		t.Errorf("report %d images %d canvases issues %v", r.Images, r.Canvases, r.Issues)
+	}
+	if len(progress) != 2 || progress[0] != "/Map/a" || progress[1] != "/b" {
+		t.Errorf("progress %v", progress)
+	}
+
+	r = verify(t, f.MustGet("Map"), &wzexplorer.VerifyOptions{NoCanvas: true})
+	if !r.OK() || r.Images != 1 || r.Canvases != 0 {
+		t.Errorf("NoCanvas report %d images %d canvases", r.Images, r.Canvases)
+	}
+	if _, err := wzexplorer.Verify(f.MustGet("b"), nil); err == nil {
+		t.Error("verified an image as root")
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	// trailing bytes are counted in the declared size but never parsed
+	padded := append(b.Properties(wztest.Prop{Name: "v", Value: int32(1)}), 0, 0, 0)
+	data := b.File(
+		wztest.Entry{Name: "clean.img", Image: b.Properties(wztest.Prop{Name: "v", Value: int32(1)})},
+		wztest.Entry{Name: "flipped.img", Image: b.Properties(wztest.Prop{Name: "v", Value: int32(0x11223344)})},
+		wztest.Entry{Name: "padded.img", Image: padded},
+		wztest.Entry{Name: "short.img", Image: b.Properties(
+			wztest.Prop{Name: "c", Value: b.Canvas(2, 2, int32(wzexplorer.CanvasFormatBGRA8888), make([]byte, 4))},
+		)},
+	)
+	i := bytes.Index(data, []byte{0x44, 0x33, 0x22, 0x11})
+	if i < 0 {
+		t.Fatal("value not found")
+	}
+	data[i]++
+
+	f := openBytes(t, data)
+	checkIssues(t, verify(t, f, nil), map[string]wzexplorer.VerifyIssueKind{
+		"/flipped": wzexplorer.VerifyChecksum,
+		"/padded":  wzexplorer.VerifySize,
+		"/short/c": wzexplorer.VerifyCanvas,
+	})
+	checkIssues(t, verify(t, f, &wzexplorer.VerifyOptions{NoChecksum: true, NoCanvas: true}), map[string]wzexplorer.VerifyIssueKind{
+		"/padded": wzexplorer.VerifySize,
+	})
+}
+
+func TestVerifyTruncated(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	data := b.File(
+		wztest.Entry{Name: "a.img", Image: b.Properties(wztest.Prop{Name: "v", Value: int32(1)})},
+		wztest.Entry{Name: "b.img", Image: b.Properties(wztest.Prop{Name: "v", Value: "the last image"})},
+	)
+	f := openBytes(t, data[:len(data)-4])
+	r := verify(t, f, nil)
+	checkIssues(t, r, map[string]wzexplorer.VerifyIssueKind{"/b": wzexplorer.VerifyTruncated})
+	if r.Images != 2 {
+		t.Errorf("%d images, want 2", r.Images)
+	}
+	if s := r.Issues[0].String(); !strings.HasPrefix(s, "/b: truncated: ") {
+		t.Errorf("issue %q", s)
+	}
+}
@@ -0,0 +1,94 @@
+package wzexplorer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// fmtChunk WAVEFORMATEX body, PCM without extras keeps the 16 bytes PCMWAVEFORMAT layout
+func (f WaveFormat) fmtChunk() []byte {
+	buf := bytes.NewBuffer([]byte{})
+	_ = binary.Write(buf, binary.LittleEndian, f.FormatTag)
+	_ = binary.Write(buf, binary.LittleEndian, f.Channels)
+	_ = binary.Write(buf, binary.LittleEndian, f.SamplesPerSec)
+
+	avg, align := f.AvgBytesPerSec, f.BlockAlign
+	if f.FormatTag == FormatTagPCM {
+		if align == 0 {
+			align = f.Channels * f.BitsPerSample / 8
+		}
+		if avg == 0 {
+			avg = f.SamplesPerSec * uint32(align)
+		}
+	}
+	_ = binary.Write(buf, binary.LittleEndian, avg)
+	_ = binary.Write(buf, binary.LittleEndian, align)
+	_ = binary.Write(buf, binary.LittleEndian, f.BitsPerSample)
+
+	if f.FormatTag != FormatTagPCM || len(f.Extra) > 0 {
+		_ = binary.Write(buf, binary.LittleEndian, uint16(len(f.Extra)))
+		buf.Write(f.Extra)
+	}
+	return buf.Bytes()
+}
+
+// WAVHeader returns the RIFF header up to the data chunk payload, the writer appends a pad byte
+// to odd sized data, samples is the per channel sample count written to the fact chunk of non PCM formats
+func (f WaveFormat) WAVHeader(dataSize uint32, samples uint32) []byte {
+	chunk := f.fmtChunk()
+	fmtSize := len(chunk) + len(chunk)&1
+
+	// odd sized data is followed by a pad byte that counts toward the riff size
+	riffSize := 4 + 8 + fmtSize + 8 + int(dataSize) + int(dataSize&1)
+	if f.FormatTag != FormatTagPCM {
+		riffSize += 12
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(riffSize))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(chunk)))
+	buf.Write(chunk)
+	if len(chunk)&1 == 1 {
+		buf.WriteByte(0)
+	}
+	if f.FormatTag != FormatTagPCM {
+		buf.WriteString("fact")
+		_ = binary.Write(buf, binary.LittleEndian, uint32(4))
+		_ = binary.Write(buf, binary.LittleEndian, samples)
+	}
+	buf.WriteString("data")
+	_ = binary.Write(buf, binary.LittleEndian, dataSize)
+	return buf.Bytes()
+}
+
+// WriteWAV writes data wrapped in a wav container of format f
+func WriteWAV(w io.Writer, f WaveFormat, samples uint32, data []byte) error {
+	if _, err := w.Write(f.WAVHeader(uint32(len(data)), samples)); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if len(data)&1 == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// NewPCMWaveFormat returns the format of interleaved integer samples
+func NewPCMWaveFormat(sampleRate, channels, bitsPerSample int) WaveFormat {
+	align := uint16(channels * bitsPerSample / 8)
+	return WaveFormat{
+		FormatTag:      FormatTagPCM,
+		Channels:       uint16(channels),
+		SamplesPerSec:  uint32(sampleRate),
+		AvgBytesPerSec: uint32(sampleRate) * uint32(align),
+		BlockAlign:     align,
+		BitsPerSample:  uint16(bitsPerSample),
+	}
+}
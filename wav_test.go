@@ -0,0 +1,117 @@
+package wzexplorer_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/anonymous5l/wzexplorer"
+	"testing"
+)
+
+type riffChunk struct {
+	id   string
+	data []byte
+}
+
+// parseRIFF checks the riff size and returns the chunks of a wav file
+func parseRIFF(t *testing.T, wav []byte) []riffChunk {
+	t.Helper()
+	if len(wav) < 12 || string(wav[:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		t.Fatalf("not a wav file: %x", wav)
+	}
+	if size := binary.LittleEndian.Uint32(wav[4:]); int(size) != len(wav)-8 {
+		t.Fatalf("riff size %d, want %d", size, len(wav)-8)
+	}
+	var chunks []riffChunk
+	for data := wav[12:]; len(data) > 0; {
+		if len(data) < 8 {
+			t.Fatalf("truncated chunk header %x", data)
+		}
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		padded := size + size&1
+		if len(data) < 8+padded {
+			t.Fatalf("chunk %q of %d bytes overruns the file", data[:4], size)
+		}
+		chunks = append(chunks, riffChunk{id: string(data[:4]), data: data[8 : 8+size]})
+		data = data[8+padded:]
+	}
+	return chunks
+}
+
+func TestWAVHeaderPCM(t *testing.T) {
+	f := wzexplorer.NewPCMWaveFormat(22050, 2, 16)
+	want := []byte{
+		'R', 'I', 'F', 'F', 40, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 16, 0, 0, 0,
+		1, 0, 2, 0, 0x22, 0x56, 0, 0, 0x88, 0x58, 0x01, 0, 4, 0, 16, 0,
+		'd', 'a', 't', 'a', 4, 0, 0, 0,
+	}
+	if got := f.WAVHeader(4, 1); !bytes.Equal(got, want) {
+		t.Errorf("header\n%x\nwant\n%x", got, want)
+	}
+	// odd sized data counts its pad byte in the riff size but not in the data size
+	got := f.WAVHeader(5, 1)
+	if size := binary.LittleEndian.Uint32(got[4:]); size != 42 {
+		t.Errorf("odd data riff size %d, want 42", size)
+	}
+	if size := binary.LittleEndian.Uint32(got[40:]); size != 5 {
+		t.Errorf("odd data chunk size %d, want 5", size)
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	adpcm := wzexplorer.WaveFormat{
+		FormatTag:      wzexplorer.FormatTagIMAADPCM,
+		Channels:       1,
+		SamplesPerSec:  22050,
+		AvgBytesPerSec: 11100,
+		BlockAlign:     512,
+		BitsPerSample:  4,
+		ExtraSize:      2,
+		Extra:          []byte{0xf9, 0x03},
+	}
+	odd := adpcm
+	odd.Extra = []byte{1}
+
+	for name, c := range map[string]struct {
+		format wzexplorer.WaveFormat
+		data   []byte
+		ids    []string
+	}{
+		"pcm even":     {wzexplorer.NewPCMWaveFormat(8000, 1, 8), []byte{1, 2}, []string{"fmt ", "data"}},
+		"pcm odd":      {wzexplorer.NewPCMWaveFormat(8000, 1, 8), []byte{1, 2, 3}, []string{"fmt ", "data"}},
+		"adpcm":        {adpcm, []byte{1, 2, 3}, []string{"fmt ", "fact", "data"}},
+		"odd fmt size": {odd, []byte{1, 2, 3, 4}, []string{"fmt ", "fact", "data"}},
+	} {
+		var buf bytes.Buffer
+		if err := wzexplorer.WriteWAV(&buf, c.format, 1017, c.data); err != nil {
+			t.Fatal(err)
+		}
+		chunks := parseRIFF(t, buf.Bytes())
+		var ids []string
+		for _, ch := range chunks {
+			ids = append(ids, ch.id)
+		}
+		if len(ids) != len(c.ids) {
+			t.Fatalf("%s: chunks %v, want %v", name, ids, c.ids)
+		}
+		for i, ch := range chunks {
+			if ch.id != c.ids[i] {
+				t.Fatalf("%s: chunks %v, want %v", name, ids, c.ids)
+			}
+			switch ch.id {
+			case "fact":
+				if n := binary.LittleEndian.Uint32(ch.data); n != 1017 {
+					t.Errorf("%s: fact %d samples, want 1017", name, n)
+				}
+			case "data":
+				if !bytes.Equal(ch.data, c.data) {
+					t.Errorf("%s: data %x, want %x", name, ch.data, c.data)
+				}
+			case "fmt ":
+				if tag := binary.LittleEndian.Uint16(ch.data); tag != uint16(c.format.FormatTag) {
+					t.Errorf("%s: format tag %d", name, tag)
+				}
+			}
+		}
+	}
+}
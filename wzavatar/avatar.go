@@ -0,0 +1,438 @@
+package wzavatar
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wzvalue"
+	"image"
+	"image/draw"
+	"sort"
+	"strconv"
+)
+
+const (
+	DefaultAction     = "stand1"
+	DefaultExpression = "default"
+)
+
+var ErrActionNotFound = errors.New("action not found")
+
+type Character struct {
+	Skin int
+	Face int
+	Hair int
+	// Equips item ids, later items win slots shared with earlier ones
+	Equips []int
+	// Action body action, empty means DefaultAction
+	Action string
+	// Expression face expression, empty means DefaultExpression
+	Expression string
+}
+
+// Composer composes characters out of Character.wz ordered by Base.wz zmap
+type Composer struct {
+	character wzexplorer.GetObject
+	zmap      map[string]int
+	smap      map[string]string
+}
+
+// NewComposer character must point to Character.wz, base to Base.wz
+func NewComposer(character, base wzexplorer.GetObject) (*Composer, error) {
+	c := &Composer{
+		character: character,
+		zmap:      make(map[string]int),
+		smap:      make(map[string]string),
+	}
+
+	zmap, err := base.Get("zmap")
+	if err != nil {
+		return nil, err
+	}
+	if zmap == nil {
+		return nil, errors.New("zmap not found")
+	}
+	var names []string
+	if err = zmap.Each(func(name string, _ wzexplorer.Object) error {
+		names = append(names, name)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	// zmap lists layers from front to back
+	for i, name := range names {
+		c.zmap[name] = len(names) - i
+	}
+
+	smap, err := base.Get("smap")
+	if err != nil {
+		return nil, err
+	}
+	if smap != nil {
+		if err = smap.Each(func(name string, o wzexplorer.Object) error {
+			c.smap[name] = o.String()
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ItemPath returns the Character.wz relative image path of item id
+func ItemPath(id int) string {
+	var category string
+	switch id / 10000 {
+	case 0, 1:
+		category = ""
+	case 2, 5:
+		category = "Face/"
+	case 3, 4, 6:
+		category = "Hair/"
+	case 100:
+		category = "Cap/"
+	case 101, 102, 103, 112, 113, 114, 115:
+		category = "Accessory/"
+	case 104:
+		category = "Coat/"
+	case 105:
+		category = "Longcoat/"
+	case 106:
+		category = "Pants/"
+	case 107:
+		category = "Shoes/"
+	case 108:
+		category = "Glove/"
+	case 109:
+		category = "Shield/"
+	case 110:
+		category = "Cape/"
+	case 111:
+		category = "Ring/"
+	case 180:
+		category = "PetEquip/"
+	default:
+		if id/10000 >= 130 && id/10000 < 180 {
+			category = "Weapon/"
+		} else if id/10000 >= 190 && id/10000 < 200 {
+			category = "TamingMob/"
+		}
+	}
+	return fmt.Sprintf("%s%08d", category, id)
+}
+
+type part struct {
+	img   wzexplorer.Object
+	vslot string
+	// face parts are drawn from the expression instead of the action
+	face bool
+}
+
+type layer struct {
+	img    image.Image
+	origin image.Point
+	maps   map[string]image.Point
+	z      int
+	zName  string
+	owner  int
+	pos    image.Point
+	placed bool
+}
+
+// Frame composed frame, image bounds are relative to the character feet
+type Frame struct {
+	Image *image.NRGBA
+	// Delay frame delay in milliseconds
+	Delay int
+}
+
+func (c *Composer) parts(ch *Character) ([]*part, error) {
+	ids := []int{2000 + ch.Skin, 12000 + ch.Skin}
+	if ch.Face > 0 {
+		ids = append(ids, ch.Face)
+	}
+	if ch.Hair > 0 {
+		ids = append(ids, ch.Hair)
+	}
+	ids = append(ids, ch.Equips...)
+
+	parts := make([]*part, 0, len(ids))
+	for _, id := range ids {
+		img, err := c.character.Get(ItemPath(id))
+		if err != nil {
+			return nil, err
+		}
+		if img == nil {
+			return nil, fmt.Errorf("item %08d not found", id)
+		}
+		p := &part{img: img, face: ch.Face > 0 && id == ch.Face}
+		if vslot, err := img.Get("info/vslot"); err == nil && vslot != nil {
+			p.vslot = vslot.String()
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+func action(ch *Character) string {
+	if ch.Action == "" {
+		return DefaultAction
+	}
+	return ch.Action
+}
+
+func expression(ch *Character) string {
+	if ch.Expression == "" {
+		return DefaultExpression
+	}
+	return ch.Expression
+}
+
+// FrameCount returns frames of the character action
+func (c *Composer) FrameCount(ch *Character) (int, error) {
+	body, err := c.character.Get(ItemPath(2000+ch.Skin) + "/" + action(ch))
+	if err != nil {
+		return 0, err
+	}
+	if body == nil {
+		return 0, ErrActionNotFound
+	}
+	frames, err := body.Array()
+	if err != nil {
+		return 0, err
+	}
+	return len(frames), nil
+}
+
+func (c *Composer) collect(node wzexplorer.Object, owner int, layers []*layer) ([]*layer, error) {
+	var names []string
+	if err := node.Each(func(name string, _ wzexplorer.Object) error {
+		names = append(names, name)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// resolve uol children
+		o, err := node.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if o == nil || o.Type() != wzexplorer.ObjectTypeCanvas {
+			continue
+		}
+		cv := o.Canvas()
+		img, err := cv.Image()
+		if err != nil {
+			return nil, err
+		}
+		l := &layer{img: img, owner: owner, maps: make(map[string]image.Point)}
+		if origin, err := cv.Get("origin"); err == nil && origin != nil {
+			l.origin = origin.Vector()
+		}
+		if z, err := cv.Get("z"); err == nil && z != nil {
+			l.zName = z.String()
+			l.z = c.zmap[l.zName]
+		}
+		if m, err := cv.Get("map"); err == nil && m != nil {
+			if err = m.Each(func(name string, v wzexplorer.Object) error {
+				l.maps[name] = v.Vector()
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// visible layer z of owner isn't covered by slots of other parts
+func (c *Composer) visible(z string, owner int, slots map[string]int) bool {
+	s := c.smap[z]
+	for i := 0; i+2 <= len(s); i += 2 {
+		if o, ok := slots[s[i:i+2]]; ok && o != owner {
+			return false
+		}
+	}
+	return true
+}
+
+// Compose composes a single frame of the character action
+func (c *Composer) Compose(ch *Character, frame int) (*Frame, error) {
+	parts, err := c.parts(ch)
+	if err != nil {
+		return nil, err
+	}
+
+	act := action(ch)
+	frameName := strconv.Itoa(frame)
+
+	bodyFrame, err := parts[0].img.Get(act + "/" + frameName)
+	if err != nil {
+		return nil, err
+	}
+	if bodyFrame == nil {
+		return nil, ErrActionNotFound
+	}
+
+	result := &Frame{}
+	if delay, err := bodyFrame.Get("delay"); err == nil && delay != nil {
+		result.Delay = wzvalue.Int(delay)
+	}
+	showFace := true
+	if face, err := bodyFrame.Get("face"); err == nil && face != nil {
+		showFace = wzvalue.Int(face) != 0
+	}
+
+	// later parts own shared slots
+	slots := make(map[string]int)
+	for i, p := range parts {
+		for j := 0; j+2 <= len(p.vslot); j += 2 {
+			slots[p.vslot[j:j+2]] = i
+		}
+	}
+
+	var layers []*layer
+	for i, p := range parts {
+		var node wzexplorer.Object
+		if p.face {
+			if !showFace {
+				continue
+			}
+			if node, err = faceFrame(p.img, expression(ch), frame); err != nil {
+				return nil, err
+			}
+		} else {
+			if node, err = p.img.Get(act + "/" + frameName); err != nil {
+				return nil, err
+			}
+		}
+		if node == nil {
+			continue
+		}
+		if layers, err = c.collect(node, i, layers); err != nil {
+			return nil, err
+		}
+	}
+
+	var visible []*layer
+	for _, l := range layers {
+		if c.visible(l.zName, l.owner, slots) {
+			visible = append(visible, l)
+		}
+	}
+
+	result.Image = c.place(visible)
+	return result, nil
+}
+
+// faceFrame returns the expression frame shown in body frame, expressions either hold
+// canvases directly or loop over numbered frames
+func faceFrame(face wzexplorer.Object, expression string, frame int) (wzexplorer.Object, error) {
+	exp, err := face.Get(expression)
+	if err != nil || exp == nil {
+		return nil, err
+	}
+	first, err := exp.Get("0")
+	if err != nil {
+		return nil, err
+	} else if first == nil {
+		return exp, nil
+	}
+	frames, err := exp.Array()
+	if err != nil || len(frames) == 0 {
+		return first, err
+	}
+	return frames[frame%len(frames)], nil
+}
+
+func (c *Composer) place(visible []*layer) *image.NRGBA {
+	if len(visible) == 0 {
+		return image.NewNRGBA(image.Rectangle{})
+	}
+
+	// body canvas origin is the character feet
+	anchor := visible[0]
+	for _, l := range visible {
+		if l.zName == "body" {
+			anchor = l
+			break
+		}
+	}
+	anchors := make(map[string]image.Point)
+	anchor.placed = true
+	for name, p := range anchor.maps {
+		anchors[name] = p
+	}
+
+	for progress := true; progress; {
+		progress = false
+		for _, l := range visible {
+			if l.placed {
+				continue
+			}
+			names := make([]string, 0, len(l.maps))
+			for name := range l.maps {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if a, ok := anchors[name]; ok {
+					l.pos = a.Sub(l.maps[name])
+					l.placed = true
+					break
+				}
+			}
+			if !l.placed && len(l.maps) == 0 {
+				l.placed = true
+			}
+			if l.placed {
+				progress = true
+				for _, name := range names {
+					if _, ok := anchors[name]; !ok {
+						anchors[name] = l.pos.Add(l.maps[name])
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(visible, func(i, j int) bool {
+		return visible[i].z < visible[j].z
+	})
+
+	var bounds image.Rectangle
+	for _, l := range visible {
+		bounds = bounds.Union(l.rect())
+	}
+	dst := image.NewNRGBA(bounds)
+	for _, l := range visible {
+		draw.Draw(dst, l.rect(), l.img, l.img.Bounds().Min, draw.Over)
+	}
+	return dst
+}
+
+func (l *layer) rect() image.Rectangle {
+	min := l.pos.Sub(l.origin)
+	return image.Rectangle{Min: min, Max: min.Add(l.img.Bounds().Size())}
+}
+
+// Animate composes every frame of the character action
+func (c *Composer) Animate(ch *Character) ([]*Frame, error) {
+	n, err := c.FrameCount(ch)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]*Frame, 0, n)
+	for i := 0; i < n; i++ {
+		f, err := c.Compose(ch, i)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
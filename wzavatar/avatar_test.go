@@ -0,0 +1,202 @@
+package wzavatar
+
+import (
+	"bytes"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+var (
+	blue   = color.NRGBA{B: 0xff, A: 0xff}
+	red    = color.NRGBA{R: 0xff, A: 0xff}
+	green  = color.NRGBA{G: 0xff, A: 0xff}
+	yellow = color.NRGBA{R: 0xff, G: 0xff, A: 0xff}
+	white  = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	black  = color.NRGBA{A: 0xff}
+)
+
+// canvas encodes a BGRA8888 canvas of a single colour anchored at origin
+func canvas(b *wztest.Builder, w, h int32, c color.NRGBA, z string, origin image.Point, maps ...wztest.Prop) wztest.Object {
+	pixels := make([]byte, 0, w*h*4)
+	for i := int32(0); i < w*h; i++ {
+		pixels = append(pixels, c.B, c.G, c.R, c.A)
+	}
+	return b.Canvas(w, h, int32(wzexplorer.CanvasFormatBGRA8888), pixels,
+		wztest.Prop{Name: "origin", Value: b.Vector(int32(origin.X), int32(origin.Y))},
+		wztest.Prop{Name: "z", Value: z},
+		wztest.Prop{Name: "map", Value: b.Properties(maps...)},
+	)
+}
+
+func vec(b *wztest.Builder, name string, x, y int32) wztest.Prop {
+	return wztest.Prop{Name: name, Value: b.Vector(x, y)}
+}
+
+// item an item image with a stand1 action of two frames, the second links back to the first
+func item(b *wztest.Builder, vslot, name string, c wztest.Object) wztest.Object {
+	return b.Properties(
+		wztest.Prop{Name: "info", Value: b.Properties(wztest.Prop{Name: "vslot", Value: vslot})},
+		wztest.Prop{Name: "stand1", Value: b.Properties(
+			wztest.Prop{Name: "0", Value: b.Properties(wztest.Prop{Name: name, Value: c})},
+			wztest.Prop{Name: "1", Value: b.UOL("0")},
+		)},
+	)
+}
+
+func testComposer(t *testing.T) *Composer {
+	b := wztest.New(wzexplorer.IvEmpty)
+	body := b.Properties(wztest.Prop{Name: "stand1", Value: b.Properties(
+		wztest.Prop{Name: "0", Value: b.Properties(
+			wztest.Prop{Name: "body", Value: canvas(b, 4, 4, blue, "body", image.Pt(2, 4),
+				vec(b, "navel", 0, -2), vec(b, "neck", 0, -4))},
+			wztest.Prop{Name: "delay", Value: int32(100)},
+		)},
+		wztest.Prop{Name: "1", Value: b.Properties(
+			wztest.Prop{Name: "body", Value: canvas(b, 4, 4, blue, "body", image.Pt(2, 4),
+				vec(b, "navel", 0, -2), vec(b, "neck", 0, -4))},
+			wztest.Prop{Name: "delay", Value: int32(200)},
+		)},
+	)})
+	// head hangs off the body neck and exposes the brow to face, hair and cap
+	head := item(b, "", "head", canvas(b, 4, 4, red, "head", image.Pt(2, 4), vec(b, "neck", 0, 0), vec(b, "brow", 0, -2)))
+	face := b.Properties(
+		wztest.Prop{Name: "default", Value: b.Properties(
+			wztest.Prop{Name: "face", Value: canvas(b, 2, 1, white, "face", image.Pt(1, 0), vec(b, "brow", 0, 0))},
+		)},
+		wztest.Prop{Name: "blink", Value: b.Properties(
+			wztest.Prop{Name: "0", Value: b.Properties(
+				wztest.Prop{Name: "face", Value: canvas(b, 2, 1, white, "face", image.Pt(1, 0), vec(b, "brow", 0, 0))},
+			)},
+			wztest.Prop{Name: "1", Value: b.Properties(
+				wztest.Prop{Name: "face", Value: canvas(b, 2, 1, black, "face", image.Pt(1, 0), vec(b, "brow", 0, 0))},
+			)},
+		)},
+	)
+	hair := item(b, "H1", "hair", canvas(b, 4, 1, yellow, "hair", image.Pt(2, 1), vec(b, "brow", 0, 0)))
+	// the cap takes the hair slot over and hides the hair layer
+	capItem := item(b, "CpH1", "default", canvas(b, 4, 1, green, "cap", image.Pt(2, 2), vec(b, "brow", 0, 0)))
+
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, b.Write(t,
+		wztest.Entry{Name: "zmap.img", Image: b.Properties(
+			wztest.Prop{Name: "cap"}, wztest.Prop{Name: "face"}, wztest.Prop{Name: "hair"},
+			wztest.Prop{Name: "head"}, wztest.Prop{Name: "body"},
+		)},
+		wztest.Entry{Name: "smap.img", Image: b.Properties(
+			wztest.Prop{Name: "cap", Value: "Cp"}, wztest.Prop{Name: "hair", Value: "H1"},
+		)},
+		wztest.Entry{Name: "00002000.img", Image: body},
+		wztest.Entry{Name: "00012000.img", Image: head},
+		wztest.Entry{Name: "Face", Dir: []wztest.Entry{{Name: "00020000.img", Image: face}}},
+		wztest.Entry{Name: "Hair", Dir: []wztest.Entry{{Name: "00030000.img", Image: hair}}},
+		wztest.Entry{Name: "Cap", Dir: []wztest.Entry{{Name: "01000000.img", Image: capItem}}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	c, err := NewComposer(f, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func checkPixels(t *testing.T, img *image.NRGBA, want map[image.Point]color.NRGBA) {
+	t.Helper()
+	for p, c := range want {
+		if got := img.NRGBAAt(p.X, p.Y); got != c {
+			t.Errorf("%v = %v, want %v", p, got, c)
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	c := testComposer(t)
+	f, err := c.Compose(&Character{Face: 20000, Hair: 30000}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := image.Rect(-2, -8, 2, 0); f.Image.Bounds() != want {
+		t.Fatalf("bounds %v, want %v", f.Image.Bounds(), want)
+	}
+	if f.Delay != 100 {
+		t.Errorf("delay %d, want 100", f.Delay)
+	}
+	checkPixels(t, f.Image, map[image.Point]color.NRGBA{
+		// body origin is the feet, head hangs off the neck
+		{0, -1}:  blue,
+		{-2, -5}: red,
+		// face and hair sit on the head brow and zmap draws them above the head
+		{0, -6}:  white,
+		{-2, -7}: yellow,
+		{-2, -8}: red,
+	})
+}
+
+func TestComposeHidesSlots(t *testing.T) {
+	f, err := testComposer(t).Compose(&Character{Face: 20000, Hair: 30000, Equips: []int{1000000}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixels(t, f.Image, map[image.Point]color.NRGBA{
+		{-2, -8}: green,
+		// the cap owns H1 so the hair layer is hidden
+		{-2, -7}: red,
+		{0, -6}:  white,
+	})
+}
+
+func TestComposeFaceFrames(t *testing.T) {
+	c := testComposer(t)
+	ch := &Character{Face: 20000, Expression: "blink"}
+	for frame, want := range []color.NRGBA{white, black} {
+		f, err := c.Compose(ch, frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Image.NRGBAAt(0, -6); got != want {
+			t.Errorf("frame %d face = %v, want %v", frame, got, want)
+		}
+	}
+
+	// without a face the third part is the hair and follows the action
+	f, err := c.Compose(&Character{Hair: 30000}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixels(t, f.Image, map[image.Point]color.NRGBA{{0, -6}: red, {-2, -7}: yellow})
+}
+
+func TestWriteGIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testComposer(t).WriteGIF(&buf, &Character{Face: 20000, Expression: "blink"}); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 {
+		t.Fatalf("%d frames, want 2", len(anim.Image))
+	}
+	if anim.Delay[0] != 10 || anim.Delay[1] != 20 {
+		t.Errorf("delays %v, want [10 20]", anim.Delay)
+	}
+	if anim.Config.Width != 4 || anim.Config.Height != 8 {
+		t.Errorf("size %dx%d, want 4x8", anim.Config.Width, anim.Config.Height)
+	}
+	// frames are aligned on the feet, the face is two pixels above the head bottom
+	for i, want := range []color.NRGBA{white, black} {
+		if got := color.NRGBAModel.Convert(anim.Image[i].At(2, 2)); got != want {
+			t.Errorf("frame %d face = %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package wzavatar
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io"
+)
+
+var gifPalette = append(color.Palette{color.Transparent}, palette.WebSafe...)
+
+func paletted(img *image.NRGBA, bounds image.Rectangle) *image.Paletted {
+	// gif frame bounds must start at the origin of the animation canvas
+	p := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), gifPalette)
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A < 0x80 {
+				continue
+			}
+			c.A = 0xff
+			p.SetColorIndex(x-bounds.Min.X, y-bounds.Min.Y, uint8(gifPalette.Index(c)))
+		}
+	}
+	return p
+}
+
+// EncodeGIF writes frames as looping gif, frames are aligned on the character feet
+func EncodeGIF(w io.Writer, frames []*Frame) error {
+	if len(frames) == 0 {
+		return errors.New("no frames")
+	}
+
+	var bounds image.Rectangle
+	for _, f := range frames {
+		bounds = bounds.Union(f.Image.Bounds())
+	}
+
+	anim := &gif.GIF{}
+	for _, f := range frames {
+		anim.Image = append(anim.Image, paletted(f.Image, bounds))
+		anim.Delay = append(anim.Delay, f.Delay/10)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// WriteGIF composes every frame of the character action as gif
+func (c *Composer) WriteGIF(w io.Writer, ch *Character) error {
+	frames, err := c.Animate(ch)
+	if err != nil {
+		return err
+	}
+	return EncodeGIF(w, frames)
+}
@@ -23,11 +23,11 @@ func argb1555model(c color.Color) color.Color {
 	if _, ok := c.(ARGB1555); ok {
 		return c
 	}
-	cr, cg, cb, ca := c.RGBA()
-	r := (uint16(cr) & 0xf8) >> 3
-	g := (uint16(cg) & 0xf8) >> 3
-	b := (uint16(cb) & 0xf8) >> 3
-	a := uint16(ca >> 7)
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	r := uint16(n.R >> 3)
+	g := uint16(n.G >> 3)
+	b := uint16(n.B >> 3)
+	a := uint16(n.A >> 7)
 
 	return ARGB1555((a << 15) | (r << 10) | (g << 5) | b)
 }
@@ -27,16 +27,10 @@ func bgra4444model(c color.Color) color.Color {
 	if _, ok := c.(BGRA4444); ok {
 		return c
 	}
-	r, g, b, a := c.RGBA()
-
-	r = (r & 0xf0) >> 4
-	g = (g & 0xf0) >> 4
-	b = (b & 0xf0) >> 4
-	a = (a & 0xf0) >> 4
-
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
 	return BGRA4444{
-		BG: uint8(b) | (uint8(g) << 4),
-		RA: uint8(r) | (uint8(a) << 4),
+		BG: n.B>>4 | n.G&0xf0,
+		RA: n.R>>4 | n.A&0xf0,
 	}
 }
 
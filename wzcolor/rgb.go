@@ -7,24 +7,23 @@ import (
 type RGB565 uint16
 
 func (c RGB565) RGBA() (r, g, b, a uint32) {
-	r = uint32(c>>11) & 0x1f
-	g = uint32(c>>5) & 0x3f
-	b = uint32(c & 0x1f)
-	r <<= 3
-	g <<= 2
-	b <<= 3
-	a = 0xff
-	return
+	cr := (c >> 11) & 0x1f
+	cg := (c >> 5) & 0x3f
+	cb := c & 0x1f
+	return color.NRGBA{
+		R: uint8(cr << 3), G: uint8(cg << 2),
+		B: uint8(cb << 3), A: 0xff,
+	}.RGBA()
 }
 
 func rgb565model(c color.Color) color.Color {
 	if _, ok := c.(RGB565); ok {
 		return c
 	}
-	r, g, b, _ := c.RGBA()
-	r >>= 3
-	g >>= 2
-	b >>= 3
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	r := uint16(n.R >> 3)
+	g := uint16(n.G >> 2)
+	b := uint16(n.B >> 3)
 	return RGB565(r<<11 | g<<5 | b)
 }
 
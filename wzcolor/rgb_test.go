@@ -0,0 +1,27 @@
+package wzcolor
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestRGB565RGBA(t *testing.T) {
+	for _, tc := range []struct {
+		c          RGB565
+		r, g, b, a uint32
+	}{
+		{0xffff, 0xf8f8, 0xfcfc, 0xf8f8, 0xffff},
+		{0xf800, 0xf8f8, 0, 0, 0xffff},
+		{0x07e0, 0, 0xfcfc, 0, 0xffff},
+		{0x001f, 0, 0, 0xf8f8, 0xffff},
+		{0, 0, 0, 0, 0xffff},
+	} {
+		r, g, b, a := tc.c.RGBA()
+		if r != tc.r || g != tc.g || b != tc.b || a != tc.a {
+			t.Errorf("%#04x: %#x %#x %#x %#x, want %#x %#x %#x %#x", uint16(tc.c), r, g, b, a, tc.r, tc.g, tc.b, tc.a)
+		}
+		if got := RGB565Model.Convert(color.NRGBAModel.Convert(tc.c)); got != tc.c {
+			t.Errorf("%#04x: model round trip %#04x", uint16(tc.c), got)
+		}
+	}
+}
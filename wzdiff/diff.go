@@ -0,0 +1,283 @@
+package wzdiff
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/wzimage"
+	"hash/fnv"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+type ChangeKind byte
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return "unknown"
+}
+
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+type CanvasInfo struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	// Hash fnv-1a of the decoded NRGBA pixels
+	Hash string `json:"hash"`
+}
+
+type SoundInfo struct {
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"duration"`
+	// Hash fnv-1a of the stored payload
+	Hash string `json:"hash"`
+}
+
+// Value the compared state of one side of a change
+type Value struct {
+	Type   string      `json:"type"`
+	Value  interface{} `json:"value,omitempty"`
+	Canvas *CanvasInfo `json:"canvas,omitempty"`
+	Sound  *SoundInfo  `json:"sound,omitempty"`
+
+	obj wzexplorer.Object
+}
+
+// Object returns the object the value was read from
+func (v *Value) Object() wzexplorer.Object {
+	return v.obj
+}
+
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+	// Old nil when added
+	Old *Value `json:"old,omitempty"`
+	// New nil when removed
+	New *Value `json:"new,omitempty"`
+}
+
+type Result struct {
+	// Changes ordered by path, a removed or added container isn't expanded
+	Changes []*Change `json:"changes"`
+	// Skipped images whose size and checksum match
+	Skipped int `json:"skipped"`
+}
+
+type differ struct {
+	result *Result
+}
+
+func entries(o wzexplorer.GetObject) (map[string]wzexplorer.Object, error) {
+	m := make(map[string]wzexplorer.Object)
+	err := o.Each(func(name string, obj wzexplorer.Object) error {
+		m[name] = obj
+		return nil
+	})
+	return m, err
+}
+
+func container(t wzexplorer.ObjectType) bool {
+	switch t {
+	case wzexplorer.ObjectTypeDirectory, wzexplorer.ObjectTypeProperties,
+		wzexplorer.ObjectTypeConvex, wzexplorer.ObjectTypeCanvas:
+		return true
+	}
+	return false
+}
+
+func hashCanvas(c wzexplorer.Canvas) (string, error) {
+	img, err := c.Image()
+	if err != nil {
+		return "", err
+	}
+	nrgba := wzimage.ToNRGBA(img)
+	h := fnv.New64a()
+	b := nrgba.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		off := nrgba.PixOffset(b.Min.X, y)
+		h.Write(nrgba.Pix[off : off+b.Dx()*4])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func soundInfo(s wzexplorer.Sound) (*SoundInfo, error) {
+	r, err := s.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	h := fnv.New64a()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return &SoundInfo{Size: size, Duration: s.Duration(), Hash: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// value reads the comparable state of o, canvases and sounds are hashed
+func value(o wzexplorer.Object) (*Value, error) {
+	v := &Value{Type: o.Type().String(), obj: o}
+	switch o.Type() {
+	case wzexplorer.ObjectTypeCanvas:
+		c := o.Canvas()
+		hash, err := hashCanvas(c)
+		if err != nil {
+			return nil, err
+		}
+		size := c.Size()
+		v.Canvas = &CanvasInfo{Width: size.X, Height: size.Y, Format: c.Format().String(), Hash: hash}
+	case wzexplorer.ObjectTypeSound:
+		info, err := soundInfo(o.Sound())
+		if err != nil {
+			return nil, err
+		}
+		v.Sound = info
+	case wzexplorer.ObjectTypeVector:
+		p := o.Vector()
+		v.Value = [2]int{p.X, p.Y}
+	case wzexplorer.ObjectTypeDirectory, wzexplorer.ObjectTypeProperties, wzexplorer.ObjectTypeConvex,
+		wzexplorer.ObjectTypeVariantNil:
+	default:
+		v.Value = o.Value()
+	}
+	return v, nil
+}
+
+func equal(a, b *Value) bool {
+	if a.Type != b.Type || a.Value != b.Value {
+		return false
+	}
+	if a.Canvas != nil && b.Canvas != nil && *a.Canvas != *b.Canvas {
+		return false
+	}
+	if a.Sound != nil && b.Sound != nil && *a.Sound != *b.Sound {
+		return false
+	}
+	return true
+}
+
+// shallow value of an added or removed object, containers aren't hashed
+func (d *differ) side(o wzexplorer.Object) (*Value, error) {
+	if container(o.Type()) && o.Type() != wzexplorer.ObjectTypeCanvas {
+		return &Value{Type: o.Type().String(), obj: o}, nil
+	}
+	return value(o)
+}
+
+func (d *differ) add(kind ChangeKind, p string, old, new wzexplorer.Object) error {
+	c := &Change{Kind: kind, Path: p}
+	var err error
+	if old != nil {
+		if c.Old, err = d.side(old); err != nil {
+			return err
+		}
+	}
+	if new != nil {
+		if c.New, err = d.side(new); err != nil {
+			return err
+		}
+	}
+	d.result.Changes = append(d.result.Changes, c)
+	return nil
+}
+
+func (d *differ) children(p string, old, new wzexplorer.GetObject) error {
+	om, err := entries(old)
+	if err != nil {
+		return err
+	}
+	nm, err := entries(new)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(om)+len(nm))
+	for name := range om {
+		names = append(names, name)
+	}
+	for name := range nm {
+		if _, ok := om[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cp := path.Join(p, name)
+		o, n := om[name], nm[name]
+		switch {
+		case n == nil:
+			err = d.add(Removed, cp, o, nil)
+		case o == nil:
+			err = d.add(Added, cp, nil, n)
+		default:
+			err = d.compare(cp, o, n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) compare(p string, old, new wzexplorer.Object) error {
+	if old.Type() != new.Type() {
+		return d.add(Changed, p, old, new)
+	}
+
+	// images carry the size and checksum of their directory entry
+	if old.Type() == wzexplorer.ObjectTypeProperties && old.Checksum() != 0 &&
+		old.Checksum() == new.Checksum() && old.DataSize() == new.DataSize() {
+		d.result.Skipped++
+		return nil
+	}
+
+	if !container(old.Type()) || old.Type() == wzexplorer.ObjectTypeCanvas {
+		ov, err := value(old)
+		if err != nil {
+			return err
+		}
+		nv, err := value(new)
+		if err != nil {
+			return err
+		}
+		if !equal(ov, nv) {
+			d.result.Changes = append(d.result.Changes, &Change{Kind: Changed, Path: p, Old: ov, New: nv})
+		}
+		if old.Type() != wzexplorer.ObjectTypeCanvas {
+			return nil
+		}
+	}
+	return d.children(p, old, new)
+}
+
+// Diff compares two trees, usually the same archive or path of two client versions
+func Diff(old, new wzexplorer.GetObject) (*Result, error) {
+	if old == nil || new == nil {
+		return nil, errors.New("nil object")
+	}
+	d := &differ{result: &Result{Changes: []*Change{}}}
+	if err := d.children("/", old, new); err != nil {
+		return nil, err
+	}
+	return d.result, nil
+}
@@ -0,0 +1,217 @@
+package wzdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"strings"
+	"testing"
+)
+
+func open(t *testing.T, b *wztest.Builder, entries ...wztest.Entry) wzexplorer.File {
+	t.Helper()
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, b.Write(t, entries...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func pixel(b *wztest.Builder, bgra ...byte) wztest.Object {
+	return b.Canvas(1, 1, int32(wzexplorer.CanvasFormatBGRA8888), bgra)
+}
+
+func testDiff(t *testing.T) *Result {
+	b := wztest.New(wzexplorer.IvEmpty)
+	same := wztest.Entry{Name: "b.img", Image: b.Properties(wztest.Prop{Name: "v", Value: int32(1)})}
+	old := open(t, b,
+		wztest.Entry{Name: "a.img", Image: b.Properties(
+			wztest.Prop{Name: "bgm", Value: b.Sound([]byte{1, 2, 3, 4})},
+			wztest.Prop{Name: "gone", Value: "x"},
+			wztest.Prop{Name: "icon", Value: pixel(b, 0, 0, 0xff, 0xff)},
+			wztest.Prop{Name: "id", Value: int32(1)},
+			wztest.Prop{Name: "kind", Value: int32(5)},
+			wztest.Prop{Name: "name", Value: "old"},
+			wztest.Prop{Name: "sub", Value: b.Properties(wztest.Prop{Name: "deep", Value: int32(1)})},
+		)},
+		same,
+	)
+	new := open(t, b,
+		wztest.Entry{Name: "a.img", Image: b.Properties(
+			wztest.Prop{Name: "bgm", Value: b.Sound([]byte{1, 2, 3, 5})},
+			wztest.Prop{Name: "icon", Value: pixel(b, 0xff, 0, 0, 0xff)},
+			wztest.Prop{Name: "id", Value: int32(1)},
+			wztest.Prop{Name: "kind", Value: "five"},
+			wztest.Prop{Name: "name", Value: "new"},
+			wztest.Prop{Name: "y", Value: int16(2)},
+		)},
+		same,
+	)
+	r, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDiff(t *testing.T) {
+	r := testDiff(t)
+	want := []struct {
+		kind ChangeKind
+		path string
+	}{
+		{Changed, "/a/bgm"},
+		{Removed, "/a/gone"},
+		{Changed, "/a/icon"},
+		{Changed, "/a/kind"},
+		{Changed, "/a/name"},
+		// removed containers aren't expanded
+		{Removed, "/a/sub"},
+		{Added, "/a/y"},
+	}
+	if len(r.Changes) != len(want) {
+		for _, c := range r.Changes {
+			t.Logf("%s %s", c.Kind, c.Path)
+		}
+		t.Fatalf("%d changes, want %d", len(r.Changes), len(want))
+	}
+	for i, w := range want {
+		if c := r.Changes[i]; c.Kind != w.kind || c.Path != w.path {
+			t.Errorf("change %d = %s %s, want %s %s", i, c.Kind, c.Path, w.kind, w.path)
+		}
+	}
+	// b.img has the same size and checksum on both sides
+	if r.Skipped != 1 {
+		t.Errorf("%d skipped, want 1", r.Skipped)
+	}
+
+	bgm, icon, kind := r.Changes[0], r.Changes[2], r.Changes[3]
+	if bgm.Old.Sound == nil || bgm.New.Sound == nil || bgm.Old.Sound.Hash == bgm.New.Sound.Hash ||
+		bgm.Old.Sound.Size != bgm.New.Sound.Size {
+		t.Errorf("sound change %+v -> %+v", bgm.Old.Sound, bgm.New.Sound)
+	}
+	if icon.Old.Canvas == nil || icon.New.Canvas == nil || icon.Old.Canvas.Hash == icon.New.Canvas.Hash ||
+		icon.Old.Canvas.Width != 1 || icon.New.Canvas.Format != "BGRA8888" {
+		t.Errorf("canvas change %+v -> %+v", icon.Old.Canvas, icon.New.Canvas)
+	}
+	if kind.Old.Type != "Int32" || kind.New.Type != "String" || kind.Old.Value != int32(5) || kind.New.Value != "five" {
+		t.Errorf("type change %+v -> %+v", kind.Old, kind.New)
+	}
+	if r.Changes[1].New != nil || r.Changes[6].Old != nil {
+		t.Error("added or removed changes carry both sides")
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	entry := wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "icon", Value: pixel(b, 1, 2, 3, 4)},
+	)}
+	old, new := open(t, b, entry), open(t, b, entry)
+	r, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Changes) != 0 || r.Skipped != 1 {
+		t.Errorf("%d changes %d skipped, want 0 and 1", len(r.Changes), r.Skipped)
+	}
+
+	// comparing below the image level doesn't skip
+	if r, err = Diff(old.MustGet("a"), new.MustGet("a")); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Changes) != 0 || r.Skipped != 0 {
+		t.Errorf("%d changes %d skipped, want none", len(r.Changes), r.Skipped)
+	}
+
+	if _, err = Diff(old, nil); err == nil {
+		t.Error("diff against nil succeeded")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testDiff(t).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"- /a/gone (String) x\n",
+		"+ /a/y (Int16) 2\n",
+		"~ /a/name (String) old -> new\n",
+		"~ /a/kind (Int32 -> String) 5 -> five\n",
+		"- /a/sub (Properties) \n",
+		"~ /a/icon (Canvas) 1x1 BGRA8888 ",
+		"~ /a/bgm (Sound) 48 bytes ",
+		"7 changes, 1 images unchanged\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("text report misses %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testDiff(t).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var r struct {
+		Changes []struct {
+			Kind string
+			Path string
+			Old  *struct {
+				Type   string
+				Value  interface{}
+				Canvas *CanvasInfo
+			}
+			New *struct {
+				Type  string
+				Value interface{}
+				Sound *SoundInfo
+			}
+		}
+		Skipped int
+	}
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Changes) != 7 || r.Skipped != 1 {
+		t.Fatalf("%d changes %d skipped", len(r.Changes), r.Skipped)
+	}
+	if c := r.Changes[1]; c.Kind != "removed" || c.Path != "/a/gone" || c.Old == nil || c.Old.Value != "x" || c.New != nil {
+		t.Errorf("removed change %+v", c)
+	}
+	if c := r.Changes[0]; c.Kind != "changed" || c.New == nil || c.New.Sound == nil || c.New.Sound.Size != 48 {
+		t.Errorf("sound change %+v", c)
+	}
+	if c := r.Changes[2]; c.Old == nil || c.Old.Canvas == nil || c.Old.Canvas.Hash == "" {
+		t.Errorf("canvas change %+v", c)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testDiff(t).WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n := strings.Count(out, "<tr class="); n != 7 {
+		t.Errorf("%d change rows, want 7", n)
+	}
+	// both sides of the canvas change are embedded
+	if n := strings.Count(out, `<img src="data:image/png;base64,`); n != 2 {
+		t.Errorf("%d thumbnails, want 2", n)
+	}
+	for _, s := range []string{`<tr class="added">`, `<tr class="removed">`, "Int32 &rarr; String", "7 changes, 1 images unchanged"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("html report misses %q", s)
+		}
+	}
+}
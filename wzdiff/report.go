@@ -0,0 +1,120 @@
+package wzdiff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image/png"
+	"io"
+	"time"
+)
+
+func (v *Value) String() string {
+	switch {
+	case v == nil:
+		return ""
+	case v.Canvas != nil:
+		return fmt.Sprintf("%dx%d %s %s", v.Canvas.Width, v.Canvas.Height, v.Canvas.Format, v.Canvas.Hash)
+	case v.Sound != nil:
+		return fmt.Sprintf("%d bytes %s %s", v.Sound.Size, v.Sound.Duration.Round(time.Millisecond), v.Sound.Hash)
+	case v.Value != nil:
+		return fmt.Sprint(v.Value)
+	}
+	return ""
+}
+
+var kindMarks = map[ChangeKind]string{Added: "+", Removed: "-", Changed: "~"}
+
+// WriteText writes one line per change, + added, - removed, ~ changed
+func (r *Result) WriteText(w io.Writer) error {
+	for _, c := range r.Changes {
+		var err error
+		switch c.Kind {
+		case Added:
+			_, err = fmt.Fprintf(w, "+ %s (%s) %s\n", c.Path, c.New.Type, c.New)
+		case Removed:
+			_, err = fmt.Fprintf(w, "- %s (%s) %s\n", c.Path, c.Old.Type, c.Old)
+		case Changed:
+			t := c.New.Type
+			if c.Old.Type != c.New.Type {
+				t = c.Old.Type + " -> " + c.New.Type
+			}
+			_, err = fmt.Fprintf(w, "~ %s (%s) %s -> %s\n", c.Path, t, c.Old, c.New)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d changes, %d images unchanged\n", len(r.Changes), r.Skipped)
+	return err
+}
+
+func (r *Result) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+// thumbnail returns the canvas of v as png data url, empty for other values
+func thumbnail(v *Value) (template.URL, error) {
+	if v == nil || v.Canvas == nil {
+		return "", nil
+	}
+	img, err := v.obj.Canvas().Image()
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBufferString("data:image/png;base64,")
+	enc := base64.NewEncoder(base64.StdEncoding, buf)
+	if err = png.Encode(enc, img); err != nil {
+		return "", err
+	}
+	if err = enc.Close(); err != nil {
+		return "", err
+	}
+	return template.URL(buf.String()), nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"thumbnail": thumbnail,
+	"mark": func(k ChangeKind) string {
+		return kindMarks[k]
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>wz diff</title>
+<style>
+body { font: 13px monospace; margin: 1em 2em; }
+table { border-collapse: collapse; }
+td, th { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+tr.added td:first-child { color: #080; }
+tr.removed td:first-child { color: #c00; }
+tr.changed td:first-child { color: #c60; }
+img { max-width: 128px; max-height: 128px; image-rendering: pixelated; display: block;
+	background: repeating-conic-gradient(#ddd 0 25%, #fff 0 50%) 0 0 / 8px 8px; }
+</style>
+</head>
+<body>
+<p>{{len .Changes}} changes, {{.Skipped}} images unchanged</p>
+<table>
+<tr><th></th><th>path</th><th>type</th><th>before</th><th>after</th></tr>
+{{range .Changes}}<tr class="{{.Kind}}">
+<td>{{mark .Kind}}</td>
+<td>{{.Path}}</td>
+<td>{{with .Old}}{{.Type}}{{end}}{{if and .Old .New}}{{if ne .Old.Type .New.Type}} &rarr; {{.New.Type}}{{end}}{{else}}{{with .New}}{{.Type}}{{end}}{{end}}</td>
+<td>{{with .Old}}{{with thumbnail .}}<img src="{{.}}">{{end}}{{.}}{{end}}</td>
+<td>{{with .New}}{{with thumbnail .}}<img src="{{.}}">{{end}}{{.}}{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes a standalone report, canvases are embedded as before and after thumbnails
+func (r *Result) WriteHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, r)
+}
@@ -0,0 +1,256 @@
+package wzhash
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"path"
+	"sort"
+)
+
+type Asset struct {
+	Path string `json:"path"`
+	// Size stored bytes
+	Size int32 `json:"size"`
+
+	fp Fingerprint
+}
+
+type Group struct {
+	Type string `json:"type"`
+	// Hash fingerprint hash of the first asset by path
+	Hash string `json:"hash"`
+	// Distance largest perceptual distance that joined the group, zero for exact groups
+	Distance int      `json:"distance,omitempty"`
+	Assets   []*Asset `json:"assets"`
+}
+
+// Waste returns the stored bytes of every asset beyond the smallest copy
+func (g *Group) Waste() (n int64) {
+	least := g.Assets[0].Size
+	for _, a := range g.Assets {
+		n += int64(a.Size)
+		if a.Size < least {
+			least = a.Size
+		}
+	}
+	return n - int64(least)
+}
+
+type DupesOptions struct {
+	// Similar largest perceptual distance grouping near duplicate canvases, 0 groups exact copies only
+	Similar int
+	// MinSize skips assets storing fewer bytes
+	MinSize int32
+	// Progress called before each image is walked
+	Progress func(path string)
+}
+
+type DupesReport struct {
+	Canvases int `json:"canvases"`
+	Sounds   int `json:"sounds"`
+	// Exact groups of identical assets, most wasted bytes first
+	Exact []*Group `json:"exact"`
+	// Similar groups of canvases within the perceptual distance that aren't identical
+	Similar []*Group `json:"similar"`
+	// Failed paths of assets that failed to decode
+	Failed []string `json:"failed,omitempty"`
+}
+
+type finder struct {
+	opts   *DupesOptions
+	report *DupesReport
+	// exact assets by type and hash in walk order
+	exact map[string][]*Asset
+	keys  []string
+}
+
+func (d *finder) add(p string, o wzexplorer.Object) {
+	if o.DataSize() < d.opts.MinSize {
+		return
+	}
+	fp, err := Of(o)
+	if err != nil {
+		d.report.Failed = append(d.report.Failed, p)
+		return
+	}
+	if o.Type() == wzexplorer.ObjectTypeCanvas {
+		d.report.Canvases++
+	} else {
+		d.report.Sounds++
+	}
+	key := o.Type().String() + ":" + fp.Hash
+	if _, ok := d.exact[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.exact[key] = append(d.exact[key], &Asset{Path: p, Size: o.DataSize(), fp: fp})
+}
+
+// linked reports whether the canvas already points at other data
+func linked(o wzexplorer.Object) bool {
+	for _, name := range []string{"_inlink", "_outlink"} {
+		if c, err := o.Get(name); err == nil && c != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *finder) walk(p string, o wzexplorer.GetObject) error {
+	return o.Each(func(name string, c wzexplorer.Object) error {
+		cp := path.Join(p, name)
+		switch c.Type() {
+		case wzexplorer.ObjectTypeDirectory:
+			return d.walk(cp, c)
+		case wzexplorer.ObjectTypeCanvas:
+			if !linked(c) {
+				d.add(cp, c)
+			}
+		case wzexplorer.ObjectTypeSound:
+			d.add(cp, c)
+			return nil
+		case wzexplorer.ObjectTypeProperties, wzexplorer.ObjectTypeConvex:
+		default:
+			return nil
+		}
+		image := c.Checksum() != 0 && c.Type() == wzexplorer.ObjectTypeProperties
+		if image && d.opts.Progress != nil {
+			d.opts.Progress(cp)
+		}
+		if err := d.walk(cp, c); err != nil {
+			return err
+		}
+		if image {
+			// fingerprints are all that's kept, drop the parsed image
+			c.Unload()
+		}
+		return nil
+	})
+}
+
+func sortGroups(groups []*Group) {
+	for _, g := range groups {
+		sort.Slice(g.Assets, func(i, j int) bool { return g.Assets[i].Path < g.Assets[j].Path })
+		g.Hash = g.Assets[0].fp.Hash
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if wi, wj := groups[i].Waste(), groups[j].Waste(); wi != wj {
+			return wi > wj
+		}
+		return groups[i].Assets[0].Path < groups[j].Assets[0].Path
+	})
+}
+
+// similar joins canvases of different hashes within opts.Similar perceptual bits, candidates
+// come from splitting the hash in Similar+1 bands, two hashes that close share at least one
+func (d *finder) similar() {
+	var reps []*Asset
+	var members [][]*Asset
+	for _, key := range d.keys {
+		assets := d.exact[key]
+		// flat images all hash to zero
+		if assets[0].fp.Perceptual == 0 || key[:len("Canvas:")] != "Canvas:" {
+			continue
+		}
+		reps = append(reps, assets[0])
+		members = append(members, assets)
+	}
+
+	parent := make([]int, len(reps))
+	distance := make([]int, len(reps))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	bands := d.opts.Similar + 1
+	if bands > 64 {
+		bands = 64
+	}
+	width := 64 / bands
+	buckets := make(map[[2]uint64][]int)
+	for i, a := range reps {
+		for band := 0; band < bands; band++ {
+			shift := uint(band * width)
+			mask := uint64(1)<<uint(width) - 1
+			if band == bands-1 {
+				mask = ^uint64(0) >> shift
+			}
+			key := [2]uint64{uint64(band), a.fp.Perceptual >> shift & mask}
+			for _, j := range buckets[key] {
+				dist := a.fp.Distance(reps[j].fp)
+				if dist > d.opts.Similar {
+					continue
+				}
+				ri, rj := find(i), find(j)
+				if dist > distance[rj] {
+					distance[rj] = dist
+				}
+				if ri != rj {
+					parent[ri] = rj
+					if distance[ri] > distance[rj] {
+						distance[rj] = distance[ri]
+					}
+				}
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	groups := make(map[int]*Group)
+	// hashes exact hashes joined under each root
+	hashes := make(map[int]int)
+	var order []int
+	for i := range reps {
+		root := find(i)
+		g, ok := groups[root]
+		if !ok {
+			g = &Group{Type: wzexplorer.ObjectTypeCanvas.String(), Distance: distance[root]}
+			groups[root] = g
+			order = append(order, root)
+		}
+		g.Assets = append(g.Assets, members[i]...)
+		hashes[root]++
+	}
+	for _, root := range order {
+		// hashes within zero bits still differ, a single hash is already an exact group
+		if hashes[root] > 1 {
+			d.report.Similar = append(d.report.Similar, groups[root])
+		}
+	}
+}
+
+// Dupes walks every canvas and sound below root and groups identical ones,
+// canvases carrying _inlink or _outlink are already de-duplicated and skipped
+func Dupes(root wzexplorer.GetObject, opts *DupesOptions) (*DupesReport, error) {
+	if opts == nil {
+		opts = &DupesOptions{}
+	}
+	d := &finder{
+		opts:   opts,
+		report: &DupesReport{Exact: []*Group{}, Similar: []*Group{}},
+		exact:  make(map[string][]*Asset),
+	}
+	if err := d.walk("/", root); err != nil {
+		return nil, err
+	}
+
+	for _, key := range d.keys {
+		if assets := d.exact[key]; len(assets) > 1 {
+			d.report.Exact = append(d.report.Exact, &Group{
+				Type:   key[:len(key)-len(assets[0].fp.Hash)-1],
+				Assets: assets,
+			})
+		}
+	}
+	if opts.Similar > 0 {
+		d.similar()
+	}
+	sortGroups(d.report.Exact)
+	sortGroups(d.report.Similar)
+	return d.report, nil
+}
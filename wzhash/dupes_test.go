@@ -0,0 +1,271 @@
+package wzhash
+
+import (
+	"bytes"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"strings"
+	"testing"
+)
+
+func open(t *testing.T, b *wztest.Builder, entries ...wztest.Entry) wzexplorer.File {
+	t.Helper()
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, b.Write(t, entries...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// base a perceptual hash with bits set in every band
+const base = uint64(0xf0f03c3ca5a50ff0)
+
+// hashed returns a 9x8 gray BGRA8888 canvas whose perceptual hash is hash, one pixel per cell
+// stepping up for set bits and down for clear ones, tint changes the pixels below the hash
+func hashed(b *wztest.Builder, hash uint64, tint byte, ps ...wztest.Prop) wztest.Object {
+	pix := make([]byte, 9*8*4)
+	for y := 0; y < 8; y++ {
+		v := 128
+		for x := 0; x < 9; x++ {
+			if x > 0 {
+				if hash>>uint(63-(y*8+x-1))&1 == 1 {
+					v += 10
+				} else {
+					v -= 10
+				}
+			}
+			i := (y*9 + x) * 4
+			pix[i], pix[i+1], pix[i+2], pix[i+3] = byte(v), byte(v), byte(v), 0xff
+		}
+	}
+	// blue weighs too little to move the luminance of a single step
+	pix[0] += tint
+	return b.Canvas(9, 8, int32(wzexplorer.CanvasFormatBGRA8888), pix, ps...)
+}
+
+// flip returns hash with the given bits inverted
+func flip(hash uint64, bits ...int) uint64 {
+	for _, bit := range bits {
+		hash ^= 1 << uint(bit)
+	}
+	return hash
+}
+
+func paths(g *Group) string {
+	var ps []string
+	for _, a := range g.Assets {
+		ps = append(ps, a.Path)
+	}
+	return strings.Join(ps, " ")
+}
+
+func fingerprint(t *testing.T, f wzexplorer.File, p string) Fingerprint {
+	t.Helper()
+	o := f.MustGet(p)
+	if o == nil {
+		t.Fatalf("missing %s", p)
+	}
+	fp, err := Of(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+func TestCanvas(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	format := int32(wzexplorer.CanvasFormatBGRA8888)
+	f := open(t, b, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "hashed", Value: hashed(b, base, 0)},
+		wztest.Prop{Name: "tinted", Value: hashed(b, base, 1)},
+		// transparent pixels hash alike whatever color they keep
+		wztest.Prop{Name: "clear1", Value: b.Canvas(2, 1, format, []byte{1, 2, 3, 0, 9, 9, 9, 0xff})},
+		wztest.Prop{Name: "clear2", Value: b.Canvas(2, 1, format, []byte{4, 5, 6, 0, 9, 9, 9, 0xff})},
+		// same pixels in another shape
+		wztest.Prop{Name: "tall", Value: b.Canvas(1, 2, format, []byte{1, 2, 3, 0, 9, 9, 9, 0xff})},
+		wztest.Prop{Name: "v", Value: int32(1)},
+	)})
+
+	fp := fingerprint(t, f, "a/hashed")
+	if fp.Perceptual != base {
+		t.Errorf("perceptual %016x, want %016x", fp.Perceptual, base)
+	}
+	tinted := fingerprint(t, f, "a/tinted")
+	if tinted.Hash == fp.Hash || tinted.Distance(fp) != 0 {
+		t.Errorf("tinted hash %s distance %d", tinted.Hash, tinted.Distance(fp))
+	}
+	if fingerprint(t, f, "a/clear1") != fingerprint(t, f, "a/clear2") {
+		t.Error("transparent pixel colors change the hash")
+	}
+	if fingerprint(t, f, "a/clear1").Hash == fingerprint(t, f, "a/tall").Hash {
+		t.Error("canvas size not hashed")
+	}
+	if _, err := Of(f.MustGet("a/v")); err == nil {
+		t.Error("fingerprinted an int")
+	}
+}
+
+func TestSound(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := open(t, b, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "s1", Value: b.Sound([]byte{1, 2, 3, 4})},
+		wztest.Prop{Name: "s2", Value: b.Sound([]byte{1, 2, 3, 4})},
+		wztest.Prop{Name: "s3", Value: b.Sound([]byte{1, 2, 3, 5})},
+	)})
+	s1, s2, s3 := fingerprint(t, f, "a/s1"), fingerprint(t, f, "a/s2"), fingerprint(t, f, "a/s3")
+	if s1 != s2 || s1.Hash == s3.Hash {
+		t.Errorf("sound hashes %s %s %s", s1.Hash, s2.Hash, s3.Hash)
+	}
+	if s1.Perceptual != 0 {
+		t.Errorf("sound perceptual %x", s1.Perceptual)
+	}
+}
+
+func TestDupesExact(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	payload := bytes.Repeat([]byte{1, 2, 3, 4}, 50)
+	f := open(t, b,
+		wztest.Entry{Name: "Dir", Dir: []wztest.Entry{
+			{Name: "b.img", Image: b.Properties(
+				wztest.Prop{Name: "y", Value: hashed(b, base, 0)},
+				wztest.Prop{Name: "bgm", Value: b.Sound(payload)},
+			)},
+		}},
+		wztest.Entry{Name: "a.img", Image: b.Properties(
+			wztest.Prop{Name: "x", Value: hashed(b, base, 0)},
+			wztest.Prop{Name: "other", Value: hashed(b, flip(base, 1, 2, 3), 0)},
+			wztest.Prop{Name: "bgm", Value: b.Sound(payload)},
+			wztest.Prop{Name: "short", Value: b.Sound([]byte{9})},
+			// linked canvases already share their pixels
+			wztest.Prop{Name: "link", Value: hashed(b, base, 0, wztest.Prop{Name: "_inlink", Value: "x"})},
+			wztest.Prop{Name: "broken", Value: b.CanvasData(2, 2, int32(wzexplorer.CanvasFormatBGRA8888), 0, []byte("not zlib"))},
+		)},
+	)
+
+	var walked []string
+	r, err := Dupes(f, &DupesOptions{Progress: func(p string) { walked = append(walked, p) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Canvases != 3 || r.Sounds != 3 {
+		t.Errorf("%d canvases %d sounds, want 3 and 3", r.Canvases, r.Sounds)
+	}
+	if len(r.Failed) != 1 || r.Failed[0] != "/a/broken" {
+		t.Errorf("failed %v", r.Failed)
+	}
+	if len(walked) != 2 {
+		t.Errorf("walked %v", walked)
+	}
+	if len(r.Exact) != 2 || len(r.Similar) != 0 {
+		t.Fatalf("%d exact %d similar groups, want 2 and 0", len(r.Exact), len(r.Similar))
+	}
+
+	// the sound wastes more bytes than the canvas and comes first
+	sound, canvas := r.Exact[0], r.Exact[1]
+	if sound.Type != "Sound" || paths(sound) != "/Dir/b/bgm /a/bgm" || sound.Hash != fingerprint(t, f, "a/bgm").Hash {
+		t.Errorf("sound group %s %s %s", sound.Type, paths(sound), sound.Hash)
+	}
+	if canvas.Type != "Canvas" || paths(canvas) != "/Dir/b/y /a/x" || canvas.Hash != fingerprint(t, f, "a/x").Hash {
+		t.Errorf("canvas group %s %s %s", canvas.Type, paths(canvas), canvas.Hash)
+	}
+	if sound.Waste() <= canvas.Waste() || r.Waste() != sound.Waste()+canvas.Waste() {
+		t.Errorf("waste %d %d total %d", sound.Waste(), canvas.Waste(), r.Waste())
+	}
+
+	var out bytes.Buffer
+	if err = r.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "3 canvases, 3 sounds, 2 exact groups, 0 similar groups") {
+		t.Errorf("text report %q", out.String())
+	}
+}
+
+func TestDupesMinSize(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	large := bytes.Repeat([]byte{1, 2, 3, 4}, 50)
+	f := open(t, b, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "l1", Value: b.Sound(large)},
+		wztest.Prop{Name: "l2", Value: b.Sound(large)},
+		wztest.Prop{Name: "s1", Value: b.Sound([]byte{1, 2})},
+		wztest.Prop{Name: "s2", Value: b.Sound([]byte{1, 2})},
+	)})
+	r, err := Dupes(f, &DupesOptions{MinSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Sounds != 2 || len(r.Exact) != 1 || paths(r.Exact[0]) != "/a/l1 /a/l2" {
+		t.Errorf("%d sounds groups %d", r.Sounds, len(r.Exact))
+	}
+}
+
+func TestDupesSimilar(t *testing.T) {
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := open(t, b,
+		wztest.Entry{Name: "a.img", Image: b.Properties(
+			// walked before the paths that sort first
+			wztest.Prop{Name: "z", Value: hashed(b, flip(base, 0, 20, 40), 0)},
+			wztest.Prop{Name: "c", Value: hashed(b, base, 0)},
+			wztest.Prop{Name: "d", Value: hashed(b, base, 0)},
+			// same perceptual hash, different pixels
+			wztest.Prop{Name: "b", Value: hashed(b, base, 1)},
+			wztest.Prop{Name: "far", Value: hashed(b, flip(base, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12), 0)},
+			// identical to each other only
+			wztest.Prop{Name: "x1", Value: hashed(b, ^base, 0)},
+			wztest.Prop{Name: "x2", Value: hashed(b, ^base, 0)},
+		)},
+	)
+	r, err := Dupes(f, &DupesOptions{Similar: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Exact) != 2 {
+		t.Errorf("%d exact groups, want 2", len(r.Exact))
+	}
+	if len(r.Similar) != 1 {
+		t.Fatalf("%d similar groups, want 1", len(r.Similar))
+	}
+	g := r.Similar[0]
+	if paths(g) != "/a/b /a/c /a/d /a/z" || g.Distance != 3 {
+		t.Errorf("similar group %s distance %d", paths(g), g.Distance)
+	}
+	if g.Hash != fingerprint(t, f, "a/b").Hash {
+		t.Errorf("similar group hash %s, want the hash of /a/b", g.Hash)
+	}
+
+	// hashes only as close as the distance itself
+	r, err = Dupes(f, &DupesOptions{Similar: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Similar) != 1 || paths(r.Similar[0]) != "/a/b /a/c /a/d" || r.Similar[0].Distance != 0 {
+		t.Errorf("similar groups at distance 2 %v", r.Similar)
+	}
+}
+
+func TestDupesBands(t *testing.T) {
+	// 11 bands of 5 bits and the rest, the pair differs in every band but the last
+	var spread []int
+	for band := 0; band < 10; band++ {
+		spread = append(spread, band*5)
+	}
+	b := wztest.New(wzexplorer.IvEmpty)
+	f := open(t, b, wztest.Entry{Name: "a.img", Image: b.Properties(
+		wztest.Prop{Name: "a", Value: hashed(b, base, 0)},
+		wztest.Prop{Name: "b", Value: hashed(b, flip(base, spread...), 0)},
+		// one bit more than the distance from a, its last band differs too
+		wztest.Prop{Name: "c", Value: hashed(b, flip(base, 1, 6, 11, 16, 21, 26, 31, 36, 41, 46, 61), 0)},
+	)})
+	r, err := Dupes(f, &DupesOptions{Similar: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Similar) != 1 || paths(r.Similar[0]) != "/a/a /a/b" || r.Similar[0].Distance != 10 {
+		t.Errorf("similar groups %v", r.Similar)
+	}
+}
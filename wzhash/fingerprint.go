@@ -0,0 +1,125 @@
+package wzhash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/wzimage"
+	"image"
+	"io"
+	"math/bits"
+)
+
+// Fingerprint identifies the content of a canvas or sound independent of its path
+type Fingerprint struct {
+	// Hash sha-256 of the decoded pixels and size of a canvas or the payload of a sound
+	Hash string `json:"hash"`
+	// Perceptual difference hash of a canvas, similar images differ in few bits, zero for sounds
+	Perceptual uint64 `json:"perceptual,omitempty"`
+}
+
+// Distance returns the number of perceptual hash bits f and o differ in
+func (f Fingerprint) Distance(o Fingerprint) int {
+	return bits.OnesCount64(f.Perceptual ^ o.Perceptual)
+}
+
+// Canvas fingerprints the decoded pixels, the colour of fully transparent pixels is ignored
+func Canvas(c wzexplorer.Canvas) (Fingerprint, error) {
+	img, err := c.Image()
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	m := wzimage.ToNRGBA(img)
+	b := m.Rect
+
+	h := sha256.New()
+	var size [8]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(b.Dx()))
+	binary.LittleEndian.PutUint32(size[4:], uint32(b.Dy()))
+	h.Write(size[:])
+	row := make([]byte, b.Dx()*4)
+	for y := 0; y < b.Dy(); y++ {
+		copy(row, m.Pix[y*m.Stride:])
+		for x := 0; x < len(row); x += 4 {
+			if row[x+3] == 0 {
+				row[x], row[x+1], row[x+2] = 0, 0, 0
+			}
+		}
+		h.Write(row)
+	}
+	return Fingerprint{Hash: hex.EncodeToString(h.Sum(nil)), Perceptual: dhash(m)}, nil
+}
+
+// dhash shrinks m to 9x8 luminance composed over black and sets a bit wherever
+// a cell is darker than its right neighbour
+func dhash(m *image.NRGBA) uint64 {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+	var gray [8][9]uint32
+	for cy := 0; cy < 8; cy++ {
+		y0, y1 := cell(cy, 8, h)
+		for cx := 0; cx < 9; cx++ {
+			x0, x1 := cell(cx, 9, w)
+			var sum uint32
+			for y := y0; y < y1; y++ {
+				p := m.Pix[y*m.Stride+x0*4 : y*m.Stride+x1*4]
+				for i := 0; i < len(p); i += 4 {
+					lum := 299*uint32(p[i]) + 587*uint32(p[i+1]) + 114*uint32(p[i+2])
+					sum += lum / 1000 * uint32(p[i+3]) / 255
+				}
+			}
+			gray[cy][cx] = sum / uint32((y1-y0)*(x1-x0))
+		}
+	}
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// cell returns the pixel range of cell i out of n over size, never empty
+func cell(i, n, size int) (int, int) {
+	start, end := i*size/n, (i+1)*size/n
+	if start >= size {
+		start = size - 1
+	}
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// Sound fingerprints the stored payload
+func Sound(s wzexplorer.Sound) (Fingerprint, error) {
+	r, err := s.Open()
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return Fingerprint{}, err
+	}
+	return Fingerprint{Hash: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Of fingerprints a canvas or sound object
+func Of(o wzexplorer.Object) (Fingerprint, error) {
+	switch o.Type() {
+	case wzexplorer.ObjectTypeCanvas:
+		return Canvas(o.Canvas())
+	case wzexplorer.ObjectTypeSound:
+		return Sound(o.Sound())
+	}
+	return Fingerprint{}, errors.New("not a canvas or sound")
+}
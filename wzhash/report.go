@@ -0,0 +1,59 @@
+package wzhash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Waste returns the stored bytes the exact groups could save by keeping one copy each
+func (r *DupesReport) Waste() (n int64) {
+	for _, g := range r.Exact {
+		n += g.Waste()
+	}
+	return
+}
+
+func writeGroups(w io.Writer, mark string, groups []*Group) error {
+	for _, g := range groups {
+		var err error
+		if g.Distance > 0 {
+			_, err = fmt.Fprintf(w, "%s %s %d copies, distance %d, %d bytes wasted\n", mark, g.Type, len(g.Assets), g.Distance, g.Waste())
+		} else {
+			_, err = fmt.Fprintf(w, "%s %s %d copies, %d bytes wasted %s\n", mark, g.Type, len(g.Assets), g.Waste(), g.Hash)
+		}
+		if err != nil {
+			return err
+		}
+		for _, a := range g.Assets {
+			if _, err = fmt.Fprintf(w, "  %s (%d bytes)\n", a.Path, a.Size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteText writes each group followed by its asset paths, = exact, ~ similar, ! failed to decode
+func (r *DupesReport) WriteText(w io.Writer) error {
+	if err := writeGroups(w, "=", r.Exact); err != nil {
+		return err
+	}
+	if err := writeGroups(w, "~", r.Similar); err != nil {
+		return err
+	}
+	for _, p := range r.Failed {
+		if _, err := fmt.Fprintf(w, "! %s\n", p); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d canvases, %d sounds, %d exact groups, %d similar groups, %d bytes wasted\n",
+		r.Canvases, r.Sounds, len(r.Exact), len(r.Similar), r.Waste())
+	return err
+}
+
+func (r *DupesReport) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
@@ -48,3 +48,29 @@ func (b *ARGB1555) At(x, y int) color.Color {
 	i := b.PixOffset(x, y)
 	return wzcolor.ARGB1555(uint16(b.Pix[i]) | (uint16(b.Pix[i+1]) << 8))
 }
+
+func (b *ARGB1555) Set(x, y int, c color.Color) {
+	if !image.Pt(x, y).In(b.Rect) {
+		return
+	}
+	i := b.PixOffset(x, y)
+	b.Pix[i], b.Pix[i+1] = encodeARGB1555(nrgba(c))
+}
+
+func (b *ARGB1555) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(b.Rect)
+	if r.Empty() {
+		return &ARGB1555{}
+	}
+	return &ARGB1555{Pix: b.Pix[b.PixOffset(r.Min.X, r.Min.Y):], Stride: b.Stride, Rect: r}
+}
+
+func (b *ARGB1555) Opaque() bool {
+	return opaque16(b.Pix, b.Stride, b.Rect, func(_, hi byte) bool {
+		return hi&0x80 != 0
+	})
+}
+
+func (b *ARGB1555) ToNRGBA() *image.NRGBA {
+	return toNRGBA16(b.Pix, b.Stride, b.Rect, decodeARGB1555)
+}
@@ -0,0 +1,27 @@
+package wzimage
+
+import (
+	"image"
+)
+
+// BC4 single channel blocks, decoded as opaque gray, no canvas format stores it
+type BC4 struct {
+	*image.NRGBA
+}
+
+func decodeBC4Block(dst *[64]byte, src []byte) {
+	decodeChannelBlock(dst, src, 0)
+	for i := 0; i < 64; i += 4 {
+		dst[i+1] = dst[i]
+		dst[i+2] = dst[i]
+		dst[i+3] = 0xff
+	}
+}
+
+func NewBC4(size image.Point, data []byte) (*BC4, error) {
+	img, err := decodeBlocks(size, data, 8, decodeBC4Block)
+	if err != nil {
+		return nil, err
+	}
+	return &BC4{NRGBA: img}, nil
+}
@@ -0,0 +1,27 @@
+package wzimage
+
+import (
+	"image"
+)
+
+// BC5 two channel blocks decoded into red and green, usually normal maps, no canvas format stores it
+type BC5 struct {
+	*image.NRGBA
+}
+
+func decodeBC5Block(dst *[64]byte, src []byte) {
+	decodeChannelBlock(dst, src[:8], 0)
+	decodeChannelBlock(dst, src[8:16], 1)
+	for i := 0; i < 64; i += 4 {
+		dst[i+2] = 0
+		dst[i+3] = 0xff
+	}
+}
+
+func NewBC5(size image.Point, data []byte) (*BC5, error) {
+	img, err := decodeBlocks(size, data, 16, decodeBC5Block)
+	if err != nil {
+		return nil, err
+	}
+	return &BC5{NRGBA: img}, nil
+}
@@ -0,0 +1,254 @@
+package wzimage
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// BC7 16 byte blocks in one of 8 modes with up to 3 partitioned subsets
+type BC7 struct {
+	*image.NRGBA
+}
+
+type bc7Mode struct {
+	subsets       uint
+	partitionBits uint
+	rotationBits  uint
+	selectorBits  uint
+	colorBits     uint
+	alphaBits     uint
+	// endpointPBits one p-bit per endpoint, sharedPBits one per subset
+	endpointPBits uint
+	sharedPBits   uint
+	indexBits     uint
+	index2Bits    uint
+}
+
+var bc7Modes = [8]bc7Mode{
+	{3, 4, 0, 0, 4, 0, 1, 0, 3, 0},
+	{2, 6, 0, 0, 6, 0, 0, 1, 3, 0},
+	{3, 6, 0, 0, 5, 0, 0, 0, 2, 0},
+	{2, 6, 0, 0, 7, 0, 1, 0, 2, 0},
+	{1, 0, 2, 1, 5, 6, 0, 0, 2, 3},
+	{1, 0, 2, 0, 7, 8, 0, 0, 2, 2},
+	{1, 0, 0, 0, 7, 7, 1, 0, 4, 0},
+	{2, 6, 0, 0, 5, 5, 1, 0, 2, 0},
+}
+
+// bc7Partitions2 bit i is the subset of pixel i
+var bc7Partitions2 = [64]uint16{
+	0xcccc, 0x8888, 0xeeee, 0xecc8, 0xc880, 0xfeec, 0xfec8, 0xec80,
+	0xc800, 0xffec, 0xfe80, 0xe800, 0xffe8, 0xff00, 0xfff0, 0xf000,
+	0xf710, 0x008e, 0x7100, 0x08ce, 0x008c, 0x7310, 0x3100, 0x8cce,
+	0x088c, 0x3110, 0x6666, 0x366c, 0x17e8, 0x0ff0, 0x718e, 0x399c,
+	0xaaaa, 0xf0f0, 0x5a5a, 0x33cc, 0x3c3c, 0x55aa, 0x9696, 0xa55a,
+	0x73ce, 0x13c8, 0x324c, 0x3bdc, 0x6996, 0xc33c, 0x9966, 0x0660,
+	0x0272, 0x04e4, 0x4e40, 0x2720, 0xc936, 0x936c, 0x39c6, 0x639c,
+	0x9336, 0x9cc6, 0x817e, 0xe718, 0xccf0, 0x0fcc, 0x7744, 0xee22,
+}
+
+// bc7Partitions3 bits 2i and 2i+1 are the subset of pixel i
+var bc7Partitions3 = [64]uint32{
+	0xaa685050, 0x6a5a5040, 0x5a5a4200, 0x5450a0a8, 0xa5a50000, 0xa0a05050, 0x5555a0a0, 0x5a5a5050,
+	0xaa550000, 0xaa555500, 0xaaaa5500, 0x90909090, 0x94949494, 0xa4a4a4a4, 0xa9a59450, 0x2a0a4250,
+	0xa5945040, 0x0a425054, 0xa5a5a500, 0x55a0a0a0, 0xa8a85454, 0x6a6a4040, 0xa4a45000, 0x1a1a0500,
+	0x0050a4a4, 0xaaa59090, 0x14696914, 0x69691400, 0xa08585a0, 0xaa821414, 0x50a4a450, 0x6a5a0200,
+	0xa9a58000, 0x5090a0a8, 0xa8a09050, 0x24242424, 0x00aa5500, 0x24924924, 0x24499224, 0x50a50a50,
+	0x500aa550, 0xaaaa4444, 0x66660000, 0xa5a0a5a0, 0x50a050a0, 0x69286928, 0x44aaaa44, 0x66666600,
+	0xaa444444, 0x54a854a8, 0x95809580, 0x96969600, 0xa85454a8, 0x80959580, 0xaa141414, 0x96960000,
+	0xaaaa1414, 0xa05050a0, 0xa0a5a5a0, 0x96000000, 0x40804080, 0xa9a8a9a8, 0xaaaaaa44, 0x2a4a5254,
+}
+
+// anchor pixels store their index with one bit less, pixel 0 anchors subset 0
+var bc7Anchors2 = [64]byte{
+	15, 15, 15, 15, 15, 15, 15, 15,
+	15, 15, 15, 15, 15, 15, 15, 15,
+	15, 2, 8, 2, 2, 8, 8, 15,
+	2, 8, 2, 2, 8, 8, 2, 2,
+	15, 15, 6, 8, 2, 8, 15, 15,
+	2, 8, 2, 2, 2, 15, 15, 6,
+	6, 2, 6, 8, 15, 15, 2, 2,
+	15, 15, 15, 15, 15, 2, 2, 15,
+}
+
+var bc7Anchors3a = [64]byte{
+	3, 3, 15, 15, 8, 3, 15, 15,
+	8, 8, 6, 6, 6, 5, 3, 3,
+	3, 3, 8, 15, 3, 3, 6, 10,
+	5, 8, 8, 6, 8, 5, 15, 15,
+	8, 15, 3, 5, 6, 10, 8, 15,
+	15, 3, 15, 5, 15, 15, 15, 15,
+	3, 15, 5, 5, 5, 8, 5, 10,
+	5, 10, 8, 13, 15, 12, 3, 3,
+}
+
+var bc7Anchors3b = [64]byte{
+	15, 8, 8, 3, 15, 15, 3, 8,
+	15, 15, 15, 15, 15, 15, 15, 8,
+	15, 8, 15, 3, 15, 8, 15, 8,
+	3, 15, 6, 10, 15, 15, 10, 8,
+	15, 3, 15, 10, 10, 8, 9, 10,
+	6, 15, 8, 15, 3, 6, 6, 8,
+	15, 3, 15, 15, 15, 15, 15, 15,
+	15, 15, 15, 15, 3, 15, 15, 8,
+}
+
+// bc7Weights interpolation weights out of 64 by index bits
+var bc7Weights = [5][]uint32{
+	2: {0, 21, 43, 64},
+	3: {0, 9, 18, 27, 37, 46, 55, 64},
+	4: {0, 4, 9, 13, 17, 21, 26, 30, 34, 38, 43, 47, 51, 55, 60, 64},
+}
+
+// bc7Bits reads a 128 bit little endian block from the lowest bit up
+type bc7Bits struct {
+	lo, hi uint64
+}
+
+func (r *bc7Bits) read(n uint) byte {
+	v := r.lo & (1<<n - 1)
+	r.lo = r.lo>>n | r.hi<<(64-n)
+	r.hi >>= n
+	return byte(v)
+}
+
+// bc7Expand scales a bits wide value to 8 bits by repeating its high bits
+func bc7Expand(v byte, bits uint) byte {
+	v <<= 8 - bits
+	return v | v>>bits
+}
+
+func bc7Interpolate(e0, e1 byte, w uint32) byte {
+	return byte(((64-w)*uint32(e0) + w*uint32(e1) + 32) >> 6)
+}
+
+func (m *bc7Mode) subset(partition, i int) int {
+	switch m.subsets {
+	case 2:
+		return int(bc7Partitions2[partition] >> uint(i) & 1)
+	case 3:
+		return int(bc7Partitions3[partition] >> uint(i*2) & 3)
+	}
+	return 0
+}
+
+func (m *bc7Mode) anchor(partition, i int) bool {
+	switch {
+	case i == 0:
+		return true
+	case m.subsets == 2:
+		return i == int(bc7Anchors2[partition])
+	case m.subsets == 3:
+		return i == int(bc7Anchors3a[partition]) || i == int(bc7Anchors3b[partition])
+	}
+	return false
+}
+
+func decodeBC7Block(dst *[64]byte, src []byte) {
+	r := &bc7Bits{lo: binary.LittleEndian.Uint64(src), hi: binary.LittleEndian.Uint64(src[8:])}
+
+	mode := 0
+	for mode < 8 && r.read(1) == 0 {
+		mode++
+	}
+	if mode == 8 {
+		// reserved mode decodes to transparent black
+		*dst = [64]byte{}
+		return
+	}
+	m := &bc7Modes[mode]
+
+	partition := int(r.read(m.partitionBits))
+	rotation := r.read(m.rotationBits)
+	selector := r.read(m.selectorBits)
+
+	var endpoints [6][4]byte
+	n := int(m.subsets * 2)
+	for c := 0; c < 3; c++ {
+		for i := 0; i < n; i++ {
+			endpoints[i][c] = r.read(m.colorBits)
+		}
+	}
+	for i := 0; m.alphaBits > 0 && i < n; i++ {
+		endpoints[i][3] = r.read(m.alphaBits)
+	}
+
+	colorBits, alphaBits := m.colorBits, m.alphaBits
+	if m.endpointPBits > 0 || m.sharedPBits > 0 {
+		var pbits [6]byte
+		if m.endpointPBits > 0 {
+			for i := 0; i < n; i++ {
+				pbits[i] = r.read(1)
+			}
+		} else {
+			for s := 0; s < int(m.subsets); s++ {
+				pbits[s*2] = r.read(1)
+				pbits[s*2+1] = pbits[s*2]
+			}
+		}
+		for i := 0; i < n; i++ {
+			for c := 0; c < 4; c++ {
+				endpoints[i][c] = endpoints[i][c]<<1 | pbits[i]
+			}
+		}
+		colorBits++
+		if alphaBits > 0 {
+			alphaBits++
+		}
+	}
+	for i := 0; i < n; i++ {
+		for c := 0; c < 3; c++ {
+			endpoints[i][c] = bc7Expand(endpoints[i][c], colorBits)
+		}
+		if alphaBits > 0 {
+			endpoints[i][3] = bc7Expand(endpoints[i][3], alphaBits)
+		} else {
+			endpoints[i][3] = 0xff
+		}
+	}
+
+	var indices, indices2 [16]byte
+	for i := 0; i < 16; i++ {
+		bits := m.indexBits
+		if m.anchor(partition, i) {
+			bits--
+		}
+		indices[i] = r.read(bits)
+	}
+	for i := 0; m.index2Bits > 0 && i < 16; i++ {
+		bits := m.index2Bits
+		if i == 0 {
+			bits--
+		}
+		indices2[i] = r.read(bits)
+	}
+
+	for i := 0; i < 16; i++ {
+		s := m.subset(partition, i)
+		e0, e1 := &endpoints[s*2], &endpoints[s*2+1]
+		cw := bc7Weights[m.indexBits][indices[i]]
+		aw := cw
+		if m.index2Bits > 0 {
+			aw = bc7Weights[m.index2Bits][indices2[i]]
+			if selector == 1 {
+				cw, aw = aw, cw
+			}
+		}
+		p := dst[i*4 : i*4+4]
+		p[0] = bc7Interpolate(e0[0], e1[0], cw)
+		p[1] = bc7Interpolate(e0[1], e1[1], cw)
+		p[2] = bc7Interpolate(e0[2], e1[2], cw)
+		p[3] = bc7Interpolate(e0[3], e1[3], aw)
+		if rotation > 0 {
+			p[3], p[rotation-1] = p[rotation-1], p[3]
+		}
+	}
+}
+
+func NewBC7(size image.Point, data []byte) (*BC7, error) {
+	img, err := decodeBlocks(size, data, 16, decodeBC7Block)
+	if err != nil {
+		return nil, err
+	}
+	return &BC7{NRGBA: img}, nil
+}
@@ -49,6 +49,49 @@ func (b *BGRA8888) At(x, y int) color.Color {
 	return color.NRGBA{R: b.Pix[i+2], G: b.Pix[i+1], B: b.Pix[i], A: b.Pix[i+3]}
 }
 
+func (b *BGRA8888) Set(x, y int, c color.Color) {
+	if !image.Pt(x, y).In(b.Rect) {
+		return
+	}
+	i := b.PixOffset(x, y)
+	n := nrgba(c)
+	b.Pix[i], b.Pix[i+1], b.Pix[i+2], b.Pix[i+3] = n.B, n.G, n.R, n.A
+}
+
+func (b *BGRA8888) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(b.Rect)
+	if r.Empty() {
+		return &BGRA8888{}
+	}
+	return &BGRA8888{Pix: b.Pix[b.PixOffset(r.Min.X, r.Min.Y):], Stride: b.Stride, Rect: r}
+}
+
+func (b *BGRA8888) Opaque() bool {
+	w := b.Rect.Dx()
+	for y := 0; y < b.Rect.Dy(); y++ {
+		row := b.Pix[y*b.Stride : y*b.Stride+w*4]
+		for x := 3; x < len(row); x += 4 {
+			if row[x] != 0xff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (b *BGRA8888) ToNRGBA() *image.NRGBA {
+	dst := image.NewNRGBA(b.Rect)
+	w := b.Rect.Dx()
+	for y := 0; y < b.Rect.Dy(); y++ {
+		row := b.Pix[y*b.Stride : y*b.Stride+w*4]
+		pix := dst.Pix[y*dst.Stride:]
+		for x := 0; x < len(row); x += 4 {
+			pix[x], pix[x+1], pix[x+2], pix[x+3] = row[x+2], row[x+1], row[x], row[x+3]
+		}
+	}
+	return dst
+}
+
 type BGRA4444 struct {
 	Pix    []uint8
 	Stride int
@@ -91,3 +134,29 @@ func (b *BGRA4444) At(x, y int) color.Color {
 	bg, ra := b.Pix[i], b.Pix[i+1]
 	return wzcolor.BGRA4444{BG: bg, RA: ra}
 }
+
+func (b *BGRA4444) Set(x, y int, c color.Color) {
+	if !image.Pt(x, y).In(b.Rect) {
+		return
+	}
+	i := b.PixOffset(x, y)
+	b.Pix[i], b.Pix[i+1] = encodeBGRA4444(nrgba(c))
+}
+
+func (b *BGRA4444) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(b.Rect)
+	if r.Empty() {
+		return &BGRA4444{}
+	}
+	return &BGRA4444{Pix: b.Pix[b.PixOffset(r.Min.X, r.Min.Y):], Stride: b.Stride, Rect: r}
+}
+
+func (b *BGRA4444) Opaque() bool {
+	return opaque16(b.Pix, b.Stride, b.Rect, func(_, ra byte) bool {
+		return ra&0xf0 == 0xf0
+	})
+}
+
+func (b *BGRA4444) ToNRGBA() *image.NRGBA {
+	return toNRGBA16(b.Pix, b.Stride, b.Rect, decodeBGRA4444)
+}
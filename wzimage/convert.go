@@ -0,0 +1,173 @@
+package wzimage
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Format pixel layouts Convert produces, the values match the canvas format codes
+type Format int
+
+const (
+	// FormatNRGBA produces *image.NRGBA, it isn't a canvas format
+	FormatNRGBA    Format = 0
+	FormatBGRA4444 Format = 1
+	FormatBGRA8888 Format = 2
+	FormatARGB1555 Format = 257
+	FormatRGB565   Format = 513
+)
+
+func nrgba(c color.Color) color.NRGBA {
+	return color.NRGBAModel.Convert(c).(color.NRGBA)
+}
+
+func decodeBGRA4444(bg, ra byte) color.NRGBA {
+	return color.NRGBA{R: (ra & 0x0f) * 0x11, G: (bg >> 4) * 0x11, B: (bg & 0x0f) * 0x11, A: (ra >> 4) * 0x11}
+}
+
+func encodeBGRA4444(c color.NRGBA) (bg, ra byte) {
+	return c.B>>4 | c.G&0xf0, c.R>>4 | c.A&0xf0
+}
+
+func decodeARGB1555(lo, hi byte) color.NRGBA {
+	v := uint16(lo) | uint16(hi)<<8
+	r, g, b := byte(v>>10)&0x1f, byte(v>>5)&0x1f, byte(v)&0x1f
+	return color.NRGBA{R: r<<3 | r>>2, G: g<<3 | g>>2, B: b<<3 | b>>2, A: byte(v>>15) * 0xff}
+}
+
+func encodeARGB1555(c color.NRGBA) (lo, hi byte) {
+	v := uint16(c.A>>7)<<15 | uint16(c.R>>3)<<10 | uint16(c.G>>3)<<5 | uint16(c.B>>3)
+	return byte(v), byte(v >> 8)
+}
+
+// decodeRGB565 expands the way wzcolor.RGB565 does
+func decodeRGB565(lo, hi byte) color.NRGBA {
+	v := uint16(lo) | uint16(hi)<<8
+	return color.NRGBA{R: byte(v>>11) << 3, G: byte(v>>5) << 2, B: byte(v) << 3, A: 0xff}
+}
+
+func encodeRGB565(c color.NRGBA) (lo, hi byte) {
+	v := uint16(c.R>>3)<<11 | uint16(c.G>>2)<<5 | uint16(c.B>>3)
+	return byte(v), byte(v >> 8)
+}
+
+// toNRGBA16 converts r of 2 byte pixels starting at pix
+func toNRGBA16(pix []byte, stride int, r image.Rectangle, decode func(lo, hi byte) color.NRGBA) *image.NRGBA {
+	dst := image.NewNRGBA(r)
+	w := r.Dx()
+	for y := 0; y < r.Dy(); y++ {
+		src := pix[y*stride : y*stride+w*2]
+		row := dst.Pix[y*dst.Stride : y*dst.Stride+w*4]
+		for x := 0; x < w; x++ {
+			c := decode(src[x*2], src[x*2+1])
+			row[x*4] = c.R
+			row[x*4+1] = c.G
+			row[x*4+2] = c.B
+			row[x*4+3] = c.A
+		}
+	}
+	return dst
+}
+
+// fromNRGBA16 fills 2 byte pixels at pix from src
+func fromNRGBA16(pix []byte, stride int, src *image.NRGBA, encode func(c color.NRGBA) (lo, hi byte)) {
+	w := src.Rect.Dx()
+	for y := 0; y < src.Rect.Dy(); y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		dst := pix[y*stride : y*stride+w*2]
+		for x := 0; x < w; x++ {
+			dst[x*2], dst[x*2+1] = encode(color.NRGBA{R: row[x*4], G: row[x*4+1], B: row[x*4+2], A: row[x*4+3]})
+		}
+	}
+}
+
+// opaque16 reports whether every 2 byte pixel of r passes opaque
+func opaque16(pix []byte, stride int, r image.Rectangle, opaque func(lo, hi byte) bool) bool {
+	w := r.Dx()
+	for y := 0; y < r.Dy(); y++ {
+		row := pix[y*stride : y*stride+w*2]
+		for x := 0; x < len(row); x += 2 {
+			if !opaque(row[x], row[x+1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// toNRGBA shared reports whether m holds the pixels of img
+func toNRGBA(img image.Image) (m *image.NRGBA, shared bool) {
+	switch i := img.(type) {
+	case *image.NRGBA:
+		return i, true
+	case *Gray:
+		return i.NRGBA, true
+	case *DXT1:
+		return i.NRGBA, true
+	case *DXT3:
+		return i.NRGBA, true
+	case *DXT5:
+		return i.NRGBA, true
+	case *BC4:
+		return i.NRGBA, true
+	case *BC5:
+		return i.NRGBA, true
+	case *BC7:
+		return i.NRGBA, true
+	case interface{ ToNRGBA() *image.NRGBA }:
+		return i.ToNRGBA(), false
+	}
+	b := img.Bounds()
+	m = image.NewNRGBA(b)
+	draw.Draw(m, b, img, b.Min, draw.Src)
+	return m, false
+}
+
+// ToNRGBA returns img as NRGBA for draw.Draw and encoders, images already
+// decoded to NRGBA are returned without copying
+func ToNRGBA(img image.Image) *image.NRGBA {
+	m, _ := toNRGBA(img)
+	return m
+}
+
+// Convert returns a copy of img in format with the same bounds
+func Convert(img image.Image, format Format) (draw.Image, error) {
+	src, shared := toNRGBA(img)
+	r := src.Rect
+	switch format {
+	case FormatNRGBA:
+		if !shared {
+			return src, nil
+		}
+		dst := image.NewNRGBA(r)
+		for y := 0; y < r.Dy(); y++ {
+			copy(dst.Pix[y*dst.Stride:(y+1)*dst.Stride], src.Pix[y*src.Stride:])
+		}
+		return dst, nil
+	case FormatBGRA8888:
+		dst := &BGRA8888{Pix: make([]byte, r.Dx()*r.Dy()*4), Stride: r.Dx() * 4, Rect: r}
+		for y := 0; y < r.Dy(); y++ {
+			row := src.Pix[y*src.Stride : y*src.Stride+r.Dx()*4]
+			pix := dst.Pix[y*dst.Stride:]
+			for x := 0; x < len(row); x += 4 {
+				pix[x], pix[x+1], pix[x+2], pix[x+3] = row[x+2], row[x+1], row[x], row[x+3]
+			}
+		}
+		return dst, nil
+	case FormatBGRA4444:
+		dst := &BGRA4444{Pix: make([]byte, r.Dx()*r.Dy()*2), Stride: r.Dx() * 2, Rect: r}
+		fromNRGBA16(dst.Pix, dst.Stride, src, encodeBGRA4444)
+		return dst, nil
+	case FormatARGB1555:
+		dst := &ARGB1555{Pix: make([]byte, r.Dx()*r.Dy()*2), Stride: r.Dx() * 2, Rect: r}
+		fromNRGBA16(dst.Pix, dst.Stride, src, encodeARGB1555)
+		return dst, nil
+	case FormatRGB565:
+		dst := &RGB565{Pix: make([]byte, r.Dx()*r.Dy()*2), Stride: r.Dx() * 2, Rect: r}
+		fromNRGBA16(dst.Pix, dst.Stride, src, encodeRGB565)
+		return dst, nil
+	}
+	return nil, errors.New("unsupported format")
+}
@@ -0,0 +1,161 @@
+package wzimage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// palettes hold colors each format stores without loss
+var palettes = map[Format][]color.NRGBA{
+	FormatNRGBA:    {{R: 1, G: 2, B: 3, A: 4}, {R: 200, G: 100, B: 50, A: 255}, {R: 9, G: 8, B: 7}},
+	FormatBGRA8888: {{R: 1, G: 2, B: 3, A: 4}, {R: 200, G: 100, B: 50, A: 255}, {R: 9, G: 8, B: 7}},
+	FormatBGRA4444: {{R: 0x11, G: 0x22, B: 0x33, A: 0x44}, {R: 0xff, B: 0xaa, A: 0xff}, {G: 0x55}},
+	FormatARGB1555: {{R: 0xff, G: 0x84, B: 0x08, A: 0xff}, {R: 0x42, B: 0xff}, {G: 0xff, A: 0xff}},
+	FormatRGB565:   {{R: 0xf8, G: 0x84, B: 0x08, A: 0xff}, {R: 0x40, G: 0xfc, A: 0xff}, {B: 0xf8, A: 0xff}},
+}
+
+var formats = []Format{FormatNRGBA, FormatBGRA8888, FormatBGRA4444, FormatARGB1555, FormatRGB565}
+
+// pattern fills r cycling through palette
+func pattern(r image.Rectangle, palette []color.NRGBA) *image.NRGBA {
+	m := image.NewNRGBA(r)
+	i := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetNRGBA(x, y, palette[i%len(palette)])
+			i++
+		}
+	}
+	return m
+}
+
+func convert(t *testing.T, format Format) (*image.NRGBA, draw.Image) {
+	t.Helper()
+	src := pattern(image.Rect(1, 2, 4, 5), palettes[format])
+	img, err := Convert(src, format)
+	if err != nil {
+		t.Fatalf("format %d: %v", format, err)
+	}
+	return src, img
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	want := map[Format]string{
+		FormatNRGBA:    "*image.NRGBA",
+		FormatBGRA8888: "*wzimage.BGRA8888",
+		FormatBGRA4444: "*wzimage.BGRA4444",
+		FormatARGB1555: "*wzimage.ARGB1555",
+		FormatRGB565:   "*wzimage.RGB565",
+	}
+	for _, format := range formats {
+		src, img := convert(t, format)
+		if got := fmt.Sprintf("%T", img); got != want[format] {
+			t.Errorf("format %d converted to %s, want %s", format, got, want[format])
+		}
+		if img.Bounds() != src.Rect {
+			t.Errorf("format %d bounds %v, want %v", format, img.Bounds(), src.Rect)
+		}
+		if m := ToNRGBA(img); !bytes.Equal(m.Pix, src.Pix) {
+			t.Errorf("format %d round trip %v, want %v", format, m.Pix, src.Pix)
+		}
+		for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+			for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+				// At of the 16 bit formats is premultiplied, transparent pixels drop their color
+				if got, want := color.RGBA64Model.Convert(img.At(x, y)), color.RGBA64Model.Convert(src.At(x, y)); got != want {
+					t.Errorf("format %d at %d,%d: %v, want %v", format, x, y, got, want)
+				}
+			}
+		}
+	}
+	if _, err := Convert(image.NewNRGBA(image.Rect(0, 0, 1, 1)), Format(3)); err == nil {
+		t.Error("converted to an unknown format")
+	}
+}
+
+func TestConvertCopies(t *testing.T) {
+	src, img := convert(t, FormatNRGBA)
+	img.Set(1, 2, color.NRGBA{R: 0xee, A: 0xff})
+	if src.NRGBAAt(1, 2) != palettes[FormatNRGBA][0] {
+		t.Error("Convert to NRGBA shares the source pixels")
+	}
+}
+
+func TestSubImageSet(t *testing.T) {
+	for _, format := range formats[1:] {
+		name := fmt.Sprintf("format %d", format)
+		_, img := convert(t, format)
+		r := image.Rect(2, 3, 4, 5)
+		sub := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(r).(draw.Image)
+		if sub.Bounds() != r {
+			t.Errorf("%s sub image bounds %v, want %v", name, sub.Bounds(), r)
+		}
+		checkAt(t, name+" sub", sub, 2, 3, nrgba(img.At(2, 3)))
+
+		c := palettes[format][0]
+		sub.Set(3, 4, c)
+		checkAt(t, name+" after sub Set", img, 3, 4, c)
+		checkAt(t, name+" after sub Set", sub, 3, 4, c)
+		if m := ToNRGBA(sub); m.Rect != r || m.NRGBAAt(3, 4) != c {
+			t.Errorf("%s sub ToNRGBA %v %v", name, m.Rect, m.NRGBAAt(3, 4))
+		}
+
+		// setting outside the sub image leaves the parent alone
+		before := nrgba(img.At(1, 2))
+		sub.Set(1, 2, c)
+		checkAt(t, name+" after Set outside", img, 1, 2, before)
+	}
+}
+
+func TestSubImageEmpty(t *testing.T) {
+	for _, format := range formats[1:] {
+		name := fmt.Sprintf("format %d", format)
+		_, img := convert(t, format)
+		sub := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(image.Rect(10, 10, 12, 12))
+		if !sub.Bounds().Empty() {
+			t.Errorf("%s empty sub image bounds %v", name, sub.Bounds())
+		}
+		sub.(draw.Image).Set(0, 0, color.White)
+		if m := ToNRGBA(sub); !m.Rect.Empty() || len(m.Pix) != 0 {
+			t.Errorf("%s empty sub image ToNRGBA %v", name, m.Rect)
+		}
+	}
+}
+
+func TestOpaque(t *testing.T) {
+	for _, format := range formats[1:] {
+		_, img := convert(t, format)
+		opaque := format == FormatRGB565
+		if got := img.(interface{ Opaque() bool }).Opaque(); got != opaque {
+			t.Errorf("format %d Opaque %v, want %v", format, got, opaque)
+		}
+		src := pattern(image.Rect(0, 0, 2, 2), []color.NRGBA{{R: 0xff, A: 0xff}})
+		img, _ = Convert(src, format)
+		if !img.(interface{ Opaque() bool }).Opaque() {
+			t.Errorf("format %d opaque image not Opaque", format)
+		}
+	}
+}
+
+func TestDrawFrom(t *testing.T) {
+	for _, format := range formats {
+		_, img := convert(t, format)
+		r := img.Bounds()
+		dst := image.NewRGBA64(r)
+		draw.Draw(dst, r, img, r.Min, draw.Src)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if got, want := dst.RGBA64At(x, y), color.RGBA64Model.Convert(img.At(x, y)); got != want {
+					t.Errorf("format %d drawn %d,%d: %v, want %v", format, x, y, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package wzimage
+
+import (
+	"errors"
+	"image"
+)
+
+// blockDataSize returns the byte size of size in 4x4 blocks of blockSize bytes
+func blockDataSize(size image.Point, blockSize int) int {
+	return ((size.X + 3) / 4) * ((size.Y + 3) / 4) * blockSize
+}
+
+// decodeBlocks decodes 4x4 blocks of blockSize bytes stored row by row into a new image,
+// decode fills 16 NRGBA pixels, blocks on the right and bottom edge are clipped
+func decodeBlocks(size image.Point, data []byte, blockSize int, decode func(dst *[64]byte, src []byte)) (*image.NRGBA, error) {
+	if len(data) != blockDataSize(size, blockSize) {
+		return nil, errors.New("invalid data")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+
+	var block [64]byte
+	offset := 0
+	for y := 0; y < size.Y; y += 4 {
+		h := size.Y - y
+		if h > 4 {
+			h = 4
+		}
+		for x := 0; x < size.X; x += 4 {
+			w := size.X - x
+			if w > 4 {
+				w = 4
+			}
+			decode(&block, data[offset:offset+blockSize])
+			offset += blockSize
+
+			pix := y*img.Stride + x*4
+			for py := 0; py < h; py++ {
+				copy(img.Pix[pix:pix+w*4], block[py*16:])
+				pix += img.Stride
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// rgb565 expands c the way wzcolor.RGB565 does
+func rgb565(c uint16) (r, g, b uint32) {
+	r = uint32(c>>11) & 0x1f << 3
+	g = uint32(c>>5) & 0x3f << 2
+	b = uint32(c) & 0x1f << 3
+	return
+}
+
+// decodeColorBlock decodes an 8 byte DXT colour block, alpha is only written with punchThrough,
+// which makes index 3 of the 3 colour mode transparent black as DXT1 does
+func decodeColorBlock(dst *[64]byte, src []byte, punchThrough bool) {
+	c0 := uint16(src[0]) | uint16(src[1])<<8
+	c1 := uint16(src[2]) | uint16(src[3])<<8
+	r0, g0, b0 := rgb565(c0)
+	r1, g1, b1 := rgb565(c1)
+
+	var palette [4][3]byte
+	palette[0] = [3]byte{byte(r0), byte(g0), byte(b0)}
+	palette[1] = [3]byte{byte(r1), byte(g1), byte(b1)}
+	if c0 > c1 {
+		palette[2] = [3]byte{byte((r0*2 + r1 + 1) / 3), byte((g0*2 + g1 + 1) / 3), byte((b0*2 + b1 + 1) / 3)}
+		palette[3] = [3]byte{byte((r0 + r1*2 + 1) / 3), byte((g0 + g1*2 + 1) / 3), byte((b0 + b1*2 + 1) / 3)}
+	} else {
+		palette[2] = [3]byte{byte((r0 + r1) / 2), byte((g0 + g1) / 2), byte((b0 + b1) / 2)}
+	}
+
+	for i := 0; i < 16; i++ {
+		index := src[4+i/4] >> (uint(i%4) * 2) & 0x03
+		c := &palette[index]
+		dst[i*4] = c[0]
+		dst[i*4+1] = c[1]
+		dst[i*4+2] = c[2]
+		if punchThrough {
+			if index == 3 && c0 <= c1 {
+				dst[i*4+3] = 0
+			} else {
+				dst[i*4+3] = 0xff
+			}
+		}
+	}
+}
+
+// decodeChannelBlock decodes 2 endpoints followed by 16 3 bit indices into channel of dst,
+// the DXT5 alpha block and the BC4 channel block share this layout
+func decodeChannelBlock(dst *[64]byte, src []byte, channel int) {
+	var palette [8]byte
+	a0, a1 := int(src[0]), int(src[1])
+	palette[0] = byte(a0)
+	palette[1] = byte(a1)
+	if a0 > a1 {
+		for i := 2; i < 8; i++ {
+			palette[i] = byte(((8-i)*a0 + (i-1)*a1 + 3) / 7)
+		}
+	} else {
+		for i := 2; i < 6; i++ {
+			palette[i] = byte(((6-i)*a0 + (i-1)*a1 + 2) / 5)
+		}
+		palette[6] = 0
+		palette[7] = 0xff
+	}
+
+	bits := uint64(src[2]) | uint64(src[3])<<8 | uint64(src[4])<<16 |
+		uint64(src[5])<<24 | uint64(src[6])<<32 | uint64(src[7])<<40
+	for i := 0; i < 16; i++ {
+		dst[i*4+channel] = palette[bits&0x07]
+		bits >>= 3
+	}
+}
@@ -0,0 +1,22 @@
+package wzimage
+
+import (
+	"image"
+)
+
+// DXT1 8 byte colour blocks, the 3 colour mode carries 1 bit alpha
+type DXT1 struct {
+	*image.NRGBA
+}
+
+func decodeDXT1Block(dst *[64]byte, src []byte) {
+	decodeColorBlock(dst, src, true)
+}
+
+func NewDXT1(size image.Point, data []byte) (*DXT1, error) {
+	img, err := decodeBlocks(size, data, 8, decodeDXT1Block)
+	if err != nil {
+		return nil, err
+	}
+	return &DXT1{NRGBA: img}, nil
+}
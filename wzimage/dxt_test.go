@@ -0,0 +1,270 @@
+package wzimage
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// row returns the 4 pixels of block row y
+func row(img *image.NRGBA, x, y int) []byte {
+	off := img.PixOffset(x, y)
+	return img.Pix[off : off+16]
+}
+
+func checkPix(t *testing.T, name string, img *image.NRGBA, want []byte) {
+	t.Helper()
+	for y := 0; y < 4; y++ {
+		if got := row(img, 0, y); !bytes.Equal(got, want[y*16:y*16+16]) {
+			t.Errorf("%s row %d: %v, want %v", name, y, got, want[y*16:y*16+16])
+		}
+	}
+}
+
+func TestDXT1Opaque(t *testing.T) {
+	// red over green in 4 colour mode, first row indices 0 1 2 3, the rest 0
+	img, err := NewDXT1(image.Pt(4, 4), []byte{0x00, 0xf8, 0xe0, 0x07, 0xe4, 0x00, 0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{248, 0, 0, 255, 0, 252, 0, 255, 165, 84, 0, 255, 83, 168, 0, 255}
+	if got := row(img.NRGBA, 0, 0); !bytes.Equal(got, want) {
+		t.Fatalf("%v, want %v", got, want)
+	}
+	if !img.Opaque() {
+		t.Error("4 colour block isn't opaque")
+	}
+}
+
+func TestDXT1PunchThrough(t *testing.T) {
+	// blue below red selects the 3 colour mode, index 3 is transparent black
+	img, err := NewDXT1(image.Pt(4, 4), []byte{0x1f, 0x00, 0x00, 0xf8, 0xe4, 0xff, 0xff, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 248, 255, 248, 0, 0, 255, 124, 0, 124, 255, 0, 0, 0, 0}
+	if got := row(img.NRGBA, 0, 0); !bytes.Equal(got, want) {
+		t.Fatalf("%v, want %v", got, want)
+	}
+	if got := row(img.NRGBA, 0, 3); !bytes.Equal(got, make([]byte, 16)) {
+		t.Fatalf("index 3 row %v", got)
+	}
+}
+
+func TestDXT1OddSize(t *testing.T) {
+	// 5x3 is 2 blocks wide, the left one red, the right one green
+	img, err := NewDXT1(image.Pt(5, 3), []byte{
+		0x00, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xe0, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 5, 3) || len(img.Pix) != 5*3*4 {
+		t.Fatalf("bounds %v pix %d", img.Bounds(), len(img.Pix))
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			want := []byte{248, 0, 0, 255}
+			if x == 4 {
+				want = []byte{0, 252, 0, 255}
+			}
+			off := img.PixOffset(x, y)
+			if got := img.Pix[off : off+4]; !bytes.Equal(got, want) {
+				t.Errorf("(%d,%d) %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestBC4(t *testing.T) {
+	// 8 value mode 200 to 100, first row indices 0 1 2 7
+	img, err := NewBC4(image.Pt(4, 4), []byte{200, 100, 0x88, 0x0e, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{200, 200, 200, 255, 100, 100, 100, 255, 186, 186, 186, 255, 114, 114, 114, 255}
+	if got := row(img.NRGBA, 0, 0); !bytes.Equal(got, want) {
+		t.Fatalf("8 value mode %v, want %v", got, want)
+	}
+
+	// 6 value mode 50 to 150, first row indices 6 7 2 0
+	img, err = NewBC4(image.Pt(4, 4), []byte{50, 150, 0xbe, 0x00, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []byte{0, 0, 0, 255, 255, 255, 255, 255, 70, 70, 70, 255, 50, 50, 50, 255}
+	if got := row(img.NRGBA, 0, 0); !bytes.Equal(got, want) {
+		t.Fatalf("6 value mode %v, want %v", got, want)
+	}
+}
+
+func TestBC4OddSize(t *testing.T) {
+	// 3x5 is 2 blocks high, 10 on top and 20 below
+	img, err := NewBC4(image.Pt(3, 5), []byte{10, 10, 0, 0, 0, 0, 0, 0, 20, 20, 0, 0, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 3, 5) {
+		t.Fatalf("bounds %v", img.Bounds())
+	}
+	if c := img.NRGBAAt(2, 3); c.R != 10 || c.A != 255 {
+		t.Errorf("(2,3) %v", c)
+	}
+	if c := img.NRGBAAt(2, 4); c.R != 20 || c.G != 20 || c.B != 20 {
+		t.Errorf("(2,4) %v", c)
+	}
+}
+
+func TestBC5(t *testing.T) {
+	// red like the 8 value BC4 block, green 0 to 255 with pixel 0 at index 1
+	img, err := NewBC5(image.Pt(4, 4), []byte{
+		200, 100, 0x88, 0x0e, 0, 0, 0, 0,
+		0, 255, 0x01, 0, 0, 0, 0, 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{200, 255, 0, 255, 100, 0, 0, 255, 186, 0, 0, 255, 114, 0, 0, 255}
+	if got := row(img.NRGBA, 0, 0); !bytes.Equal(got, want) {
+		t.Fatalf("%v, want %v", got, want)
+	}
+}
+
+// the BC7 blocks below were packed field by field from the mode layouts in the BC7 format
+// specification, the pixels interpolated from the expanded endpoints with its weights
+
+func TestBC7Mode6(t *testing.T) {
+	// endpoints (255,1,129,255) and (0,254,128,254), indices 0 15 8 3 then 0 to 11
+	img, err := NewBC7(image.Pt(4, 4), []byte{
+		0xc0, 0x3f, 0x00, 0xf0, 0x07, 0x02, 0xff, 0xff, 0xf0, 0x38, 0x10, 0x32, 0x54, 0x76, 0x98, 0xba,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPix(t, "mode 6", img.NRGBA, []byte{
+		255, 1, 129, 255, 0, 254, 128, 254, 120, 135, 128, 254, 203, 52, 129, 255,
+		255, 1, 129, 255, 239, 17, 129, 255, 219, 37, 129, 255, 203, 52, 129, 255,
+		187, 68, 129, 255, 171, 84, 129, 255, 151, 104, 129, 255, 135, 120, 129, 255,
+		120, 135, 128, 254, 104, 151, 128, 254, 84, 171, 128, 254, 68, 187, 128, 254,
+	})
+}
+
+func TestBC7Mode5Rotation(t *testing.T) {
+	// rotation 1 swaps red and alpha, colour indices 1 3 2 0 and alpha indices 0 1 2 3 per row
+	img, err := NewBC7(image.Pt(4, 4), []byte{
+		0x60, 0x64, 0x8a, 0x42, 0xfb, 0x07, 0xfc, 0x03, 0x5c, 0x5a, 0x5a, 0x5a, 0xe4, 0xe4, 0xe4, 0xe4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := []byte{255, 73, 171, 148, 171, 181, 0, 40, 84, 128, 84, 93, 0, 20, 255, 201}
+	checkPix(t, "mode 5", img.NRGBA, bytes.Repeat(r, 4))
+}
+
+func TestBC7Mode4Selector(t *testing.T) {
+	// selector 1 interpolates colour with the 3 bit and alpha with the 2 bit indices
+	img, err := NewBC7(image.Pt(4, 4), []byte{
+		0x90, 0x1f, 0x80, 0x0f, 0xd1, 0x0f, 0xc8, 0xc9, 0xc9, 0xc9, 0x39, 0xd3, 0xb6, 0x6d, 0xdb, 0xb6,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPix(t, "mode 4", img.NRGBA, []byte{
+		255, 0, 132, 255, 0, 255, 66, 171, 108, 147, 94, 84, 219, 36, 123, 0,
+		72, 183, 85, 255, 72, 183, 85, 171, 72, 183, 85, 84, 72, 183, 85, 0,
+		72, 183, 85, 255, 72, 183, 85, 171, 72, 183, 85, 84, 72, 183, 85, 0,
+		72, 183, 85, 255, 72, 183, 85, 171, 72, 183, 85, 84, 72, 183, 85, 0,
+	})
+}
+
+func TestBC7Mode1Partition(t *testing.T) {
+	// partition 13 puts the bottom half in subset 1 anchored at pixel 15, shared p-bits 1 and 0
+	img, err := NewBC7(image.Pt(4, 4), []byte{
+		0x36, 0x3f, 0x00, 0x00, 0x00, 0xf0, 0x03, 0xc0, 0x0f, 0xa0, 0xf1, 0x31, 0xaa, 0xef, 0x72, 0x0a,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPix(t, "mode 1", img.NRGBA, []byte{
+		255, 2, 2, 255, 2, 2, 255, 255, 148, 2, 109, 255, 109, 2, 148, 255,
+		219, 2, 38, 255, 184, 2, 73, 255, 73, 2, 184, 255, 38, 2, 219, 255,
+		0, 0, 161, 255, 0, 36, 138, 255, 0, 71, 116, 255, 0, 107, 93, 255,
+		0, 146, 68, 255, 0, 182, 45, 255, 0, 217, 23, 255, 0, 253, 0, 255,
+	})
+}
+
+func TestBC7Mode2ThreeSubsets(t *testing.T) {
+	// partition 0 with red, green and blue subsets anchored at pixels 0, 3 and 15
+	img, err := NewBC7(image.Pt(4, 4), []byte{
+		0x04, 0x3e, 0x00, 0x00, 0x00, 0x00, 0x3e, 0x00, 0x00, 0x00, 0x00, 0xbe, 0x4a, 0x89, 0x22, 0x8a,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPix(t, "mode 2", img.NRGBA, []byte{
+		171, 0, 0, 255, 255, 0, 0, 255, 0, 171, 0, 255, 0, 171, 0, 255,
+		255, 0, 0, 255, 171, 0, 0, 255, 0, 255, 0, 255, 0, 171, 0, 255,
+		171, 0, 0, 255, 0, 0, 255, 255, 0, 0, 198, 255, 0, 255, 0, 255,
+		0, 0, 198, 255, 0, 0, 198, 255, 0, 0, 255, 255, 0, 0, 198, 255,
+	})
+}
+
+func TestBC7ReservedMode(t *testing.T) {
+	block := make([]byte, 16)
+	block[15] = 0xff
+	img, err := NewBC7(image.Pt(4, 4), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Pix, make([]byte, 64)) {
+		t.Fatal("reserved mode isn't transparent black")
+	}
+}
+
+func TestBC7OddSize(t *testing.T) {
+	// the mode 6 block clipped to 2x3 keeps the top left pixels
+	block := []byte{
+		0xc0, 0x3f, 0x00, 0xf0, 0x07, 0x02, 0xff, 0xff, 0xf0, 0x38, 0x10, 0x32, 0x54, 0x76, 0x98, 0xba,
+	}
+	img, err := NewBC7(image.Pt(2, 3), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, _ := NewBC7(image.Pt(4, 4), block)
+	for y := 0; y < 3; y++ {
+		if got, want := img.Pix[y*img.Stride:y*img.Stride+8], full.Pix[y*full.Stride:y*full.Stride+8]; !bytes.Equal(got, want) {
+			t.Errorf("row %d: %v, want %v", y, got, want)
+		}
+	}
+}
+
+// TestBC7Tables checks the hand copied partition and anchor tables agree,
+// pixel 0 anchors subset 0 and every other anchor lies in the subset it anchors
+func TestBC7Tables(t *testing.T) {
+	for p := 0; p < 64; p++ {
+		if s := bc7Partitions2[p]; s&1 != 0 || s>>bc7Anchors2[p]&1 != 1 {
+			t.Errorf("2 subsets partition %d: %#04x anchor %d", p, s, bc7Anchors2[p])
+		}
+		s := bc7Partitions3[p]
+		if s&3 != 0 || s>>(uint(bc7Anchors3a[p])*2)&3 != 1 || s>>(uint(bc7Anchors3b[p])*2)&3 != 2 {
+			t.Errorf("3 subsets partition %d: %#08x anchors %d %d", p, s, bc7Anchors3a[p], bc7Anchors3b[p])
+		}
+	}
+}
+
+func TestBlockDataSize(t *testing.T) {
+	for _, c := range []struct {
+		size image.Point
+		want int
+	}{
+		{image.Pt(4, 4), 8}, {image.Pt(1, 1), 8}, {image.Pt(5, 3), 16}, {image.Pt(9, 9), 72}, {image.Pt(0, 4), 0},
+	} {
+		if got := blockDataSize(c.size, 8); got != c.want {
+			t.Errorf("%v: %d, want %d", c.size, got, c.want)
+		}
+	}
+	if _, err := NewBC7(image.Pt(5, 5), make([]byte, 16)); err == nil {
+		t.Error("BC7 accepted short data")
+	}
+}
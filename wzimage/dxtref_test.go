@@ -0,0 +1,302 @@
+package wzimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/anonymous5l/wzexplorer/wzcolor"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// the decoders below are the per pixel color.Color implementations the block decoders replaced,
+// kept as reference with two fixes: the colour index slice covers the 4 bytes it reads instead of
+// running past the last block, and the palette is interpolated on 8 bit channels, the old code
+// interpolated the 16 bit RGBA values and kept the low byte. They only handle multiples of 4
+
+func oldColorTable(colorTable []color.Color, c0, c1 uint16) {
+	colorTable[0] = wzcolor.RGB565(c0)
+	colorTable[1] = wzcolor.RGB565(c1)
+
+	ar, ag, ab, _ := colorTable[0].RGBA()
+	br, bg, bb, _ := colorTable[1].RGBA()
+	ar, ag, ab, br, bg, bb = ar>>8, ag>>8, ab>>8, br>>8, bg>>8, bb>>8
+
+	if c0 > c1 {
+		colorTable[2] = color.NRGBA{
+			R: byte((ar*2 + br + 1) / 3),
+			G: byte((ag*2 + bg + 1) / 3),
+			B: byte((ab*2 + bb + 1) / 3),
+			A: 0xFF,
+		}
+		colorTable[3] = color.NRGBA{
+			R: byte((ar + br*2 + 1) / 3),
+			G: byte((ag + bg*2 + 1) / 3),
+			B: byte((ab + bb*2 + 1) / 3),
+			A: 0xFF,
+		}
+	} else {
+		colorTable[2] = color.NRGBA{
+			R: byte((ar + br) / 2),
+			G: byte((ag + bg) / 2),
+			B: byte((ab + bb) / 2),
+			A: 0xFF,
+		}
+		colorTable[3] = color.NRGBA{A: 0xFF}
+	}
+}
+
+func oldColorIndexTable(colorIndexTable []int, data []byte) {
+	for i := 0; i < 16; i += 4 {
+		dataIndex := i / 4
+		colorIndexTable[i] = int(data[dataIndex] & 0x03)
+		colorIndexTable[i+1] = int(data[dataIndex]&0x0c) >> 2
+		colorIndexTable[i+2] = int(data[dataIndex]&0x30) >> 4
+		colorIndexTable[i+3] = int(data[dataIndex]&0xc0) >> 6
+	}
+}
+
+func oldDXT3(size image.Point, data []byte) *image.NRGBA {
+	d := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+
+	var (
+		alphaTable      [16]byte
+		colorTable      [4]color.Color
+		colorIndexTable [16]int
+	)
+
+	genAlphaTable := func(data []byte) {
+		for i := 0; i < 16; i += 2 {
+			a := data[i/2]
+			a0 := a & 0x0f
+			a0 |= a0 << 4
+			a1 := (a & 0xf0) >> 4
+			a1 |= a1 << 4
+			alphaTable[i] = a0
+			alphaTable[i+1] = a1
+		}
+	}
+
+	for y := 0; y < size.Y; y += 4 {
+		for x := 0; x < size.X; x += 4 {
+			offset := x*4 + y*size.X
+			genAlphaTable(data[offset : offset+8])
+			c0 := binary.LittleEndian.Uint16(data[offset+8 : offset+10])
+			c1 := binary.LittleEndian.Uint16(data[offset+10 : offset+12])
+			oldColorTable(colorTable[:], c0, c1)
+			oldColorIndexTable(colorIndexTable[:], data[offset+12:offset+16])
+			for py := 0; py < 4; py++ {
+				for px := 0; px < 4; px++ {
+					r, g, b, _ := colorTable[colorIndexTable[py*4+px]].RGBA()
+					a := alphaTable[py*4+px]
+					d.Set(x+px, y+py, color.NRGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: a})
+				}
+			}
+		}
+	}
+
+	return d
+}
+
+func oldDXT5(size image.Point, data []byte) *image.NRGBA {
+	d := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+
+	var (
+		alphaTable      [8]byte
+		alphaIndexTable [16]byte
+		colorTable      [4]color.Color
+		colorIndexTable [16]int
+	)
+
+	genAlphaTable := func(a0, a1 byte) {
+		alphaTable[0] = a0
+		alphaTable[1] = a1
+		if a0 > a1 {
+			for i := 2; i < 8; i++ {
+				alphaTable[i] = byte(((8-i)*int(a0) + (i-1)*int(a1) + 3) / 7)
+			}
+		} else {
+			for i := 2; i < 6; i++ {
+				alphaTable[i] = byte(((6-i)*int(a0) + (i-1)*int(a1) + 2) / 5)
+			}
+			alphaTable[6] = 0
+			alphaTable[7] = 0xFF
+		}
+	}
+
+	genAlphaIndexTable := func(data []byte) {
+		for i := 0; i < 16; i += 8 {
+			dataIndex := (i / 8) * 3
+			flags := int(data[dataIndex]) | int(data[dataIndex+1])<<8 | int(data[dataIndex+2])<<16
+			for j := 0; j < 8; j++ {
+				mask := 0x07 << (3 * j)
+				alphaIndexTable[i+j] = byte((flags & mask) >> (3 * j))
+			}
+		}
+	}
+
+	for y := 0; y < size.Y; y += 4 {
+		for x := 0; x < size.X; x += 4 {
+			offset := x*4 + y*size.X
+			genAlphaTable(data[offset], data[offset+1])
+			genAlphaIndexTable(data[offset+2 : offset+8])
+			c0 := binary.LittleEndian.Uint16(data[offset+8 : offset+10])
+			c1 := binary.LittleEndian.Uint16(data[offset+10 : offset+12])
+			oldColorTable(colorTable[:], c0, c1)
+			oldColorIndexTable(colorIndexTable[:], data[offset+12:offset+16])
+			for py := 0; py < 4; py++ {
+				for px := 0; px < 4; px++ {
+					r, g, b, _ := colorTable[colorIndexTable[py*4+px]].RGBA()
+					a := alphaTable[alphaIndexTable[py*4+px]]
+					d.Set(x+px, y+py, color.NRGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: a})
+				}
+			}
+		}
+	}
+
+	return d
+}
+
+func randomBlocks(size image.Point, seed int64) []byte {
+	data := make([]byte, blockDataSize(size, 16))
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// padded decodes size rounded up to whole blocks with decode and crops the result
+func padded(size image.Point, data []byte, decode func(image.Point, []byte) *image.NRGBA) *image.NRGBA {
+	full := image.Pt((size.X+3)&^3, (size.Y+3)&^3)
+	return decode(full, data).SubImage(image.Rect(0, 0, size.X, size.Y)).(*image.NRGBA)
+}
+
+func equalPix(a, b *image.NRGBA) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		if !bytes.Equal(a.Pix[a.PixOffset(r.Min.X, y):a.PixOffset(r.Max.X, y)], b.Pix[b.PixOffset(r.Min.X, y):b.PixOffset(r.Max.X, y)]) {
+			return false
+		}
+	}
+	return true
+}
+
+var referenceSizes = []image.Point{{4, 4}, {16, 8}, {64, 64}, {1, 1}, {3, 5}, {5, 3}, {13, 7}, {30, 2}}
+
+func TestDXT3Reference(t *testing.T) {
+	for _, size := range referenceSizes {
+		data := randomBlocks(size, int64(size.X*100+size.Y))
+		img, err := NewDXT3(size, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalPix(img.NRGBA, padded(size, data, oldDXT3)) {
+			t.Errorf("%v differs from the reference", size)
+		}
+	}
+}
+
+func TestDXT5Reference(t *testing.T) {
+	for _, size := range referenceSizes {
+		data := randomBlocks(size, int64(size.X*100+size.Y))
+		img, err := NewDXT5(size, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalPix(img.NRGBA, padded(size, data, oldDXT5)) {
+			t.Errorf("%v differs from the reference", size)
+		}
+	}
+}
+
+func TestDXT3Golden(t *testing.T) {
+	block := []byte{
+		// alpha 0x0 0xf 0x8 0x1 then 0xf
+		0xf0, 0x18, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		// red and blue, first row indices 0 1 2 3 then 0
+		0x00, 0xf8, 0x1f, 0x00, 0xe4, 0x00, 0x00, 0x00,
+	}
+	img, err := NewDXT3(image.Pt(4, 4), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{248, 0, 0, 0x00, 0, 0, 248, 0xff, 165, 0, 83, 0x88, 83, 0, 165, 0x11}
+	if !bytes.Equal(img.Pix[:16], want) {
+		t.Fatalf("first row % x, want % x", img.Pix[:16], want)
+	}
+	for i := 16; i < 64; i += 4 {
+		if !bytes.Equal(img.Pix[i:i+4], []byte{248, 0, 0, 0xff}) {
+			t.Fatalf("pixel %d % x", i/4, img.Pix[i:i+4])
+		}
+	}
+}
+
+func TestDXT5Golden(t *testing.T) {
+	block := []byte{
+		// alpha 255 to 0, pixel 0 index 2, the rest index 1
+		0xff, 0x00, 0x4a, 0x92, 0x24, 0x49, 0x92, 0x24,
+		// black and blue in 3 colour mode, first row indices 0 1 2 3 then 0
+		0x00, 0x00, 0x1f, 0x00, 0xe4, 0x00, 0x00, 0x00,
+	}
+	img, err := NewDXT5(image.Pt(4, 4), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 0, 219, 0, 0, 248, 0, 0, 0, 124, 0, 0, 0, 0, 0}
+	if !bytes.Equal(img.Pix[:16], want) {
+		t.Fatalf("first row % x, want % x", img.Pix[:16], want)
+	}
+}
+
+func TestDXTInvalidSize(t *testing.T) {
+	if _, err := NewDXT3(image.Pt(5, 5), make([]byte, 16)); err == nil {
+		t.Error("DXT3 accepted short data")
+	}
+	if _, err := NewDXT5(image.Pt(4, 4), make([]byte, 32)); err == nil {
+		t.Error("DXT5 accepted long data")
+	}
+}
+
+var benchSize = image.Pt(512, 512)
+
+func BenchmarkDXT3(b *testing.B) {
+	data := randomBlocks(benchSize, 1)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewDXT3(benchSize, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDXT3Old(b *testing.B) {
+	data := randomBlocks(benchSize, 1)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		oldDXT3(benchSize, data)
+	}
+}
+
+func BenchmarkDXT5(b *testing.B) {
+	data := randomBlocks(benchSize, 1)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewDXT5(benchSize, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDXT5Old(b *testing.B) {
+	data := randomBlocks(benchSize, 1)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		oldDXT5(benchSize, data)
+	}
+}
@@ -0,0 +1,27 @@
+package wzimage
+
+import (
+	"errors"
+	"image"
+)
+
+// Gray black and white thumbnails, BGRA4444 pixels reduced to their luminance
+type Gray struct {
+	*image.NRGBA
+}
+
+func NewGray(size image.Point, data []byte) (*Gray, error) {
+	n := size.X * size.Y
+	if len(data) < n*2 {
+		return nil, errors.New("invalid data")
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	for i := 0; i < n; i++ {
+		c := decodeBGRA4444(data[i*2], data[i*2+1])
+		// the weights of color.GrayModel
+		y := byte((19595*uint32(c.R) + 38470*uint32(c.G) + 7471*uint32(c.B) + 1<<15) >> 16)
+		p := img.Pix[i*4 : i*4+4]
+		p[0], p[1], p[2], p[3] = y, y, y, c.A
+	}
+	return &Gray{NRGBA: img}, nil
+}
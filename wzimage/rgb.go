@@ -50,6 +50,33 @@ func (b *RGB565) At(x, y int) color.Color {
 	return color.NRGBA{R: uint8(cr), G: uint8(cg), B: uint8(cb), A: uint8(ca)}
 }
 
+func (b *RGB565) Set(x, y int, c color.Color) {
+	if !image.Pt(x, y).In(b.Rect) {
+		return
+	}
+	i := b.PixOffset(x, y)
+	b.Pix[i], b.Pix[i+1] = encodeRGB565(nrgba(c))
+}
+
+func (b *RGB565) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(b.Rect)
+	if r.Empty() {
+		return &RGB565{}
+	}
+	return &RGB565{Pix: b.Pix[b.PixOffset(r.Min.X, r.Min.Y):], Stride: b.Stride, Rect: r}
+}
+
+func (b *RGB565) Opaque() bool {
+	return true
+}
+
+func (b *RGB565) ToNRGBA() *image.NRGBA {
+	return toNRGBA16(b.Pix, b.Stride, b.Rect, decodeRGB565)
+}
+
+// RGB565Thumb RGB565 stored at a sixteenth of the size
+//
+// Deprecated: canvases decode RGB565 at the stored size and enlarge it with Upscale.
 type RGB565Thumb struct {
 	Pix    []uint8
 	Stride int
@@ -78,9 +105,10 @@ func (b *RGB565Thumb) Bounds() image.Rectangle {
 	return b.Rect
 }
 
+// PixOffset blocks are aligned to absolute coordinates so sub images share them
 func (b *RGB565Thumb) PixOffset(x, y int) int {
-	ry := (y - b.Rect.Min.Y) / 16
-	rx := (x - b.Rect.Min.X) / 16
+	ry := y/16 - b.Rect.Min.Y/16
+	rx := x/16 - b.Rect.Min.X/16
 	return ry*b.Stride + rx*2
 }
 
@@ -92,3 +120,38 @@ func (b *RGB565Thumb) At(x, y int) color.Color {
 	cr, cg, cb, ca := wzcolor.RGB565(uint16(b.Pix[i]) | (uint16(b.Pix[i+1]) << 8)).RGBA()
 	return color.NRGBA{R: uint8(cr), G: uint8(cg), B: uint8(cb), A: uint8(ca)}
 }
+
+// Set sets the whole 16x16 block holding x, y
+func (b *RGB565Thumb) Set(x, y int, c color.Color) {
+	if !image.Pt(x, y).In(b.Rect) {
+		return
+	}
+	i := b.PixOffset(x, y)
+	b.Pix[i], b.Pix[i+1] = encodeRGB565(nrgba(c))
+}
+
+func (b *RGB565Thumb) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(b.Rect)
+	if r.Empty() {
+		return &RGB565Thumb{}
+	}
+	return &RGB565Thumb{Pix: b.Pix[b.PixOffset(r.Min.X, r.Min.Y):], Stride: b.Stride, Rect: r}
+}
+
+func (b *RGB565Thumb) Opaque() bool {
+	return true
+}
+
+func (b *RGB565Thumb) ToNRGBA() *image.NRGBA {
+	dst := image.NewNRGBA(b.Rect)
+	for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+		row := dst.Pix[dst.PixOffset(b.Rect.Min.X, y):]
+		for x := b.Rect.Min.X; x < b.Rect.Max.X; x++ {
+			i := b.PixOffset(x, y)
+			c := decodeRGB565(b.Pix[i], b.Pix[i+1])
+			j := (x - b.Rect.Min.X) * 4
+			row[j], row[j+1], row[j+2], row[j+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	return dst
+}
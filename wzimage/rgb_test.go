@@ -0,0 +1,63 @@
+package wzimage
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// colors as RGB565 expands them, the low bits stay zero
+var (
+	red   = color.NRGBA{R: 248, A: 255}
+	green = color.NRGBA{G: 252, A: 255}
+	blue  = color.NRGBA{B: 248, A: 255}
+	white = color.NRGBA{R: 248, G: 252, B: 248, A: 255}
+	black = color.NRGBA{A: 255}
+)
+
+func checkAt(t *testing.T, name string, img image.Image, x, y int, want color.NRGBA) {
+	t.Helper()
+	if got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA); got != want {
+		t.Errorf("%s at %d,%d: %v, want %v", name, x, y, got, want)
+	}
+}
+
+func TestRGB565Thumb(t *testing.T) {
+	// 2x2 blocks of 16x16: red, green / blue, white
+	img, err := NewRGB565Thumb(image.Pt(32, 32), []byte{0x00, 0xf8, 0xe0, 0x07, 0x1f, 0x00, 0xff, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAt(t, "thumb", img, 5, 5, red)
+	checkAt(t, "thumb", img, 20, 3, green)
+	checkAt(t, "thumb", img, 3, 20, blue)
+	checkAt(t, "thumb", img, 31, 31, white)
+
+	// blocks stay aligned to absolute coordinates inside a sub image
+	sub := img.SubImage(image.Rect(8, 8, 24, 24)).(*RGB565Thumb)
+	checkAt(t, "sub", sub, 8, 8, red)
+	checkAt(t, "sub", sub, 16, 8, green)
+	checkAt(t, "sub", sub, 8, 16, blue)
+	checkAt(t, "sub", sub, 23, 23, white)
+
+	sub.Set(20, 20, black)
+	checkAt(t, "thumb after Set", img, 31, 31, black)
+	checkAt(t, "thumb after Set", img, 16, 16, black)
+
+	m := sub.ToNRGBA()
+	if m.Rect != sub.Rect {
+		t.Fatalf("ToNRGBA bounds %v, want %v", m.Rect, sub.Rect)
+	}
+	checkAt(t, "ToNRGBA", m, 15, 15, red)
+	checkAt(t, "ToNRGBA", m, 16, 16, black)
+
+	if !img.Opaque() {
+		t.Error("thumb not opaque")
+	}
+	if r := img.SubImage(image.Rect(40, 40, 50, 50)).Bounds(); !r.Empty() {
+		t.Errorf("sub image outside bounds %v", r)
+	}
+	if _, err = NewRGB565Thumb(image.Pt(32, 32), make([]byte, 7)); err == nil {
+		t.Error("short data accepted")
+	}
+}
@@ -0,0 +1,37 @@
+package wzimage
+
+import (
+	"image"
+)
+
+// ScaledSize returns the size a bitmap of size is stored at with the mag level scale
+func ScaledSize(size image.Point, scale int) image.Point {
+	n := 1<<scale - 1
+	return image.Pt((size.X+n)>>scale, (size.Y+n)>>scale)
+}
+
+// Upscale repeats every pixel of img 2^scale times in both directions like the client does
+// for scaled textures, the result is cropped to size
+func Upscale(img image.Image, scale int, size image.Point) *image.NRGBA {
+	src := ToNRGBA(img)
+	dst := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	w := size.X
+	if w > sw<<scale {
+		w = sw << scale
+	}
+	mask := 1<<scale - 1
+	for y := 0; y < size.Y && y>>scale < sh; y++ {
+		row := dst.Pix[y*dst.Stride : y*dst.Stride+w*4]
+		if y&mask != 0 {
+			copy(row, dst.Pix[(y-1)*dst.Stride:])
+			continue
+		}
+		pix := src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y>>scale):]
+		for x := 0; x < w; x++ {
+			copy(row[x*4:x*4+4], pix[(x>>scale)*4:])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,145 @@
+package wzindex
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"io"
+	"path"
+	"sort"
+)
+
+type BuildOptions struct {
+	// Root path of root inside the archive, hits are reported below it
+	Root string
+	// Progress called before each image is indexed
+	Progress func(path string)
+}
+
+type builder struct {
+	opts  *BuildOptions
+	ids   map[string]uint32
+	terms []string
+	ix    *Index
+}
+
+func (b *builder) term(s string) uint32 {
+	id, ok := b.ids[s]
+	if !ok {
+		id = uint32(len(b.terms))
+		b.ids[s] = id
+		b.terms = append(b.terms, s)
+	}
+	return id
+}
+
+// value returns the indexed text of a scalar, false for containers and binary data
+func value(o wzexplorer.Object) (string, bool) {
+	switch o.Type() {
+	case wzexplorer.ObjectTypeVariantInt16, wzexplorer.ObjectTypeVariantInt32, wzexplorer.ObjectTypeVariantInt64,
+		wzexplorer.ObjectTypeVariantFloat32, wzexplorer.ObjectTypeVariantFloat64,
+		wzexplorer.ObjectTypeVariantString, wzexplorer.ObjectTypeUOL:
+		return o.String(), true
+	}
+	return "", false
+}
+
+type child struct {
+	name string
+	obj  wzexplorer.Object
+}
+
+// children returns the children of o sorted by name, entry ids follow this order so
+// the same archive always builds the same index
+func children(o wzexplorer.GetObject) ([]child, error) {
+	var list []child
+	if err := o.Each(func(name string, c wzexplorer.Object) error {
+		list = append(list, child{name: name, obj: c})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list, nil
+}
+
+func (b *builder) walk(p string, parent uint32, o wzexplorer.GetObject) error {
+	list, err := children(o)
+	if err != nil {
+		return err
+	}
+	for _, ch := range list {
+		name, c := ch.name, ch.obj
+		id := uint32(len(b.ix.parents))
+		e := entry{name: b.term(name), typ: c.Type()}
+		if v, ok := value(c); ok {
+			e.value = b.term(v) + 1
+		}
+		b.ix.parents = append(b.ix.parents, parent)
+		b.ix.entries = append(b.ix.entries, e)
+
+		switch c.Type() {
+		case wzexplorer.ObjectTypeDirectory, wzexplorer.ObjectTypeProperties,
+			wzexplorer.ObjectTypeConvex, wzexplorer.ObjectTypeCanvas:
+		default:
+			continue
+		}
+		cp := path.Join(p, name)
+		image := c.Checksum() != 0 && c.Type() == wzexplorer.ObjectTypeProperties
+		if image && b.opts.Progress != nil {
+			b.opts.Progress(cp)
+		}
+		if err = b.walk(cp, id+1, c); err != nil {
+			return err
+		}
+		if image {
+			c.Unload()
+		}
+	}
+	return nil
+}
+
+// sortTerms orders the dictionary so prefix and exact lookups can binary search it
+func (b *builder) sortTerms() {
+	ix := b.ix
+	order := make([]uint32, len(b.terms))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	sort.Slice(order, func(i, j int) bool { return b.terms[order[i]] < b.terms[order[j]] })
+
+	remap := make([]uint32, len(order))
+	terms := make([]string, len(order))
+	for to, from := range order {
+		remap[from] = uint32(to)
+		terms[to] = b.terms[from]
+	}
+	ix.terms = newDictionary(terms)
+	for i := range ix.entries {
+		e := &ix.entries[i]
+		e.name = remap[e.name]
+		if e.value > 0 {
+			e.value = remap[e.value-1] + 1
+		}
+	}
+}
+
+// Build walks every node below root once, indexing its name, path and scalar value,
+// and writes the index to w
+func Build(root wzexplorer.GetObject, w io.Writer, opts *BuildOptions) error {
+	if opts == nil {
+		opts = &BuildOptions{}
+	}
+	b := &builder{opts: opts, ids: make(map[string]uint32), ix: &Index{root: opts.Root}}
+	if b.ix.root == "" {
+		b.ix.root = "/"
+	}
+	if err := b.walk("/", 0, root); err != nil {
+		return err
+	}
+	b.sortTerms()
+	ix := b.ix
+	ix.names = ix.postings(func(e *entry) uint32 { return e.name + 1 })
+	ix.values = ix.postings(func(e *entry) uint32 { return e.value })
+	return ix.write(w)
+}
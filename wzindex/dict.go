@@ -0,0 +1,119 @@
+package wzindex
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// dictionary sorted terms stored back to back, term i is data[offsets[i]:offsets[i+1]]
+type dictionary struct {
+	data    string
+	offsets []uint32
+}
+
+func newDictionary(terms []string) dictionary {
+	d := dictionary{offsets: make([]uint32, len(terms)+1)}
+	var b strings.Builder
+	for i, t := range terms {
+		b.WriteString(t)
+		d.offsets[i+1] = uint32(b.Len())
+	}
+	d.data = b.String()
+	return d
+}
+
+func (d *dictionary) len() int {
+	return len(d.offsets) - 1
+}
+
+func (d *dictionary) at(i uint32) string {
+	return d.data[d.offsets[i]:d.offsets[i+1]]
+}
+
+// search returns the first term not less than s
+func (d *dictionary) search(s string) int {
+	return sort.Search(d.len(), func(i int) bool { return d.at(uint32(i)) >= s })
+}
+
+// prefixed returns the range of terms starting with prefix
+func (d *dictionary) prefixed(prefix string) (lo, hi int) {
+	lo = d.search(prefix)
+	hi = lo + sort.Search(d.len()-lo, func(i int) bool {
+		return !strings.HasPrefix(d.at(uint32(lo+i)), prefix)
+	})
+	return
+}
+
+// term returns the term containing byte offset pos
+func (d *dictionary) term(pos int) uint32 {
+	return uint32(sort.Search(d.len(), func(i int) bool { return int(d.offsets[i+1]) > pos }))
+}
+
+// contains returns the terms containing s, one scan of the whole data instead of one per term
+func (d *dictionary) contains(s string) []uint32 {
+	var ids []uint32
+	if s == "" {
+		for i := 0; i < d.len(); i++ {
+			ids = append(ids, uint32(i))
+		}
+		return ids
+	}
+	for pos := 0; ; {
+		i := strings.Index(d.data[pos:], s)
+		if i < 0 {
+			return ids
+		}
+		pos += i
+		t := d.term(pos)
+		if end := int(d.offsets[t+1]); pos+len(s) <= end {
+			// a match within the term, continue with the next one
+			ids = append(ids, t)
+			pos = end
+		} else {
+			// the match spans two terms
+			pos++
+		}
+	}
+}
+
+// fold returns the dictionary with every term lower cased, no longer sorted
+func (d *dictionary) fold() dictionary {
+	data := []byte(d.data)
+	ascii := true
+	for i, c := range data {
+		if 'A' <= c && c <= 'Z' {
+			data[i] = c + 'a' - 'A'
+		} else if c >= utf8.RuneSelf {
+			ascii = false
+		}
+	}
+	if ascii {
+		return dictionary{data: string(data), offsets: d.offsets}
+	}
+
+	// lower casing other letters can change their length, the offsets are rebuilt
+	f := dictionary{offsets: make([]uint32, len(d.offsets))}
+	var b strings.Builder
+	b.Grow(len(data))
+	for i := 0; i < d.len(); i++ {
+		t := data[d.offsets[i]:d.offsets[i+1]]
+		if utf8.Valid(t) && !isASCII(t) {
+			b.WriteString(strings.ToLower(string(t)))
+		} else {
+			b.Write(t)
+		}
+		f.offsets[i+1] = uint32(b.Len())
+	}
+	f.data = b.String()
+	return f
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,301 @@
+package wzindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/anonymous5l/wzexplorer"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	magic   = "WZIX"
+	version = 1
+)
+
+var (
+	ErrInvalidIndex = errors.New("invalid index")
+	ErrNotIndexed   = errors.New("path not indexed")
+)
+
+type entry struct {
+	name uint32
+	// value term id plus one, zero for nodes without a scalar value
+	value uint32
+	typ   wzexplorer.ObjectType
+}
+
+// postings entry ids of every term, the ids of term i are ids[offsets[i]:offsets[i+1]]
+type postings struct {
+	offsets []uint32
+	ids     []uint32
+}
+
+func (p *postings) of(term uint32) []uint32 {
+	return p.ids[p.offsets[term]:p.offsets[term+1]]
+}
+
+// Index an inverted index over the names and scalar values of an archive,
+// entries are stored depth first so every subtree is a contiguous id range
+type Index struct {
+	root  string
+	terms dictionary
+	// parents parent entry id plus one, zero below the root
+	parents []uint32
+	entries []entry
+	// ends first id after the subtree of each entry
+	ends   []uint32
+	names  postings
+	values postings
+
+	foldOnce sync.Once
+	folded   dictionary
+}
+
+// Root returns the archive path the index was built from
+func (ix *Index) Root() string {
+	return ix.root
+}
+
+// Len returns the number of indexed nodes
+func (ix *Index) Len() int {
+	return len(ix.entries)
+}
+
+// subtrees derives the subtree range of every entry from the parents
+func (ix *Index) subtrees() {
+	ix.ends = make([]uint32, len(ix.entries))
+	for i := range ix.ends {
+		ix.ends[i] = uint32(i + 1)
+	}
+	for i := len(ix.parents) - 1; i >= 0; i-- {
+		if p := ix.parents[i]; p > 0 && ix.ends[i] > ix.ends[p-1] {
+			ix.ends[p-1] = ix.ends[i]
+		}
+	}
+}
+
+// postings groups the entry ids by term, term returns the term id plus one or zero for none
+func (ix *Index) postings(term func(e *entry) uint32) postings {
+	p := postings{offsets: make([]uint32, ix.terms.len()+1)}
+	for i := range ix.entries {
+		if t := term(&ix.entries[i]); t > 0 {
+			p.offsets[t]++
+		}
+	}
+	for i := 1; i < len(p.offsets); i++ {
+		p.offsets[i] += p.offsets[i-1]
+	}
+	p.ids = make([]uint32, p.offsets[len(p.offsets)-1])
+	next := make([]uint32, ix.terms.len())
+	copy(next, p.offsets)
+	for i := range ix.entries {
+		if t := term(&ix.entries[i]); t > 0 {
+			p.ids[next[t-1]] = uint32(i)
+			next[t-1]++
+		}
+	}
+	return p
+}
+
+type writer struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (w *writer) uvarint(v uint64) {
+	n := binary.PutUvarint(w.buf[:], v)
+	_, _ = w.w.Write(w.buf[:n])
+}
+
+func (w *writer) string(s string) {
+	w.uvarint(uint64(len(s)))
+	_, _ = w.w.WriteString(s)
+}
+
+func (w *writer) postings(p *postings) {
+	for t := 0; t+1 < len(p.offsets); t++ {
+		ids := p.of(uint32(t))
+		w.uvarint(uint64(len(ids)))
+		last := uint32(0)
+		for _, id := range ids {
+			w.uvarint(uint64(id - last))
+			last = id
+		}
+	}
+}
+
+// write stores the magic, version, root, sorted term lengths and data, entries and both postings lists as
+// uvarints, postings delta encoded, followed by the crc-32 of everything before it
+func (ix *Index) write(w io.Writer) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriterSize(io.MultiWriter(w, crc), 64<<10)
+	iw := &writer{w: bw}
+
+	_, _ = bw.WriteString(magic)
+	iw.uvarint(version)
+	iw.string(ix.root)
+	iw.uvarint(uint64(ix.terms.len()))
+	for i := 0; i < ix.terms.len(); i++ {
+		iw.uvarint(uint64(ix.terms.offsets[i+1] - ix.terms.offsets[i]))
+	}
+	iw.string(ix.terms.data)
+	iw.uvarint(uint64(len(ix.entries)))
+	for i, e := range ix.entries {
+		iw.uvarint(uint64(ix.parents[i]))
+		iw.uvarint(uint64(e.name))
+		_ = bw.WriteByte(byte(e.typ))
+		iw.uvarint(uint64(e.value))
+	}
+	iw.postings(&ix.names)
+	iw.postings(&ix.values)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, crc.Sum32())
+}
+
+// reader decodes uvarints from data, the first failure sticks and zero is returned after it
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = ErrInvalidIndex
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count reads a length that must fit in the remaining data at min bytes per element
+func (r *reader) count(min int) int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)/min) {
+		r.err = ErrInvalidIndex
+		return 0
+	}
+	return int(n)
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data) {
+		r.err = ErrInvalidIndex
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	return string(r.bytes(r.count(1)))
+}
+
+// id reads an id that must be below limit
+func (r *reader) id(limit int) uint32 {
+	v := r.uvarint()
+	if v >= uint64(limit) {
+		r.err = ErrInvalidIndex
+		return 0
+	}
+	return uint32(v)
+}
+
+func (r *reader) postings(p *postings, terms, entries int) {
+	p.offsets = make([]uint32, terms+1)
+	for t := 0; t < terms && r.err == nil; t++ {
+		n := r.count(1)
+		last := uint32(0)
+		for i := 0; i < n && r.err == nil; i++ {
+			last += r.id(entries - int(last))
+			p.ids = append(p.ids, last)
+		}
+		p.offsets[t+1] = uint32(len(p.ids))
+	}
+}
+
+// Read decodes an index written by Build
+func Read(r io.Reader) (*Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(magic)+4 || string(data[:len(magic)]) != magic {
+		return nil, ErrInvalidIndex
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(body):]) {
+		return nil, ErrInvalidIndex
+	}
+
+	ir := &reader{data: body[len(magic):]}
+	if ir.uvarint() != version {
+		return nil, ErrInvalidIndex
+	}
+	ix := &Index{root: ir.string()}
+	terms := ir.count(1)
+	ix.terms.offsets = make([]uint32, terms+1)
+	size := 0
+	for i := 0; i < terms; i++ {
+		if size += ir.count(1); size > len(ir.data) {
+			return nil, ErrInvalidIndex
+		}
+		ix.terms.offsets[i+1] = uint32(size)
+	}
+	ix.terms.data = ir.string()
+	if len(ix.terms.data) != size {
+		return nil, ErrInvalidIndex
+	}
+	n := ir.count(4)
+	ix.parents = make([]uint32, n)
+	ix.entries = make([]entry, n)
+	for i := range ix.entries {
+		// parents always precede their children
+		ix.parents[i] = ir.id(i + 1)
+		e := &ix.entries[i]
+		e.name = ir.id(terms)
+		e.typ = wzexplorer.ObjectType(ir.byte())
+		e.value = ir.id(terms + 1)
+		if ir.err != nil {
+			return nil, ir.err
+		}
+	}
+	ir.postings(&ix.names, terms, n)
+	ir.postings(&ix.values, terms, n)
+	if ir.err != nil {
+		return nil, ir.err
+	}
+	if len(ir.data) != 0 {
+		return nil, ErrInvalidIndex
+	}
+
+	ix.subtrees()
+	return ix, nil
+}
+
+// Open reads the index file name
+func Open(name string) (*Index, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
@@ -0,0 +1,202 @@
+package wzindex_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"github.com/anonymous5l/wzexplorer/wzindex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func archive(t *testing.T) string {
+	b := wztest.New(wzexplorer.IvEmpty)
+	var mobs []wztest.Prop
+	for i := 0; i < 20; i++ {
+		mobs = append(mobs, wztest.Prop{Name: fmt.Sprint(i), Value: b.Properties(
+			wztest.Prop{Name: "id", Value: int32(100100 + i)},
+		)})
+	}
+	return b.Write(t,
+		wztest.Entry{Name: "Map", Dir: []wztest.Entry{
+			{Name: "100000000.img", Image: b.Properties(
+				wztest.Prop{Name: "info", Value: b.Properties(
+					wztest.Prop{Name: "mapName", Value: "Henesys"},
+					wztest.Prop{Name: "streetName", Value: "Victoria Road"},
+				)},
+				wztest.Prop{Name: "mob", Value: b.Properties(mobs...)},
+			)},
+			{Name: "101000000.img", Image: b.Properties(
+				wztest.Prop{Name: "info", Value: b.Properties(
+					wztest.Prop{Name: "mapName", Value: "Ellinia"},
+					wztest.Prop{Name: "streetName", Value: "Victoria Road"},
+					wztest.Prop{Name: "link", Value: b.UOL("../info/mapName")},
+				)},
+			)},
+		}},
+		wztest.Entry{Name: "String.img", Image: b.Properties(
+			wztest.Prop{Name: "henesys", Value: "HENESYS town"},
+			wztest.Prop{Name: "rate", Value: 1.5},
+		)},
+	)
+}
+
+func build(t *testing.T, name string, opts *wzindex.BuildOptions) []byte {
+	t.Helper()
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := bytes.NewBuffer(nil)
+	if err = wzindex.Build(f, buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBuildDeterministic(t *testing.T) {
+	name := archive(t)
+	first := build(t, name, nil)
+	for i := 0; i < 5; i++ {
+		if !bytes.Equal(build(t, name, nil), first) {
+			t.Fatal("index differs between builds")
+		}
+	}
+}
+
+func paths(hits []*wzindex.Hit) []string {
+	list := make([]string, len(hits))
+	for i, h := range hits {
+		list[i] = h.Path
+	}
+	return list
+}
+
+func TestSearch(t *testing.T) {
+	name := archive(t)
+	var progress []string
+	data := build(t, name, &wzindex.BuildOptions{Progress: func(p string) { progress = append(progress, p) }})
+	if want := []string{"/Map/100000000", "/Map/101000000", "/String"}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress %v, want %v", progress, want)
+	}
+
+	file := filepath.Join(t.TempDir(), "test.idx")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := wzindex.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Root() != "/" {
+		t.Errorf("root %q", ix.Root())
+	}
+
+	for _, c := range []struct {
+		name string
+		q    wzindex.Query
+		want []string
+	}{
+		{"substring", wzindex.Query{Pattern: "esys"},
+			[]string{"/Map/100000000/info/mapName", "/String/henesys"}},
+		{"substring value", wzindex.Query{Pattern: "esys", Fields: wzindex.FieldValue},
+			[]string{"/Map/100000000/info/mapName"}},
+		{"substring ignore case", wzindex.Query{Pattern: "henesys", IgnoreCase: true},
+			[]string{"/Map/100000000/info/mapName", "/String/henesys"}},
+		{"case sensitive", wzindex.Query{Pattern: "HENESYS", Match: wzindex.MatchPrefix},
+			[]string{"/String/henesys"}},
+		{"prefix", wzindex.Query{Pattern: "Victoria", Match: wzindex.MatchPrefix},
+			[]string{"/Map/100000000/info/streetName", "/Map/101000000/info/streetName"}},
+		{"prefix name", wzindex.Query{Pattern: "map", Match: wzindex.MatchPrefix, Fields: wzindex.FieldName, IgnoreCase: true},
+			[]string{"/Map", "/Map/100000000/info/mapName", "/Map/101000000/info/mapName"}},
+		{"exact", wzindex.Query{Pattern: "Ellinia", Match: wzindex.MatchExact},
+			[]string{"/Map/101000000/info/mapName"}},
+		{"exact uol", wzindex.Query{Pattern: "../info/mapName", Match: wzindex.MatchExact, Fields: wzindex.FieldValue},
+			[]string{"/Map/101000000/info/link"}},
+		{"exact number", wzindex.Query{Pattern: "100105", Match: wzindex.MatchExact},
+			[]string{"/Map/100000000/mob/5/id"}},
+		{"regex", wzindex.Query{Pattern: `^1001(0[0-2])$`, Match: wzindex.MatchRegex},
+			[]string{"/Map/100000000/mob/0/id", "/Map/100000000/mob/1/id", "/Map/100000000/mob/2/id"}},
+		{"regex ignore case", wzindex.Query{Pattern: `victoria\s+road`, Match: wzindex.MatchRegex, IgnoreCase: true, Under: "Map/101000000"},
+			[]string{"/Map/101000000/info/streetName"}},
+		{"regex float", wzindex.Query{Pattern: `^1\.5$`, Match: wzindex.MatchRegex},
+			[]string{"/String/rate"}},
+		{"under", wzindex.Query{Pattern: "Road", Under: "/Map/101000000/"},
+			[]string{"/Map/101000000/info/streetName"}},
+		{"path exact", wzindex.Query{Pattern: "/Map/101000000/info", Match: wzindex.MatchExact, Fields: wzindex.FieldPath},
+			[]string{"/Map/101000000/info"}},
+		{"path prefix", wzindex.Query{Pattern: "/Map/100000000/mob/1", Match: wzindex.MatchPrefix, Fields: wzindex.FieldPath, Limit: 3},
+			[]string{"/Map/100000000/mob/1", "/Map/100000000/mob/1/id", "/Map/100000000/mob/10"}},
+		{"path substring", wzindex.Query{Pattern: "info/link", Fields: wzindex.FieldPath},
+			[]string{"/Map/101000000/info/link"}},
+		{"limit", wzindex.Query{Pattern: "id", Match: wzindex.MatchExact, Fields: wzindex.FieldName, Limit: 2},
+			[]string{"/Map/100000000/mob/0/id", "/Map/100000000/mob/1/id"}},
+		{"all fields", wzindex.Query{Pattern: "streetName", Match: wzindex.MatchExact, Fields: wzindex.FieldAll, Under: "Map/100000000"},
+			[]string{"/Map/100000000/info/streetName"}},
+		{"no hits", wzindex.Query{Pattern: "Perion"}, []string{}},
+	} {
+		hits, err := ix.Search(c.q)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got := paths(hits); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	hits, err := ix.Search(wzindex.Query{Pattern: "Ellinia", Match: wzindex.MatchExact})
+	if err != nil || len(hits) != 1 || hits[0].Value != "Ellinia" || hits[0].Type == "" {
+		t.Errorf("hit %+v %v", hits, err)
+	}
+	if _, err = ix.Search(wzindex.Query{Pattern: "x", Under: "Map/missing"}); err != wzindex.ErrNotIndexed {
+		t.Errorf("missing under: %v", err)
+	}
+	if _, err = ix.Search(wzindex.Query{Pattern: "(", Match: wzindex.MatchRegex}); err == nil {
+		t.Error("invalid regex accepted")
+	}
+}
+
+func TestBuildRoot(t *testing.T) {
+	name := archive(t)
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := bytes.NewBuffer(nil)
+	if err = wzindex.Build(f.MustGet("Map/101000000"), buf, &wzindex.BuildOptions{Root: "/Map/101000000"}); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := wzindex.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := ix.Search(wzindex.Query{Pattern: "Ellinia", Match: wzindex.MatchExact})
+	if err != nil || !reflect.DeepEqual(paths(hits), []string{"/Map/101000000/info/mapName"}) {
+		t.Fatalf("%v %v", paths(hits), err)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	name := archive(t)
+	data := build(t, name, nil)
+	for _, n := range []int{0, 4, len(data) / 2, len(data) - 1} {
+		if _, err := wzindex.Read(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("truncated to %d bytes read", n)
+		}
+	}
+}
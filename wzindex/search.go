@@ -0,0 +1,402 @@
+package wzindex
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Match byte
+
+const (
+	MatchSubstring Match = iota
+	MatchPrefix
+	MatchExact
+	MatchRegex
+)
+
+func (m Match) String() string {
+	switch m {
+	case MatchSubstring:
+		return "substring"
+	case MatchPrefix:
+		return "prefix"
+	case MatchExact:
+		return "exact"
+	case MatchRegex:
+		return "regex"
+	}
+	return "unknown"
+}
+
+// Field parts of a node a query matches against, combined with |
+type Field byte
+
+const (
+	FieldName Field = 1 << iota
+	FieldValue
+	// FieldPath the path below the index root starting with /, only exact and prefix
+	// queries narrow the entries scanned
+	FieldPath
+
+	FieldAll = FieldName | FieldValue | FieldPath
+)
+
+type Query struct {
+	Pattern string
+	Match   Match
+	// Fields zero matches names and values
+	Fields     Field
+	IgnoreCase bool
+	// Under limits hits to the subtree of this path below the index root
+	Under string
+	// Limit caps the hits returned, zero returns all
+	Limit int
+}
+
+type Hit struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// pathOf returns the full path of entry id
+func (ix *Index) pathOf(id uint32) string {
+	n := 0
+	for p := id + 1; p > 0; p = ix.parents[p-1] {
+		n++
+	}
+	parts := make([]string, n)
+	for p := id + 1; p > 0; p = ix.parents[p-1] {
+		n--
+		parts[n] = ix.terms.at(ix.entries[p-1].name)
+	}
+	root := ix.root
+	if !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	return root + strings.Join(parts, "/")
+}
+
+// find returns the entry id of path below the root
+func (ix *Index) find(path string) (uint32, bool) {
+	parent := uint32(0)
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		t := ix.terms.search(name)
+		if t == ix.terms.len() || ix.terms.at(uint32(t)) != name {
+			return 0, false
+		}
+		// postings are ascending and children follow their parent
+		ids := ix.names.of(uint32(t))
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] >= parent })
+		for ; i < len(ids) && ix.parents[ids[i]] != parent; i++ {
+			if parent > 0 && ids[i] >= ix.ends[parent-1] {
+				return 0, false
+			}
+		}
+		if i == len(ids) {
+			return 0, false
+		}
+		parent = ids[i] + 1
+	}
+	return parent - 1, parent > 0
+}
+
+// matcher q compiled, patterns of case insensitive non regex queries are lower cased
+// and match against the folded dictionary
+type matcher struct {
+	match   Match
+	pattern string
+	re      *regexp.Regexp
+	// literal every regex match contains, lower cased when fold
+	literal string
+	fold    bool
+}
+
+func (q *Query) matcher() (*matcher, error) {
+	m := &matcher{match: q.Match, pattern: q.Pattern}
+	switch q.Match {
+	case MatchSubstring, MatchPrefix, MatchExact:
+		if q.IgnoreCase {
+			m.pattern = strings.ToLower(m.pattern)
+		}
+	case MatchRegex:
+		pattern := q.Pattern
+		if q.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		m.re = re
+		if sre, err := syntax.Parse(pattern, syntax.Perl); err == nil {
+			m.literal, m.fold = required(sre.Simplify())
+			if m.fold {
+				m.literal = strings.ToLower(m.literal)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown match %d", q.Match)
+	}
+	return m, nil
+}
+
+// required returns the longest literal every match of re contains, fold when it matches
+// case insensitively, empty when there's none
+func required(re *syntax.Regexp) (literal string, fold bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase == 0 {
+			return string(re.Rune), false
+		}
+		return folding(re.Rune), true
+	case syntax.OpCapture, syntax.OpPlus:
+		return required(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return required(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if l, f := required(sub); len(l) > len(literal) {
+				literal, fold = l, f
+			}
+		}
+		return literal, fold
+	}
+	return "", false
+}
+
+// folding returns the longest run of runes whose case variants all lower case alike,
+// the long s folds to s but doesn't lower case to it and can't be found in folded terms
+func folding(runes []rune) string {
+	var longest []rune
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && lowerFolds(runes[i]) {
+			continue
+		}
+		if i-start > len(longest) {
+			longest = runes[start:i]
+		}
+		start = i + 1
+	}
+	return string(longest)
+}
+
+func lowerFolds(r rune) bool {
+	lower := unicode.ToLower(r)
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if unicode.ToLower(f) != lower {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *matcher) bytes(b []byte) bool {
+	switch m.match {
+	case MatchSubstring:
+		return bytes.Contains(b, []byte(m.pattern))
+	case MatchPrefix:
+		return bytes.HasPrefix(b, []byte(m.pattern))
+	case MatchExact:
+		return string(b) == m.pattern
+	}
+	return m.re.Match(b)
+}
+
+func (m *matcher) string(s string) bool {
+	switch m.match {
+	case MatchSubstring:
+		return strings.Contains(s, m.pattern)
+	case MatchPrefix:
+		return strings.HasPrefix(s, m.pattern)
+	case MatchExact:
+		return s == m.pattern
+	}
+	return m.re.MatchString(s)
+}
+
+// fold returns the lower cased dictionary, built on first use
+func (ix *Index) fold() *dictionary {
+	ix.foldOnce.Do(func() {
+		ix.folded = ix.terms.fold()
+	})
+	return &ix.folded
+}
+
+// dictionary returns the terms q matches against
+func (ix *Index) dictionary(q *Query) *dictionary {
+	if q.IgnoreCase && q.Match != MatchRegex {
+		return ix.fold()
+	}
+	return &ix.terms
+}
+
+// matchTerms returns the ids of the matching terms, substring queries scan the dictionary
+// data at once, case sensitive prefix and exact queries binary search it
+func (ix *Index) matchTerms(q *Query, m *matcher) []uint32 {
+	d := ix.dictionary(q)
+	if m.match == MatchSubstring {
+		return d.contains(m.pattern)
+	}
+	if m.literal != "" {
+		// only terms containing the literal can match, checked with the regex
+		candidates := ix.terms.contains(m.literal)
+		if m.fold {
+			candidates = ix.fold().contains(m.literal)
+		}
+		ids := candidates[:0]
+		for _, t := range candidates {
+			if m.re.MatchString(ix.terms.at(t)) {
+				ids = append(ids, t)
+			}
+		}
+		return ids
+	}
+
+	lo, hi := 0, d.len()
+	if d == &ix.terms {
+		prefix := ""
+		switch m.match {
+		case MatchPrefix, MatchExact:
+			prefix = m.pattern
+		case MatchRegex:
+			// only an anchored literal prefix bounds the matches
+			if strings.HasPrefix(q.Pattern, "^") {
+				prefix, _ = m.re.LiteralPrefix()
+			}
+		}
+		if prefix != "" {
+			lo, hi = d.prefixed(prefix)
+		}
+	}
+
+	var ids []uint32
+	for t := lo; t < hi; t++ {
+		if m.string(d.at(uint32(t))) {
+			ids = append(ids, uint32(t))
+		}
+	}
+	return ids
+}
+
+// matchPaths returns the entries in lo to hi whose path below the root matches, exact
+// and prefix queries only scan the subtree their pattern names
+func (ix *Index) matchPaths(q *Query, m *matcher, lo, hi uint32) []uint32 {
+	if dir := q.Pattern[:strings.LastIndex(q.Pattern, "/")+1]; !q.IgnoreCase && strings.Trim(dir, "/") != "" &&
+		(q.Match == MatchExact || q.Match == MatchPrefix) {
+		id, ok := ix.find(dir)
+		if !ok {
+			return nil
+		}
+		if id+1 > lo {
+			lo = id + 1
+		}
+		if ix.ends[id] < hi {
+			hi = ix.ends[id]
+		}
+	}
+	if lo >= hi {
+		return nil
+	}
+	d := ix.dictionary(q)
+
+	// seed the path of the parent of lo, then build each path from its parent's,
+	// depth first order keeps every ancestor of an entry on the stack
+	parents, lens := []uint32{0}, []int{0}
+	var buf []byte
+	var ancestors []uint32
+	for p := ix.parents[lo]; p > 0; p = ix.parents[p-1] {
+		ancestors = append(ancestors, p)
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		buf = append(append(buf, '/'), d.at(ix.entries[ancestors[i]-1].name)...)
+		parents, lens = append(parents, ancestors[i]), append(lens, len(buf))
+	}
+
+	var ids []uint32
+	for i := lo; i < hi; i++ {
+		for parents[len(parents)-1] != ix.parents[i] {
+			parents, lens = parents[:len(parents)-1], lens[:len(lens)-1]
+		}
+		buf = append(append(buf[:lens[len(lens)-1]], '/'), d.at(ix.entries[i].name)...)
+		parents, lens = append(parents, i+1), append(lens, len(buf))
+		if m.bytes(buf) {
+			ids = append(ids, i)
+		}
+	}
+	return ids
+}
+
+// Search returns the nodes matching q in depth first order
+func (ix *Index) Search(q Query) ([]*Hit, error) {
+	m, err := q.matcher()
+	if err != nil {
+		return nil, err
+	}
+	if q.Fields == 0 {
+		q.Fields = FieldName | FieldValue
+	}
+
+	lo, hi := uint32(0), uint32(len(ix.entries))
+	if strings.Trim(q.Under, "/") != "" {
+		id, ok := ix.find(q.Under)
+		if !ok {
+			return nil, ErrNotIndexed
+		}
+		lo, hi = id+1, ix.ends[id]
+	}
+
+	var ids []uint32
+	add := func(matched []uint32) {
+		// postings are ascending, skip straight to the range
+		i := sort.Search(len(matched), func(i int) bool { return matched[i] >= lo })
+		for ; i < len(matched) && matched[i] < hi; i++ {
+			ids = append(ids, matched[i])
+		}
+	}
+	if q.Fields&(FieldName|FieldValue) != 0 {
+		for _, t := range ix.matchTerms(&q, m) {
+			if q.Fields&FieldName != 0 {
+				add(ix.names.of(t))
+			}
+			if q.Fields&FieldValue != 0 {
+				add(ix.values.of(t))
+			}
+		}
+	}
+	if q.Fields&FieldPath != 0 {
+		add(ix.matchPaths(&q, m, lo, hi))
+	}
+
+	// a node can match by name, value and path
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	n := 0
+	for i, id := range ids {
+		if i == 0 || id != ids[n-1] {
+			ids[n] = id
+			n++
+		}
+	}
+	ids = ids[:n]
+	if q.Limit > 0 && len(ids) > q.Limit {
+		ids = ids[:q.Limit]
+	}
+
+	hits := make([]*Hit, len(ids))
+	for i, id := range ids {
+		e := &ix.entries[id]
+		hits[i] = &Hit{Path: ix.pathOf(id), Type: e.typ.String()}
+		if e.value > 0 {
+			hits[i].Value = ix.terms.at(e.value - 1)
+		}
+	}
+	return hits, nil
+}
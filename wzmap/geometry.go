@@ -0,0 +1,253 @@
+package wzmap
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wzvalue"
+	"image"
+	"sort"
+	"strconv"
+)
+
+// NoTargetMap portal target map value of portals not leading anywhere
+const NoTargetMap = 999999999
+
+type Foothold struct {
+	ID, Layer, Group int
+	X1, Y1, X2, Y2   int
+	Prev, Next       int
+	Piece            int
+	Force            int
+	CantThrough      bool
+	ForbidFallDown   bool
+	// PrevFoothold NextFoothold resolved Prev and Next links, nil if missing
+	PrevFoothold *Foothold
+	NextFoothold *Foothold
+}
+
+// Wall vertical segment
+func (f *Foothold) Wall() bool {
+	return f.X1 == f.X2
+}
+
+type Ladder struct {
+	ID int
+	// Ladder true for ladder false for rope
+	Ladder bool
+	// UpperFoothold climbing to the top reaches a foothold
+	UpperFoothold bool
+	X, Y1, Y2     int
+	Page          int
+}
+
+type Portal struct {
+	ID         int
+	Name       string
+	Type       int
+	X, Y       int
+	TargetMap  int
+	TargetName string
+	Script     string
+}
+
+// HasTarget portal leads to another map
+func (p *Portal) HasTarget() bool {
+	return p.TargetMap != NoTargetMap && p.TargetMap >= 0
+}
+
+type Life struct {
+	ID int
+	// Type "m" mob "n" npc
+	Type     string
+	LifeID   string
+	X, Y, Cy int
+	Foothold int
+	RX0, RX1 int
+	MobTime  int
+	Flip     bool
+	Hide     bool
+}
+
+type MapGeometry struct {
+	// Bounds view range from info/VR*, falls back to the foothold extents
+	Bounds     image.Rectangle
+	Footholds  []*Foothold
+	Ladders    []*Ladder
+	Portals    []*Portal
+	Life       []*Life
+	footholdID map[int]*Foothold
+}
+
+// Foothold returns foothold by id, nil if not exists
+func (g *MapGeometry) Foothold(id int) *Foothold {
+	return g.footholdID[id]
+}
+
+// Portal returns portal by name, nil if not exists
+func (g *MapGeometry) Portal(name string) *Portal {
+	for _, p := range g.Portals {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Geometry loads the geometry of map id
+func (r *Renderer) Geometry(id int) (*MapGeometry, error) {
+	m, err := r.Map(id)
+	if err != nil {
+		return nil, err
+	}
+	return LoadGeometry(m)
+}
+
+// LoadGeometry parse foothold ladderRope portal life and bounds of map image m
+func LoadGeometry(m wzexplorer.Object) (*MapGeometry, error) {
+	g := &MapGeometry{footholdID: make(map[int]*Foothold)}
+
+	if err := g.loadFootholds(m); err != nil {
+		return nil, err
+	}
+	if err := g.loadLadders(m); err != nil {
+		return nil, err
+	}
+	if err := g.loadPortals(m); err != nil {
+		return nil, err
+	}
+	if err := g.loadLife(m); err != nil {
+		return nil, err
+	}
+
+	g.Bounds = Bounds(m)
+	if g.Bounds.Empty() {
+		for _, f := range g.Footholds {
+			g.Bounds = g.Bounds.Union(image.Rect(f.X1, f.Y1, f.X2, f.Y2).Canon().Inset(-1))
+		}
+	}
+	return g, nil
+}
+
+func eachIndex(o wzexplorer.Object, name string, cb func(int, wzexplorer.Object) error) error {
+	node, err := o.Get(name)
+	if err != nil || node == nil {
+		return err
+	}
+	return node.Each(func(key string, child wzexplorer.Object) error {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			// skip non index children
+			return nil
+		}
+		return cb(id, child)
+	})
+}
+
+func (g *MapGeometry) loadFootholds(m wzexplorer.Object) error {
+	err := eachIndex(m, "foothold", func(layer int, l wzexplorer.Object) error {
+		return l.Each(func(key string, group wzexplorer.Object) error {
+			gid, err := strconv.Atoi(key)
+			if err != nil {
+				return nil
+			}
+			return group.Each(func(key string, fh wzexplorer.Object) error {
+				id, err := strconv.Atoi(key)
+				if err != nil {
+					return nil
+				}
+				f := &Foothold{
+					ID:             id,
+					Layer:          layer,
+					Group:          gid,
+					X1:             wzvalue.ChildInt(fh, "x1", 0),
+					Y1:             wzvalue.ChildInt(fh, "y1", 0),
+					X2:             wzvalue.ChildInt(fh, "x2", 0),
+					Y2:             wzvalue.ChildInt(fh, "y2", 0),
+					Prev:           wzvalue.ChildInt(fh, "prev", 0),
+					Next:           wzvalue.ChildInt(fh, "next", 0),
+					Piece:          wzvalue.ChildInt(fh, "piece", 0),
+					Force:          wzvalue.ChildInt(fh, "force", 0),
+					CantThrough:    wzvalue.ChildInt(fh, "cantThrough", 0) != 0,
+					ForbidFallDown: wzvalue.ChildInt(fh, "forbidFallDown", 0) != 0,
+				}
+				g.Footholds = append(g.Footholds, f)
+				g.footholdID[id] = f
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(g.Footholds, func(i, j int) bool {
+		return g.Footholds[i].ID < g.Footholds[j].ID
+	})
+	for _, f := range g.Footholds {
+		f.PrevFoothold = g.footholdID[f.Prev]
+		f.NextFoothold = g.footholdID[f.Next]
+	}
+	return nil
+}
+
+func (g *MapGeometry) loadLadders(m wzexplorer.Object) error {
+	err := eachIndex(m, "ladderRope", func(id int, o wzexplorer.Object) error {
+		g.Ladders = append(g.Ladders, &Ladder{
+			ID:            id,
+			Ladder:        wzvalue.ChildInt(o, "l", 0) != 0,
+			UpperFoothold: wzvalue.ChildInt(o, "uf", 0) != 0,
+			X:             wzvalue.ChildInt(o, "x", 0),
+			Y1:            wzvalue.ChildInt(o, "y1", 0),
+			Y2:            wzvalue.ChildInt(o, "y2", 0),
+			Page:          wzvalue.ChildInt(o, "page", 0),
+		})
+		return nil
+	})
+	sort.Slice(g.Ladders, func(i, j int) bool {
+		return g.Ladders[i].ID < g.Ladders[j].ID
+	})
+	return err
+}
+
+func (g *MapGeometry) loadPortals(m wzexplorer.Object) error {
+	err := eachIndex(m, "portal", func(id int, o wzexplorer.Object) error {
+		g.Portals = append(g.Portals, &Portal{
+			ID:         id,
+			Name:       wzvalue.ChildString(o, "pn"),
+			Type:       wzvalue.ChildInt(o, "pt", 0),
+			X:          wzvalue.ChildInt(o, "x", 0),
+			Y:          wzvalue.ChildInt(o, "y", 0),
+			TargetMap:  wzvalue.ChildInt(o, "tm", NoTargetMap),
+			TargetName: wzvalue.ChildString(o, "tn"),
+			Script:     wzvalue.ChildString(o, "script"),
+		})
+		return nil
+	})
+	sort.Slice(g.Portals, func(i, j int) bool {
+		return g.Portals[i].ID < g.Portals[j].ID
+	})
+	return err
+}
+
+func (g *MapGeometry) loadLife(m wzexplorer.Object) error {
+	err := eachIndex(m, "life", func(id int, o wzexplorer.Object) error {
+		g.Life = append(g.Life, &Life{
+			ID:       id,
+			Type:     wzvalue.ChildString(o, "type"),
+			LifeID:   wzvalue.ChildString(o, "id"),
+			X:        wzvalue.ChildInt(o, "x", 0),
+			Y:        wzvalue.ChildInt(o, "y", 0),
+			Cy:       wzvalue.ChildInt(o, "cy", 0),
+			Foothold: wzvalue.ChildInt(o, "fh", 0),
+			RX0:      wzvalue.ChildInt(o, "rx0", 0),
+			RX1:      wzvalue.ChildInt(o, "rx1", 0),
+			MobTime:  wzvalue.ChildInt(o, "mobTime", 0),
+			Flip:     wzvalue.ChildInt(o, "f", 0) != 0,
+			Hide:     wzvalue.ChildInt(o, "hide", 0) != 0,
+		})
+		return nil
+	})
+	sort.Slice(g.Life, func(i, j int) bool {
+		return g.Life[i].ID < g.Life[j].ID
+	})
+	return err
+}
@@ -0,0 +1,350 @@
+package wzmap
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrNoPath = errors.New("no path between maps")
+
+type Edge struct {
+	From, To int
+	Portal   *Portal
+}
+
+type BrokenReason int
+
+const (
+	// BrokenMissingMap target map doesn't exist
+	BrokenMissingMap BrokenReason = iota + 1
+	// BrokenMissingPortal target portal name doesn't exist in target map
+	BrokenMissingPortal
+)
+
+func (r BrokenReason) String() string {
+	switch r {
+	case BrokenMissingMap:
+		return "missing map"
+	case BrokenMissingPortal:
+		return "missing portal"
+	}
+	return "unknown"
+}
+
+type BrokenPortal struct {
+	Edge
+	Reason BrokenReason
+}
+
+// Graph directed portal graph of every map
+type Graph struct {
+	portals map[int][]*Portal
+	edges   map[int][]Edge
+	// ids in ascending order, AddMap inserts in place
+	ids []int
+}
+
+// BuildGraph walks Map/Map*/ of Map.wz root and collects portals of every map
+func BuildGraph(root wzexplorer.GetObject) (*Graph, error) {
+	maps, err := root.Get("Map")
+	if err != nil {
+		return nil, err
+	}
+	if maps == nil {
+		return nil, ErrMapNotFound
+	}
+
+	g := &Graph{
+		portals: make(map[int][]*Portal),
+		edges:   make(map[int][]Edge),
+	}
+
+	if err = maps.Each(func(name string, dir wzexplorer.Object) error {
+		if dir.Type() != wzexplorer.ObjectTypeDirectory || !strings.HasPrefix(name, "Map") {
+			return nil
+		}
+		return dir.Each(func(name string, m wzexplorer.Object) error {
+			id, err := strconv.Atoi(name)
+			if err != nil {
+				return nil
+			}
+			return g.AddMap(id, m)
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// AddMap adds map image m of id and its portals to the graph
+func (g *Graph) AddMap(id int, m wzexplorer.Object) error {
+	mg := &MapGeometry{}
+	if err := mg.loadPortals(m); err != nil {
+		return err
+	}
+	if _, ok := g.portals[id]; !ok {
+		i := sort.SearchInts(g.ids, id)
+		g.ids = append(g.ids, 0)
+		copy(g.ids[i+1:], g.ids[i:])
+		g.ids[i] = id
+	}
+	g.portals[id] = mg.Portals
+	var edges []Edge
+	for _, p := range mg.Portals {
+		if p.HasTarget() {
+			edges = append(edges, Edge{From: id, To: p.TargetMap, Portal: p})
+		}
+	}
+	g.edges[id] = edges
+	return nil
+}
+
+// Maps returns a copy of every map id in ascending order
+func (g *Graph) Maps() []int {
+	return append([]int(nil), g.ids...)
+}
+
+// missing returns the target maps of portals that aren't in the graph in ascending order
+func (g *Graph) missing() []int {
+	seen := make(map[int]bool)
+	var ids []int
+	for _, id := range g.ids {
+		for _, e := range g.edges[id] {
+			if !g.Has(e.To) && !seen[e.To] {
+				seen[e.To] = true
+				ids = append(ids, e.To)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Has map exists in graph
+func (g *Graph) Has(id int) bool {
+	_, ok := g.portals[id]
+	return ok
+}
+
+// Portals returns the portals of map id
+func (g *Graph) Portals(id int) []*Portal {
+	return g.portals[id]
+}
+
+// Edges returns portals of map id leading to other maps
+func (g *Graph) Edges(id int) []Edge {
+	return g.edges[id]
+}
+
+// ShortestPath returns the fewest portals from map to map
+func (g *Graph) ShortestPath(from, to int) ([]Edge, error) {
+	if !g.Has(from) || !g.Has(to) {
+		return nil, ErrMapNotFound
+	}
+	if from == to {
+		return []Edge{}, nil
+	}
+
+	prev := map[int]Edge{from: {}}
+	queue := []int{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, e := range g.edges[cur] {
+			if _, ok := prev[e.To]; ok || !g.Has(e.To) {
+				continue
+			}
+			prev[e.To] = e
+			if e.To == to {
+				var path []Edge
+				for n := to; n != from; n = prev[n].From {
+					path = append(path, prev[n])
+				}
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path, nil
+			}
+			queue = append(queue, e.To)
+		}
+	}
+	return nil, ErrNoPath
+}
+
+// Reachable returns every map reachable from map id including itself
+func (g *Graph) Reachable(id int) []int {
+	if !g.Has(id) {
+		return nil
+	}
+	seen := map[int]bool{id: true}
+	queue := []int{id}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, e := range g.edges[cur] {
+			if seen[e.To] || !g.Has(e.To) {
+				continue
+			}
+			seen[e.To] = true
+			queue = append(queue, e.To)
+		}
+	}
+	reachable := make([]int, 0, len(seen))
+	for k := range seen {
+		reachable = append(reachable, k)
+	}
+	sort.Ints(reachable)
+	return reachable
+}
+
+// Unreachable returns every map that can't be reached from map id
+func (g *Graph) Unreachable(id int) []int {
+	seen := make(map[int]bool)
+	for _, k := range g.Reachable(id) {
+		seen[k] = true
+	}
+	var unreachable []int
+	for _, k := range g.ids {
+		if !seen[k] {
+			unreachable = append(unreachable, k)
+		}
+	}
+	return unreachable
+}
+
+// Broken returns portals with a target map or target portal name that doesn't exist
+func (g *Graph) Broken() []BrokenPortal {
+	var broken []BrokenPortal
+	for _, id := range g.ids {
+		for _, e := range g.edges[id] {
+			if !g.Has(e.To) {
+				broken = append(broken, BrokenPortal{Edge: e, Reason: BrokenMissingMap})
+				continue
+			}
+			if e.Portal.TargetName == "" {
+				continue
+			}
+			found := false
+			for _, p := range g.portals[e.To] {
+				if p.Name == e.Portal.TargetName {
+					found = true
+					break
+				}
+			}
+			if !found {
+				broken = append(broken, BrokenPortal{Edge: e, Reason: BrokenMissingPortal})
+			}
+		}
+	}
+	return broken
+}
+
+// WriteDOT exports the graph in graphviz dot format, targets of broken portals are dashed
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph maps {")
+	for _, id := range g.ids {
+		fmt.Fprintf(bw, "\t\"%d\";\n", id)
+	}
+	for _, id := range g.missing() {
+		fmt.Fprintf(bw, "\t\"%d\" [style=dashed];\n", id)
+	}
+	for _, id := range g.ids {
+		for _, e := range g.edges[id] {
+			fmt.Fprintf(bw, "\t\"%d\" -> \"%d\" [label=%s];\n",
+				e.From, e.To, strconv.Quote(e.Portal.Name+" -> "+e.Portal.TargetName))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+// WriteGraphML exports the graph in GraphML format, targets of broken portals are nodes marked missing
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "pn", For: "edge", Name: "portal", Type: "string"},
+			{ID: "tn", For: "edge", Name: "target", Type: "string"},
+			{ID: "pt", For: "edge", Name: "type", Type: "int"},
+			{ID: "mm", For: "node", Name: "missing", Type: "boolean"},
+		},
+		Graph: graphMLGraph{ID: "maps", EdgeDefault: "directed"},
+	}
+	for _, id := range g.ids {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: strconv.Itoa(id)})
+	}
+	for _, id := range g.missing() {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID:   strconv.Itoa(id),
+			Data: []graphMLData{{Key: "mm", Value: "true"}},
+		})
+	}
+	for _, id := range g.ids {
+		for _, e := range g.edges[id] {
+			doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+				Source: strconv.Itoa(e.From),
+				Target: strconv.Itoa(e.To),
+				Data: []graphMLData{
+					{Key: "pn", Value: e.Portal.Name},
+					{Key: "tn", Value: e.Portal.TargetName},
+					{Key: "pt", Value: strconv.Itoa(e.Portal.Type)},
+				},
+			})
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
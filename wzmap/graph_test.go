@@ -0,0 +1,122 @@
+package wzmap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func portal(b *wztest.Builder, name string, target int32, targetName string) wztest.Object {
+	return b.Properties(
+		wztest.Prop{Name: "pn", Value: name},
+		wztest.Prop{Name: "pt", Value: int32(2)},
+		wztest.Prop{Name: "tm", Value: target},
+		wztest.Prop{Name: "tn", Value: targetName},
+	)
+}
+
+func mapImage(b *wztest.Builder, portals ...wztest.Object) wztest.Object {
+	var ps []wztest.Prop
+	for i, p := range portals {
+		ps = append(ps, wztest.Prop{Name: string(rune('0' + i)), Value: p})
+	}
+	return b.Properties(wztest.Prop{Name: "portal", Value: b.Properties(ps...)})
+}
+
+func testGraph(t *testing.T) *Graph {
+	b := wztest.New(wzexplorer.IvEmpty)
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, b.Write(t, wztest.Entry{Name: "Map", Dir: []wztest.Entry{
+		{Name: "Map0", Dir: []wztest.Entry{
+			{Name: "300.img", Image: mapImage(b)},
+			{Name: "200.img", Image: mapImage(b, portal(b, "out", 999, "in"), portal(b, "back", 100, "east"))},
+			{Name: "100.img", Image: mapImage(b, portal(b, "east", 200, "back"), portal(b, "sp", NoTargetMap, ""))},
+		}},
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	g, err := BuildGraph(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	g := testGraph(t)
+	if got := g.Maps(); !reflect.DeepEqual(got, []int{100, 200, 300}) {
+		t.Fatalf("Maps() = %v", got)
+	}
+	path, err := g.ShortestPath(100, 200)
+	if err != nil || len(path) != 1 || path[0].Portal.Name != "east" {
+		t.Fatalf("ShortestPath(100, 200) = %v, %v", path, err)
+	}
+	if _, err = g.ShortestPath(100, 300); err != ErrNoPath {
+		t.Errorf("ShortestPath(100, 300) error %v, want ErrNoPath", err)
+	}
+	broken := g.Broken()
+	if len(broken) != 1 || broken[0].To != 999 || broken[0].Reason != BrokenMissingMap {
+		t.Errorf("Broken() = %v", broken)
+	}
+}
+
+func TestGraphMapsCopy(t *testing.T) {
+	g := testGraph(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = g.Maps()
+		}()
+	}
+	wg.Wait()
+
+	g.Maps()[0] = 0
+	if got := g.Maps(); !reflect.DeepEqual(got, []int{100, 200, 300}) {
+		t.Errorf("Maps() = %v after changing a returned slice", got)
+	}
+}
+
+func TestWriteDOTDeclaresMissingTargets(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testGraph(t).WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\t\"999\" [style=dashed];\n") {
+		t.Errorf("missing target not declared:\n%s", buf.String())
+	}
+}
+
+func TestWriteGraphMLDeclaresEveryEndpoint(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testGraph(t).WriteGraphML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphML
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[string]bool)
+	for _, n := range doc.Graph.Nodes {
+		nodes[n.ID] = true
+	}
+	for _, e := range doc.Graph.Edges {
+		if !nodes[e.Source] || !nodes[e.Target] {
+			t.Errorf("edge %s -> %s has an undeclared endpoint", e.Source, e.Target)
+		}
+	}
+	if len(doc.Graph.Nodes) != 4 || len(doc.Graph.Edges) != 3 {
+		t.Errorf("%d nodes %d edges, want 4 and 3", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+}
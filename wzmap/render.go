@@ -0,0 +1,401 @@
+package wzmap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wzvalue"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"strconv"
+)
+
+// LayerCount number of tile/object layers in a map image
+const LayerCount = 8
+
+var ErrMapNotFound = errors.New("map not found")
+
+type Options struct {
+	// Bounds overrides the viewport, empty means info/VR* or the union of all sprites
+	Bounds image.Rectangle
+	NoBack bool
+	NoTile bool
+	NoObj  bool
+}
+
+// Renderer composes map images out of Map.wz
+type Renderer struct {
+	root wzexplorer.GetObject
+}
+
+// NewRenderer root must point to Map.wz, e.g. archive.Get("/Map") or NewFile(cp, "Map.wz")
+func NewRenderer(root wzexplorer.GetObject) *Renderer {
+	return &Renderer{root: root}
+}
+
+// MapPath returns the Map.wz relative path of map id
+func MapPath(id int) string {
+	return fmt.Sprintf("Map/Map%d/%09d", id/100000000, id)
+}
+
+// Map returns the map image of id
+func (r *Renderer) Map(id int) (wzexplorer.Object, error) {
+	m, err := r.root.Get(MapPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrMapNotFound
+	}
+	return m, nil
+}
+
+// Render composes map id, the returned image bounds are in map coordinates
+func (r *Renderer) Render(id int, opts *Options) (*image.NRGBA, error) {
+	m, err := r.Map(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.RenderObject(m, opts)
+}
+
+type sprite struct {
+	img    image.Image
+	pos    image.Point
+	flip   bool
+	alpha  uint8
+	tileX  bool
+	tileY  bool
+	step   image.Point
+	z, zM  int
+	index  int
+	bounds image.Rectangle
+}
+
+func (r *Renderer) canvas(path string) (wzexplorer.Canvas, error) {
+	o, err := r.root.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, nil
+	}
+	if o.Type() != wzexplorer.ObjectTypeCanvas {
+		// animated sprite use first frame
+		if o, err = o.Get("0"); err != nil || o == nil {
+			return nil, err
+		}
+	}
+	return o.Canvas(), nil
+}
+
+func newSprite(c wzexplorer.Canvas, x, y int, flip bool) (*sprite, error) {
+	img, err := c.Image()
+	if err != nil {
+		return nil, err
+	}
+	origin := wzvalue.ChildVector(c, "origin")
+	size := img.Bounds().Size()
+	s := &sprite{img: img, flip: flip, alpha: 0xff}
+	if flip {
+		s.pos = image.Pt(x-(size.X-origin.X), y-origin.Y)
+	} else {
+		s.pos = image.Pt(x-origin.X, y-origin.Y)
+	}
+	s.bounds = image.Rectangle{Min: s.pos, Max: s.pos.Add(size)}
+	return s, nil
+}
+
+func (r *Renderer) backs(m wzexplorer.Object) (back, front []*sprite, err error) {
+	node, err := m.Get("back")
+	if err != nil || node == nil {
+		return
+	}
+	items, err := node.Array()
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(items); i++ {
+		b := items[i]
+		bS := wzvalue.ChildString(b, "bS")
+		if bS == "" {
+			continue
+		}
+		no := strconv.Itoa(wzvalue.ChildInt(b, "no", 0))
+		var path string
+		switch wzvalue.ChildInt(b, "ani", 0) {
+		case 0:
+			path = "Back/" + bS + "/back/" + no
+		case 1:
+			path = "Back/" + bS + "/ani/" + no
+		default:
+			// spine animation not supported
+			continue
+		}
+		var c wzexplorer.Canvas
+		if c, err = r.canvas(path); err != nil {
+			return
+		} else if c == nil {
+			continue
+		}
+		var s *sprite
+		if s, err = newSprite(c, wzvalue.ChildInt(b, "x", 0), wzvalue.ChildInt(b, "y", 0), wzvalue.ChildInt(b, "f", 0) != 0); err != nil {
+			return
+		}
+		s.alpha = uint8(wzvalue.ChildInt(b, "a", 0xff))
+		s.index = i
+		size := s.bounds.Size()
+		s.step = image.Pt(wzvalue.ChildInt(b, "cx", 0), wzvalue.ChildInt(b, "cy", 0))
+		if s.step.X <= 0 {
+			s.step.X = size.X
+		}
+		if s.step.Y <= 0 {
+			s.step.Y = size.Y
+		}
+		// 1-3 tiled, 4-7 scrolling variants of the same tiling
+		switch wzvalue.ChildInt(b, "type", 0) {
+		case 1, 4:
+			s.tileX = true
+		case 2, 5:
+			s.tileY = true
+		case 3, 6, 7:
+			s.tileX, s.tileY = true, true
+		}
+		if wzvalue.ChildInt(b, "front", 0) != 0 {
+			front = append(front, s)
+		} else {
+			back = append(back, s)
+		}
+	}
+	return
+}
+
+func (r *Renderer) layer(m wzexplorer.Object, layer int, opts *Options) (sprites []*sprite, err error) {
+	l, err := m.Get(strconv.Itoa(layer))
+	if err != nil || l == nil {
+		return
+	}
+
+	if !opts.NoObj {
+		var objs []*sprite
+		if objs, err = r.layerObjs(l); err != nil {
+			return
+		}
+		sprites = append(sprites, objs...)
+	}
+
+	if !opts.NoTile {
+		var tiles []*sprite
+		if tiles, err = r.layerTiles(l); err != nil {
+			return
+		}
+		sprites = append(sprites, tiles...)
+	}
+	return
+}
+
+func (r *Renderer) layerObjs(l wzexplorer.Object) (sprites []*sprite, err error) {
+	node, err := l.Get("obj")
+	if err != nil || node == nil {
+		return
+	}
+	items, err := node.Array()
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(items); i++ {
+		o := items[i]
+		path := "Obj/" + wzvalue.ChildString(o, "oS") + "/" + wzvalue.ChildString(o, "l0") + "/" +
+			wzvalue.ChildString(o, "l1") + "/" + wzvalue.ChildString(o, "l2")
+		var c wzexplorer.Canvas
+		if c, err = r.canvas(path); err != nil {
+			return
+		} else if c == nil {
+			continue
+		}
+		var s *sprite
+		if s, err = newSprite(c, wzvalue.ChildInt(o, "x", 0), wzvalue.ChildInt(o, "y", 0), wzvalue.ChildInt(o, "f", 0) != 0); err != nil {
+			return
+		}
+		s.z = wzvalue.ChildInt(o, "z", 0)
+		s.zM = wzvalue.ChildInt(o, "zM", 0)
+		s.index = i
+		sprites = append(sprites, s)
+	}
+	sortSprites(sprites)
+	return
+}
+
+func (r *Renderer) layerTiles(l wzexplorer.Object) (sprites []*sprite, err error) {
+	tS := wzvalue.ChildString(l, "info/tS")
+	if tS == "" {
+		return
+	}
+	node, err := l.Get("tile")
+	if err != nil || node == nil {
+		return
+	}
+	items, err := node.Array()
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(items); i++ {
+		t := items[i]
+		path := "Tile/" + tS + "/" + wzvalue.ChildString(t, "u") + "/" + strconv.Itoa(wzvalue.ChildInt(t, "no", 0))
+		var c wzexplorer.Canvas
+		if c, err = r.canvas(path); err != nil {
+			return
+		} else if c == nil {
+			continue
+		}
+		var s *sprite
+		if s, err = newSprite(c, wzvalue.ChildInt(t, "x", 0), wzvalue.ChildInt(t, "y", 0), false); err != nil {
+			return
+		}
+		s.z = wzvalue.ChildInt(c, "z", 0)
+		s.zM = wzvalue.ChildInt(t, "zM", 0)
+		s.index = i
+		sprites = append(sprites, s)
+	}
+	sortSprites(sprites)
+	return
+}
+
+func sortSprites(sprites []*sprite) {
+	sort.SliceStable(sprites, func(i, j int) bool {
+		a, b := sprites[i], sprites[j]
+		if a.z != b.z {
+			return a.z < b.z
+		}
+		if a.zM != b.zM {
+			return a.zM < b.zM
+		}
+		return a.index < b.index
+	})
+}
+
+// Bounds returns the view range declared in info, empty if map doesn't declare one
+func Bounds(m wzexplorer.Object) image.Rectangle {
+	info, err := m.Get("info")
+	if err != nil || info == nil {
+		return image.Rectangle{}
+	}
+	return image.Rect(
+		wzvalue.ChildInt(info, "VRLeft", 0), wzvalue.ChildInt(info, "VRTop", 0),
+		wzvalue.ChildInt(info, "VRRight", 0), wzvalue.ChildInt(info, "VRBottom", 0),
+	)
+}
+
+// RenderObject composes map image m, the returned image bounds are in map coordinates
+func (r *Renderer) RenderObject(m wzexplorer.Object, opts *Options) (*image.NRGBA, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var back, front, layers []*sprite
+	if !opts.NoBack {
+		var err error
+		if back, front, err = r.backs(m); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < LayerCount; i++ {
+		l, err := r.layer(m, i, opts)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l...)
+	}
+
+	bounds := opts.Bounds
+	if bounds.Empty() {
+		bounds = Bounds(m)
+	}
+	if bounds.Empty() {
+		for _, s := range layers {
+			bounds = bounds.Union(s.bounds)
+		}
+		for _, sprites := range [][]*sprite{back, front} {
+			for _, s := range sprites {
+				if !s.tileX && !s.tileY {
+					bounds = bounds.Union(s.bounds)
+				}
+			}
+		}
+	}
+	if bounds.Empty() {
+		return nil, errors.New("empty map bounds")
+	}
+
+	dst := image.NewNRGBA(bounds)
+	for _, s := range back {
+		s.draw(dst)
+	}
+	for _, s := range layers {
+		s.draw(dst)
+	}
+	for _, s := range front {
+		s.draw(dst)
+	}
+	return dst, nil
+}
+
+func flipImage(img image.Image) image.Image {
+	b := img.Bounds()
+	flipped := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			flipped.Set(b.Max.X-1-x, y-b.Min.Y, img.At(x, y))
+		}
+	}
+	return flipped
+}
+
+func (s *sprite) draw(dst draw.Image) {
+	img := s.img
+	if s.flip {
+		img = flipImage(img)
+	}
+	var mask image.Image
+	if s.alpha != 0xff {
+		mask = image.NewUniform(color.Alpha{A: s.alpha})
+	}
+
+	size := s.bounds.Size()
+	area := dst.Bounds()
+
+	xs, ys := []int{s.pos.X}, []int{s.pos.Y}
+	if s.tileX {
+		xs = tileOffsets(s.pos.X, s.step.X, size.X, area.Min.X, area.Max.X)
+	}
+	if s.tileY {
+		ys = tileOffsets(s.pos.Y, s.step.Y, size.Y, area.Min.Y, area.Max.Y)
+	}
+
+	for _, y := range ys {
+		for _, x := range xs {
+			r := image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(size)}
+			if !r.Overlaps(area) {
+				continue
+			}
+			draw.DrawMask(dst, r, img, img.Bounds().Min, mask, image.Point{}, draw.Over)
+		}
+	}
+}
+
+func tileOffsets(pos, step, size, min, max int) []int {
+	if step <= 0 {
+		return []int{pos}
+	}
+	start := pos
+	for start+size > min {
+		start -= step
+	}
+	var offsets []int
+	for x := start; x < max; x += step {
+		offsets = append(offsets, x)
+	}
+	return offsets
+}
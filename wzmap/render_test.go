@@ -0,0 +1,155 @@
+package wzmap
+
+import (
+	"github.com/anonymous5l/wzexplorer"
+	"github.com/anonymous5l/wzexplorer/internal/wztest"
+	"image"
+	"image/color"
+	"testing"
+)
+
+var (
+	blue    = color.NRGBA{B: 0xff, A: 0xff}
+	red     = color.NRGBA{R: 0xff, A: 0xff}
+	green   = color.NRGBA{G: 0xff, A: 0xff}
+	yellow  = color.NRGBA{R: 0xff, G: 0xff, A: 0xff}
+	white   = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	black   = color.NRGBA{A: 0xff}
+	magenta = color.NRGBA{R: 0xff, B: 0xff, A: 0xff}
+)
+
+// solid encodes a BGRA8888 canvas of a single colour
+func solid(b *wztest.Builder, w, h int32, c color.NRGBA, ps ...wztest.Prop) wztest.Object {
+	pixels := make([]byte, 0, w*h*4)
+	for i := int32(0); i < w*h; i++ {
+		pixels = append(pixels, c.B, c.G, c.R, c.A)
+	}
+	return b.Canvas(w, h, int32(wzexplorer.CanvasFormatBGRA8888), pixels, ps...)
+}
+
+func list(b *wztest.Builder, items ...wztest.Object) wztest.Object {
+	var ps []wztest.Prop
+	for i, item := range items {
+		ps = append(ps, wztest.Prop{Name: string(rune('0' + i)), Value: item})
+	}
+	return b.Properties(ps...)
+}
+
+func obj(b *wztest.Builder, l2 string, x, y, z int32) wztest.Object {
+	return b.Properties(
+		wztest.Prop{Name: "oS", Value: "o"},
+		wztest.Prop{Name: "l0", Value: "a"},
+		wztest.Prop{Name: "l1", Value: "b"},
+		wztest.Prop{Name: "l2", Value: l2},
+		wztest.Prop{Name: "x", Value: x},
+		wztest.Prop{Name: "y", Value: y},
+		wztest.Prop{Name: "z", Value: z},
+	)
+}
+
+func testRenderer(t *testing.T) *Renderer {
+	b := wztest.New(wzexplorer.IvEmpty)
+	m := b.Properties(
+		wztest.Prop{Name: "back", Value: list(b,
+			b.Properties(wztest.Prop{Name: "bS", Value: "b"}, wztest.Prop{Name: "no", Value: int32(0)}),
+			b.Properties(
+				wztest.Prop{Name: "bS", Value: "b"}, wztest.Prop{Name: "no", Value: int32(1)},
+				wztest.Prop{Name: "x", Value: int32(4)}, wztest.Prop{Name: "y", Value: int32(4)},
+				wztest.Prop{Name: "front", Value: int32(1)},
+			),
+		)},
+		wztest.Prop{Name: "0", Value: b.Properties(
+			wztest.Prop{Name: "info", Value: b.Properties(wztest.Prop{Name: "tS", Value: "t"})},
+			wztest.Prop{Name: "tile", Value: list(b, b.Properties(
+				wztest.Prop{Name: "u", Value: "bsc"},
+				wztest.Prop{Name: "no", Value: int32(0)},
+				wztest.Prop{Name: "x", Value: int32(2)},
+				wztest.Prop{Name: "y", Value: int32(2)},
+			))},
+			wztest.Prop{Name: "obj", Value: list(b, obj(b, "green", 4, 4, 0))},
+		)},
+		wztest.Prop{Name: "1", Value: b.Properties(
+			wztest.Prop{Name: "obj", Value: list(b, obj(b, "yellow", 2, 2, 0))},
+		)},
+		wztest.Prop{Name: "2", Value: b.Properties(
+			wztest.Prop{Name: "obj", Value: list(b, obj(b, "white", 6, 6, 5), obj(b, "black", 6, 6, 1))},
+		)},
+	)
+
+	cp, err := wzexplorer.NewCryptProvider(wztest.Version, wzexplorer.IvEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := wzexplorer.NewFile(cp, b.Write(t,
+		wztest.Entry{Name: "Map", Dir: []wztest.Entry{
+			{Name: "Map0", Dir: []wztest.Entry{{Name: "000000001.img", Image: m}}},
+		}},
+		wztest.Entry{Name: "Back", Dir: []wztest.Entry{{Name: "b.img", Image: b.Properties(
+			wztest.Prop{Name: "back", Value: list(b, solid(b, 8, 8, blue), solid(b, 1, 1, magenta))},
+		)}}},
+		wztest.Entry{Name: "Tile", Dir: []wztest.Entry{{Name: "t.img", Image: b.Properties(
+			wztest.Prop{Name: "bsc", Value: list(b, solid(b, 2, 2, red))},
+		)}}},
+		wztest.Entry{Name: "Obj", Dir: []wztest.Entry{{Name: "o.img", Image: b.Properties(
+			wztest.Prop{Name: "a", Value: b.Properties(wztest.Prop{Name: "b", Value: b.Properties(
+				wztest.Prop{Name: "green", Value: solid(b, 2, 2, green,
+					wztest.Prop{Name: "origin", Value: b.Vector(1, 1)},
+				)},
+				wztest.Prop{Name: "yellow", Value: solid(b, 1, 1, yellow)},
+				wztest.Prop{Name: "white", Value: solid(b, 1, 1, white)},
+				wztest.Prop{Name: "black", Value: solid(b, 1, 1, black)},
+			)})},
+		)}}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return NewRenderer(f)
+}
+
+func TestRender(t *testing.T) {
+	img, err := testRenderer(t).Render(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := image.Rect(0, 0, 8, 8); img.Bounds() != want {
+		t.Fatalf("bounds %v, want %v", img.Bounds(), want)
+	}
+	for _, c := range []struct {
+		x, y int
+		want color.NRGBA
+		why  string
+	}{
+		{0, 0, blue, "back"},
+		{2, 3, red, "tile"},
+		{3, 3, red, "tile above object of the same layer"},
+		{4, 3, green, "object placed by its origin"},
+		{2, 2, yellow, "layer 1 above layer 0"},
+		{6, 6, white, "higher z drawn last"},
+		{4, 4, magenta, "front back above every layer"},
+		{7, 7, blue, "back"},
+	} {
+		if got := img.NRGBAAt(c.x, c.y); got != c.want {
+			t.Errorf("(%d, %d) = %v, want %v: %s", c.x, c.y, got, c.want, c.why)
+		}
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	r := testRenderer(t)
+	img, err := r.Render(1, &Options{NoBack: true, NoTile: true, Bounds: image.Rect(0, 0, 8, 8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.NRGBAAt(0, 0); got.A != 0 {
+		t.Errorf("(0, 0) = %v without backs, want transparent", got)
+	}
+	if got := img.NRGBAAt(3, 3); got != green {
+		t.Errorf("(3, 3) = %v without tiles, want %v", got, green)
+	}
+
+	if _, err = r.Render(2, nil); err != ErrMapNotFound {
+		t.Errorf("Render(2) = %v, want ErrMapNotFound", err)
+	}
+}
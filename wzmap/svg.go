@@ -0,0 +1,120 @@
+package wzmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+type SVGOptions struct {
+	// Background drawn below the geometry, bounds are map coordinates like Renderer output
+	Background image.Image
+	NoFoothold bool
+	NoLadder   bool
+	NoPortal   bool
+	NoLife     bool
+}
+
+var footholdColors = []string{
+	"#ff0000", "#ff8000", "#ffff00", "#00ff00",
+	"#00ffff", "#0080ff", "#8000ff", "#ff00ff",
+}
+
+// layerColor returns the colour of a foothold layer, layers come from archive data and may be negative
+func layerColor(layer int) string {
+	n := len(footholdColors)
+	return footholdColors[(layer%n+n)%n]
+}
+
+func escape(s string) string {
+	buf := bytes.NewBuffer(nil)
+	_ = xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
+
+// WriteSVG draws the geometry as svg, the viewBox is map coordinates
+func (g *MapGeometry) WriteSVG(w io.Writer, opts *SVGOptions) error {
+	if opts == nil {
+		opts = &SVGOptions{}
+	}
+
+	bounds := g.Bounds
+	if opts.Background != nil {
+		bounds = bounds.Union(opts.Background.Bounds())
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="%d %d %d %d">`+"\n",
+		bounds.Dx(), bounds.Dy(), bounds.Min.X, bounds.Min.Y, bounds.Dx(), bounds.Dy())
+
+	if opts.Background != nil {
+		buf := bytes.NewBuffer(nil)
+		if err := png.Encode(buf, opts.Background); err != nil {
+			return err
+		}
+		r := opts.Background.Bounds()
+		fmt.Fprintf(bw, `<image x="%d" y="%d" width="%d" height="%d" href="data:image/png;base64,%s"/>`+"\n",
+			r.Min.X, r.Min.Y, r.Dx(), r.Dy(), base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+
+	if !opts.NoFoothold {
+		fmt.Fprintln(bw, `<g id="foothold" stroke-width="2">`)
+		for _, f := range g.Footholds {
+			c := layerColor(f.Layer)
+			fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"><title>fh %d layer %d group %d prev %d next %d</title></line>`+"\n",
+				f.X1, f.Y1, f.X2, f.Y2, c, f.ID, f.Layer, f.Group, f.Prev, f.Next)
+		}
+		fmt.Fprintln(bw, `</g>`)
+	}
+
+	if !opts.NoLadder {
+		fmt.Fprintln(bw, `<g id="ladderRope" stroke-width="3">`)
+		for _, l := range g.Ladders {
+			c, kind := "#c08040", "rope"
+			if l.Ladder {
+				c, kind = "#40c040", "ladder"
+			}
+			fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"><title>%s %d</title></line>`+"\n",
+				l.X, l.Y1, l.X, l.Y2, c, kind, l.ID)
+		}
+		fmt.Fprintln(bw, `</g>`)
+	}
+
+	if !opts.NoPortal {
+		fmt.Fprintln(bw, `<g id="portal" font-family="monospace" font-size="12">`)
+		for _, p := range g.Portals {
+			title := fmt.Sprintf("portal %d %s type %d", p.ID, p.Name, p.Type)
+			if p.HasTarget() {
+				title += fmt.Sprintf(" -> %d %s", p.TargetMap, p.TargetName)
+			}
+			fmt.Fprintf(bw, `<circle cx="%d" cy="%d" r="8" fill="none" stroke="#0000ff" stroke-width="2"><title>%s</title></circle>`+"\n",
+				p.X, p.Y, escape(title))
+			fmt.Fprintf(bw, `<text x="%d" y="%d" fill="#0000ff">%s</text>`+"\n",
+				p.X+10, p.Y-10, escape(p.Name))
+		}
+		fmt.Fprintln(bw, `</g>`)
+	}
+
+	if !opts.NoLife {
+		fmt.Fprintln(bw, `<g id="life">`)
+		for _, l := range g.Life {
+			c := "#ff0000"
+			if l.Type == "n" {
+				c = "#00a000"
+			}
+			fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-opacity="0.5"/>`+"\n",
+				l.RX0, l.Cy, l.RX1, l.Cy, c)
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="8" height="8" fill="%s"><title>%s %s fh %d</title></rect>`+"\n",
+				l.X-4, l.Cy-8, c, escape(l.Type), escape(l.LifeID), l.Foothold)
+		}
+		fmt.Fprintln(bw, `</g>`)
+	}
+
+	fmt.Fprintln(bw, `</svg>`)
+	return bw.Flush()
+}
@@ -0,0 +1,30 @@
+package wzmap
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestWriteSVGNegativeLayer(t *testing.T) {
+	g := &MapGeometry{
+		Bounds: image.Rect(-10, -10, 10, 10),
+		Footholds: []*Foothold{
+			{ID: 1, Layer: -1, X1: -5, X2: 5},
+			{ID: 2, Layer: -9, X1: -5, X2: 5},
+			{ID: 3, Layer: 9, X1: -5, X2: 5},
+		},
+	}
+	var buf bytes.Buffer
+	if err := g.WriteSVG(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	// -1 and -9 wrap to the last colour, 9 to the second
+	if n := strings.Count(buf.String(), `stroke="#ff00ff"`); n != 2 {
+		t.Errorf("%d footholds in the last layer colour, want 2", n)
+	}
+	if !strings.Contains(buf.String(), `stroke="#ff8000"`) {
+		t.Error("layer 9 doesn't wrap to the second colour")
+	}
+}
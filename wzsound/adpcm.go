@@ -0,0 +1,115 @@
+package wzsound
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var imaIndexTable = [16]int{
+	-1, -1, -1, -1, 2, 4, 6, 8,
+	-1, -1, -1, -1, 2, 4, 6, 8,
+}
+
+var imaStepTable = [89]int{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+	19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+	130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+	337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+	876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+	2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+	5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+	15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+}
+
+type imaChannel struct {
+	predictor int
+	index     int
+}
+
+func (c *imaChannel) decode(nibble byte) int16 {
+	step := imaStepTable[c.index]
+	diff := step >> 3
+	if nibble&1 != 0 {
+		diff += step >> 2
+	}
+	if nibble&2 != 0 {
+		diff += step >> 1
+	}
+	if nibble&4 != 0 {
+		diff += step
+	}
+	if nibble&8 != 0 {
+		c.predictor -= diff
+	} else {
+		c.predictor += diff
+	}
+	if c.predictor > 32767 {
+		c.predictor = 32767
+	} else if c.predictor < -32768 {
+		c.predictor = -32768
+	}
+	c.index += imaIndexTable[nibble]
+	if c.index < 0 {
+		c.index = 0
+	} else if c.index > 88 {
+		c.index = 88
+	}
+	return int16(c.predictor)
+}
+
+// DecodeIMAADPCM decodes microsoft IMA ADPCM blocks into 16 bit samples
+func DecodeIMAADPCM(data []byte, sampleRate, channels, blockAlign int) (*PCM, error) {
+	if channels <= 0 || blockAlign <= 4*channels {
+		return nil, errors.New("invalid ima adpcm format")
+	}
+
+	out := make([]byte, 0, len(data)*4)
+	state := make([]imaChannel, channels)
+	samples := make([][]int16, channels)
+
+	for len(data) > 0 {
+		block := data
+		if len(block) > blockAlign {
+			block = block[:blockAlign]
+		}
+		data = data[len(block):]
+		if len(block) < 4*channels {
+			break
+		}
+
+		for ch := 0; ch < channels; ch++ {
+			h := block[ch*4:]
+			state[ch].predictor = int(int16(binary.LittleEndian.Uint16(h)))
+			state[ch].index = int(h[2])
+			if state[ch].index > 88 {
+				state[ch].index = 88
+			}
+			samples[ch] = append(samples[ch][:0], int16(state[ch].predictor))
+		}
+
+		// every channel stores 8 samples per 4 bytes in turn
+		body := block[4*channels:]
+		for len(body) >= 4*channels {
+			for ch := 0; ch < channels; ch++ {
+				for _, b := range body[ch*4 : ch*4+4] {
+					samples[ch] = append(samples[ch], state[ch].decode(b&0x0f), state[ch].decode(b>>4))
+				}
+			}
+			body = body[4*channels:]
+		}
+
+		for i := 0; i < len(samples[0]); i++ {
+			for ch := 0; ch < channels; ch++ {
+				out = binary.LittleEndian.AppendUint16(out, uint16(samples[ch][i]))
+			}
+		}
+	}
+
+	return &PCM{
+		SampleRate:    sampleRate,
+		Channels:      channels,
+		BitsPerSample: 16,
+		Data:          out,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package wzsound
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// imaBlock returns a block header of predictor and step index
+func imaBlock(predictor int16, index byte) []byte {
+	h := binary.LittleEndian.AppendUint16(nil, uint16(predictor))
+	return append(h, index, 0)
+}
+
+func TestDecodeIMAADPCMMono(t *testing.T) {
+	block := append(imaBlock(100, 0), 0x77, 0x77, 0xf0, 0x08)
+	// clamps the predictor to 16 bit and the step index to the table
+	clamp := append(imaBlock(32760, 88), 0x07, 0, 0, 0)
+	// a trailing block shorter than its header is dropped
+	data := append(append(block, clamp...), 1, 2)
+
+	pcm, err := DecodeIMAADPCM(data, 22050, 1, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := pcm.Int16()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int16{
+		100, 111, 141, 204, 340, 359, 93, 55, 89,
+		32760, 32767, 32767, 32767, 32767, 32767, 32767, 32767, 32767,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("samples %v, want %v", got, want)
+	}
+	if pcm.SampleRate != 22050 || pcm.Channels != 1 || pcm.BitsPerSample != 16 {
+		t.Errorf("format %d Hz %d channels %d bits", pcm.SampleRate, pcm.Channels, pcm.BitsPerSample)
+	}
+}
+
+func TestDecodeIMAADPCMStereo(t *testing.T) {
+	// both headers come first, then every channel stores 4 bytes in turn
+	block := append(imaBlock(100, 0), imaBlock(-200, 10)...)
+	block = append(block, 0x77, 0x77, 0xf0, 0x08, 0x10, 0x32, 0x54, 0x76)
+
+	pcm, err := DecodeIMAADPCM(block, 22050, 2, len(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := pcm.Int16()
+	left := []int16{100, 111, 141, 204, 340, 359, 93, 55, 89}
+	right := []int16{-200, -198, -192, -182, -171, -157, -135, -99, -23}
+	var want []int16
+	for i := range left {
+		want = append(want, left[i], right[i])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("samples %v, want %v", got, want)
+	}
+	if pcm.Frames() != 9 {
+		t.Errorf("%d frames, want 9", pcm.Frames())
+	}
+}
+
+func TestDecodeIMAADPCMInvalid(t *testing.T) {
+	for _, c := range [][2]int{{0, 36}, {1, 4}, {2, 8}} {
+		if _, err := DecodeIMAADPCM(make([]byte, 36), 22050, c[0], c[1]); err == nil {
+			t.Errorf("%d channels block align %d decoded", c[0], c[1])
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package wzsound
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNoFrames = errors.New("no mp3 frames")
+
+type MPEGVersion byte
+
+const (
+	MPEGVersion25 MPEGVersion = 0
+	MPEGVersion2  MPEGVersion = 2
+	MPEGVersion1  MPEGVersion = 3
+)
+
+func (v MPEGVersion) String() string {
+	switch v {
+	case MPEGVersion1:
+		return "MPEG1"
+	case MPEGVersion2:
+		return "MPEG2"
+	case MPEGVersion25:
+		return "MPEG2.5"
+	}
+	return "Unknown"
+}
+
+type ChannelMode byte
+
+const (
+	ChannelModeStereo ChannelMode = iota
+	ChannelModeJointStereo
+	ChannelModeDualChannel
+	ChannelModeMono
+)
+
+func (m ChannelMode) String() string {
+	switch m {
+	case ChannelModeStereo:
+		return "Stereo"
+	case ChannelModeJointStereo:
+		return "JointStereo"
+	case ChannelModeDualChannel:
+		return "DualChannel"
+	case ChannelModeMono:
+		return "Mono"
+	}
+	return "Unknown"
+}
+
+// Channels returns the channel count of the mode
+func (m ChannelMode) Channels() int {
+	if m == ChannelModeMono {
+		return 1
+	}
+	return 2
+}
+
+var bitrates = [2][3][16]int{
+	// MPEG1 layer I II III
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, -1},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, -1},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, -1},
+	},
+	// MPEG2 MPEG2.5 layer I II III
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, -1},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1},
+	},
+}
+
+var sampleRates = map[MPEGVersion][3]int{
+	MPEGVersion1:  {44100, 48000, 32000},
+	MPEGVersion2:  {22050, 24000, 16000},
+	MPEGVersion25: {11025, 12000, 8000},
+}
+
+// FrameHeader decoded 4 bytes mp3 frame header
+type FrameHeader struct {
+	Version     MPEGVersion
+	Layer       int
+	Protected   bool
+	Bitrate     int
+	SampleRate  int
+	Padding     bool
+	ChannelMode ChannelMode
+}
+
+// ParseFrameHeader decodes h, free format bitrate is treated as invalid
+func ParseFrameHeader(h []byte) (fh FrameHeader, ok bool) {
+	if len(h) < 4 || h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return
+	}
+	fh.Version = MPEGVersion((h[1] >> 3) & 0x3)
+	if fh.Version == 1 {
+		return
+	}
+	layer := (h[1] >> 1) & 0x3
+	if layer == 0 {
+		return
+	}
+	fh.Layer = 4 - int(layer)
+	fh.Protected = h[1]&0x1 == 0
+
+	table := 1
+	if fh.Version == MPEGVersion1 {
+		table = 0
+	}
+	fh.Bitrate = bitrates[table][fh.Layer-1][h[2]>>4]
+	if fh.Bitrate <= 0 {
+		return
+	}
+	srIndex := (h[2] >> 2) & 0x3
+	if srIndex == 3 {
+		return
+	}
+	fh.SampleRate = sampleRates[fh.Version][srIndex]
+	fh.Padding = (h[2]>>1)&0x1 == 1
+	fh.ChannelMode = ChannelMode(h[3] >> 6)
+	ok = true
+	return
+}
+
+// Samples returns samples per channel of the frame
+func (fh FrameHeader) Samples() int {
+	switch {
+	case fh.Layer == 1:
+		return 384
+	case fh.Layer == 2 || fh.Version == MPEGVersion1:
+		return 1152
+	}
+	return 576
+}
+
+// Size returns the frame length in bytes including the header
+func (fh FrameHeader) Size() int {
+	padding := 0
+	if fh.Padding {
+		padding = 1
+	}
+	if fh.Layer == 1 {
+		return (12*fh.Bitrate*1000/fh.SampleRate + padding) * 4
+	}
+	return fh.Samples()/8*fh.Bitrate*1000/fh.SampleRate + padding
+}
+
+func (fh FrameHeader) sideInfoSize() int {
+	if fh.Version == MPEGVersion1 {
+		if fh.ChannelMode == ChannelModeMono {
+			return 17
+		}
+		return 32
+	}
+	if fh.ChannelMode == ChannelModeMono {
+		return 9
+	}
+	return 17
+}
+
+func (fh FrameHeader) compatible(o FrameHeader) bool {
+	return fh.Version == o.Version && fh.Layer == o.Layer && fh.SampleRate == o.SampleRate
+}
+
+type MP3Info struct {
+	Version     MPEGVersion
+	Layer       int
+	SampleRate  int
+	ChannelMode ChannelMode
+	// Bitrate average bitrate in kbps
+	Bitrate int
+	Frames  int
+	Samples int64
+	// Duration computed from the frames found
+	Duration time.Duration
+	// VBR bitrate changes between frames or a Xing/VBRI header exists
+	VBR   bool
+	ID3v1 bool
+	ID3v2 bool
+	// Truncated the last frame is shorter than its header declares
+	Truncated bool
+	// CorruptFrames places where the frame chain broke and had to resync
+	CorruptFrames int
+	// JunkBytes bytes skipped while searching for frame sync
+	JunkBytes int64
+	// Size bytes scanned
+	Size int64
+}
+
+// Valid stream has frames and no corruption or truncation
+func (i *MP3Info) Valid() bool {
+	return i.Frames > 0 && !i.Truncated && i.CorruptFrames == 0
+}
+
+type scanner struct {
+	r    *bufio.Reader
+	info *MP3Info
+}
+
+func (s *scanner) discard(n int) (int, error) {
+	d, err := s.r.Discard(n)
+	s.info.Size += int64(d)
+	return d, err
+}
+
+func (s *scanner) skipID3v2() error {
+	h, err := s.r.Peek(10)
+	if err != nil || !bytes.Equal(h[:3], []byte("ID3")) {
+		return nil
+	}
+	size := int(h[6]&0x7f)<<21 | int(h[7]&0x7f)<<14 | int(h[8]&0x7f)<<7 | int(h[9]&0x7f)
+	size += 10
+	if h[5]&0x10 != 0 {
+		// footer present
+		size += 10
+	}
+	s.info.ID3v2 = true
+	if _, err = s.discard(size); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// ScanMP3 walks every frame of r, data after the last frame is treated as junk except ID3v1
+func ScanMP3(r io.Reader) (*MP3Info, error) {
+	s := &scanner{r: bufio.NewReaderSize(r, 8192), info: &MP3Info{}}
+	info := s.info
+
+	if err := s.skipID3v2(); err != nil {
+		return nil, err
+	}
+
+	var (
+		first    *FrameHeader
+		bytesSum int64
+		synced   = true
+	)
+
+	for {
+		h, err := s.r.Peek(4)
+		if err != nil {
+			if err == io.EOF {
+				// trailing bytes shorter than a header
+				info.JunkBytes += int64(len(h))
+				info.Size += int64(len(h))
+				break
+			}
+			return nil, err
+		}
+
+		if bytes.Equal(h[:3], []byte("TAG")) {
+			if tag, _ := s.r.Peek(129); len(tag) == 128 {
+				info.ID3v1 = true
+				_, _ = s.discard(128)
+				continue
+			}
+		}
+
+		fh, ok := ParseFrameHeader(h)
+		if ok && first != nil && !fh.compatible(*first) {
+			ok = false
+		}
+		if !ok {
+			if synced && first != nil {
+				info.CorruptFrames++
+			}
+			synced = false
+			info.JunkBytes++
+			if _, err = s.discard(1); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		synced = true
+
+		size := fh.Size()
+		if first == nil {
+			first = &fh
+			info.Version = fh.Version
+			info.Layer = fh.Layer
+			info.SampleRate = fh.SampleRate
+			info.ChannelMode = fh.ChannelMode
+			info.Bitrate = fh.Bitrate
+
+			// Xing/Info/VBRI tag frame isn't audio
+			frame, _ := s.r.Peek(size)
+			xing := 4 + fh.sideInfoSize()
+			if len(frame) >= xing+4 {
+				tag := string(frame[xing : xing+4])
+				if tag == "Xing" {
+					info.VBR = true
+				}
+				if tag == "Xing" || tag == "Info" {
+					if _, err = s.discard(size); err != nil && err != io.EOF {
+						return nil, err
+					}
+					continue
+				}
+			}
+			if len(frame) >= 36+4 && string(frame[36:40]) == "VBRI" {
+				info.VBR = true
+				if _, err = s.discard(size); err != nil && err != io.EOF {
+					return nil, err
+				}
+				continue
+			}
+		} else if fh.Bitrate != info.Bitrate {
+			info.VBR = true
+		}
+
+		n, err := s.discard(size)
+		if err == io.EOF || n < size {
+			info.Truncated = true
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		info.Frames++
+		info.Samples += int64(fh.Samples())
+		bytesSum += int64(size)
+	}
+
+	if info.Frames == 0 {
+		return info, ErrNoFrames
+	}
+
+	info.Duration = time.Duration(info.Samples) * time.Second / time.Duration(info.SampleRate)
+	if info.Duration > 0 {
+		info.Bitrate = int(bytesSum * 8 * int64(time.Second) / int64(info.Duration) / 1000)
+	}
+	return info, nil
+}
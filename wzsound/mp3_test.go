@@ -0,0 +1,186 @@
+package wzsound
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// MPEG1 layer III 44100 Hz stereo, 417 bytes at 128 kbps and 522 at 160 kbps
+var (
+	header128 = []byte{0xff, 0xfb, 0x90, 0x00}
+	header160 = []byte{0xff, 0xfb, 0xa0, 0x00}
+)
+
+func frame(header []byte) []byte {
+	fh, ok := ParseFrameHeader(header)
+	if !ok {
+		panic("invalid header")
+	}
+	f := make([]byte, fh.Size())
+	copy(f, header)
+	for i := 4; i < len(f); i++ {
+		// never a frame sync
+		f[i] = byte(i % 0x7f)
+	}
+	return f
+}
+
+func frames(header []byte, n int) []byte {
+	var buf []byte
+	for i := 0; i < n; i++ {
+		buf = append(buf, frame(header)...)
+	}
+	return buf
+}
+
+// id3v2 returns a tag with a body of size bytes, footer sets the flag and appends the footer
+func id3v2(size int, footer bool) []byte {
+	syncsafe := []byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	flags := byte(0)
+	if footer {
+		flags = 0x10
+	}
+	tag := append([]byte{'I', 'D', '3', 4, 0, flags}, syncsafe...)
+	tag = append(tag, make([]byte, size)...)
+	if footer {
+		tag = append(tag, '3', 'D', 'I', 4, 0, flags)
+		tag = append(tag, syncsafe...)
+	}
+	return tag
+}
+
+func id3v1() []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	return tag
+}
+
+func scan(t *testing.T, data []byte) *MP3Info {
+	t.Helper()
+	info, err := ScanMP3(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Size %d, want %d", info.Size, len(data))
+	}
+	return info
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	for _, c := range []struct {
+		header  []byte
+		want    FrameHeader
+		size    int
+		samples int
+	}{
+		{header128, FrameHeader{Version: MPEGVersion1, Layer: 3, Bitrate: 128, SampleRate: 44100}, 417, 1152},
+		{[]byte{0xff, 0xfb, 0x92, 0xc0}, FrameHeader{Version: MPEGVersion1, Layer: 3, Bitrate: 128, SampleRate: 44100, Padding: true, ChannelMode: ChannelModeMono}, 418, 1152},
+		{[]byte{0xff, 0xf3, 0x84, 0x40}, FrameHeader{Version: MPEGVersion2, Layer: 3, Bitrate: 64, SampleRate: 24000, ChannelMode: ChannelModeJointStereo}, 192, 576},
+		{[]byte{0xff, 0xe3, 0x58, 0x00}, FrameHeader{Version: MPEGVersion25, Layer: 3, Bitrate: 40, SampleRate: 8000}, 360, 576},
+		{[]byte{0xff, 0xfd, 0x90, 0x00}, FrameHeader{Version: MPEGVersion1, Layer: 2, Bitrate: 160, SampleRate: 44100}, 522, 1152},
+		{[]byte{0xff, 0xfe, 0x90, 0x00}, FrameHeader{Version: MPEGVersion1, Layer: 1, Protected: true, Bitrate: 288, SampleRate: 44100}, 312, 384},
+	} {
+		fh, ok := ParseFrameHeader(c.header)
+		if !ok || fh != c.want {
+			t.Errorf("% x: %+v %v, want %+v", c.header, fh, ok, c.want)
+			continue
+		}
+		if fh.Size() != c.size || fh.Samples() != c.samples {
+			t.Errorf("% x: size %d samples %d, want %d %d", c.header, fh.Size(), fh.Samples(), c.size, c.samples)
+		}
+	}
+
+	for _, h := range [][]byte{
+		{0xff, 0xfb, 0x90},       // short
+		{0xfe, 0xfb, 0x90, 0x00}, // no sync
+		{0xff, 0xeb, 0x90, 0x00}, // reserved version
+		{0xff, 0xf9, 0x90, 0x00}, // reserved layer
+		{0xff, 0xfb, 0xf0, 0x00}, // bad bitrate
+		{0xff, 0xfb, 0x00, 0x00}, // free format
+		{0xff, 0xfb, 0x9c, 0x00}, // reserved sample rate
+	} {
+		if _, ok := ParseFrameHeader(h); ok {
+			t.Errorf("% x parsed", h)
+		}
+	}
+}
+
+func TestScanMP3CBR(t *testing.T) {
+	info := scan(t, append(append(id3v2(100, false), frames(header128, 10)...), id3v1()...))
+	if !info.Valid() || info.Frames != 10 || info.VBR || !info.ID3v1 || !info.ID3v2 || info.JunkBytes != 0 {
+		t.Fatalf("%+v", info)
+	}
+	if info.Samples != 11520 || info.Duration != 11520*time.Second/44100 {
+		t.Errorf("samples %d duration %s", info.Samples, info.Duration)
+	}
+	if info.Bitrate != 127 {
+		// 417 byte frames are slightly below 128 kbps without padding
+		t.Errorf("bitrate %d", info.Bitrate)
+	}
+}
+
+func TestScanMP3ID3v2Footer(t *testing.T) {
+	info := scan(t, append(id3v2(300, true), frames(header128, 3)...))
+	if !info.Valid() || !info.ID3v2 || info.Frames != 3 || info.JunkBytes != 0 {
+		t.Fatalf("footer not skipped: %+v", info)
+	}
+}
+
+func TestScanMP3TruncatedLastFrame(t *testing.T) {
+	data := frames(header128, 5)
+	data = append(data, frame(header128)[:200]...)
+	info := scan(t, data)
+	if !info.Truncated || info.Valid() || info.Frames != 5 {
+		t.Fatalf("%+v", info)
+	}
+}
+
+func TestScanMP3Xing(t *testing.T) {
+	xing := frame(header128)
+	// side info of MPEG1 stereo is 32 bytes
+	copy(xing[4+32:], "Xing")
+	info := scan(t, append(xing, frames(header128, 4)...))
+	if !info.VBR || info.Frames != 4 || !info.Valid() {
+		t.Fatalf("%+v", info)
+	}
+
+	copy(xing[4+32:], "Info")
+	info = scan(t, append(xing, frames(header128, 4)...))
+	if info.VBR || info.Frames != 4 {
+		t.Fatalf("Info tag: %+v", info)
+	}
+}
+
+func TestScanMP3VBRI(t *testing.T) {
+	vbri := frame(header128)
+	copy(vbri[36:], "VBRI")
+	info := scan(t, append(vbri, frames(header128, 2)...))
+	if !info.VBR || info.Frames != 2 {
+		t.Fatalf("%+v", info)
+	}
+}
+
+func TestScanMP3VariableBitrate(t *testing.T) {
+	info := scan(t, append(frames(header128, 2), frames(header160, 2)...))
+	if !info.VBR || info.Frames != 4 || !info.Valid() {
+		t.Fatalf("%+v", info)
+	}
+}
+
+func TestScanMP3Resync(t *testing.T) {
+	data := frames(header128, 2)
+	data = append(data, 1, 2, 3, 4, 5)
+	data = append(data, frames(header128, 2)...)
+	info := scan(t, data)
+	if info.Frames != 4 || info.CorruptFrames != 1 || info.JunkBytes != 5 || info.Valid() {
+		t.Fatalf("%+v", info)
+	}
+}
+
+func TestScanMP3NoFrames(t *testing.T) {
+	if _, err := ScanMP3(bytes.NewReader(make([]byte, 1000))); err != ErrNoFrames {
+		t.Fatalf("error %v, want ErrNoFrames", err)
+	}
+}
@@ -0,0 +1,63 @@
+package wzsound
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/hajimehoshi/go-mp3"
+	"io"
+	"time"
+)
+
+// PCM decoded interleaved little-endian samples
+type PCM struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	Data          []byte
+}
+
+// Frames returns samples per channel
+func (p *PCM) Frames() int {
+	if p.Channels == 0 || p.BitsPerSample == 0 {
+		return 0
+	}
+	return len(p.Data) / (p.Channels * p.BitsPerSample / 8)
+}
+
+// Duration returns the playback length
+func (p *PCM) Duration() time.Duration {
+	if p.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(p.Frames()) * time.Second / time.Duration(p.SampleRate)
+}
+
+// Int16 returns 16 bit samples, other depths aren't converted
+func (p *PCM) Int16() ([]int16, error) {
+	if p.BitsPerSample != 16 {
+		return nil, errors.New("pcm isn't 16 bit")
+	}
+	samples := make([]int16, len(p.Data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(p.Data[i*2:]))
+	}
+	return samples, nil
+}
+
+// DecodeMP3 decodes the whole mp3 stream into 16 bit stereo samples
+func DecodeMP3(r io.Reader) (*PCM, error) {
+	d, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(d)
+	if err != nil {
+		return nil, err
+	}
+	return &PCM{
+		SampleRate:    d.SampleRate(),
+		Channels:      2,
+		BitsPerSample: 16,
+		Data:          data,
+	}, nil
+}
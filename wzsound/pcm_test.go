@@ -0,0 +1,63 @@
+package wzsound
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPCM(t *testing.T) {
+	p := &PCM{SampleRate: 4, Channels: 2, BitsPerSample: 16, Data: []byte{1, 0, 0xff, 0xff, 0, 0x80, 0xff, 0x7f}}
+	if p.Frames() != 2 {
+		t.Errorf("%d frames, want 2", p.Frames())
+	}
+	if p.Duration() != 500*time.Millisecond {
+		t.Errorf("duration %s, want 500ms", p.Duration())
+	}
+	samples, err := p.Int16()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int16{1, -1, -32768, 32767}; !reflect.DeepEqual(samples, want) {
+		t.Errorf("samples %v, want %v", samples, want)
+	}
+
+	p.BitsPerSample = 8
+	if _, err = p.Int16(); err == nil {
+		t.Error("8 bit pcm converted to 16 bit")
+	}
+	if p.Frames() != 4 {
+		t.Errorf("8 bit %d frames, want 4", p.Frames())
+	}
+	if (&PCM{}).Duration() != 0 || (&PCM{SampleRate: 1}).Frames() != 0 {
+		t.Error("empty pcm has a length")
+	}
+}
+
+func TestDecodeMP3(t *testing.T) {
+	// frames without side info decode to silence
+	data := make([]byte, 0)
+	for i := 0; i < 4; i++ {
+		f := make([]byte, 417)
+		copy(f, header128)
+		data = append(data, f...)
+	}
+	pcm, err := DecodeMP3(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcm.SampleRate != 44100 || pcm.Channels != 2 || pcm.BitsPerSample != 16 {
+		t.Errorf("format %d Hz %d channels %d bits", pcm.SampleRate, pcm.Channels, pcm.BitsPerSample)
+	}
+	if pcm.Frames() == 0 || pcm.Frames()%1152 != 0 {
+		t.Errorf("%d frames, want whole mp3 frames of 1152 samples", pcm.Frames())
+	}
+	if !bytes.Equal(pcm.Data, make([]byte, len(pcm.Data))) {
+		t.Error("silent frames decoded to sound")
+	}
+
+	if _, err = DecodeMP3(bytes.NewReader([]byte("not an mp3"))); err == nil {
+		t.Error("garbage decoded")
+	}
+}